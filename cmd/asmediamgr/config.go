@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"asmediamgr/pkg/common"
+	"asmediamgr/pkg/config"
+	"asmediamgr/pkg/parser"
+)
+
+// runConfig runs the config subcommand, config print writes the effective config merged from
+// defaults, the config file, the environment and flags, returns the exit code
+func runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintf(os.Stderr, "usage: %s config print [flags]\n", filepath.Base(os.Args[0]))
+		return 2
+	}
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	cfg, err := config.Load(fs, args[1:], os.Environ())
+	if err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+		}
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %v\n", fs.Args())
+		return 2
+	}
+	if cfg.File != "" {
+		fmt.Printf("# loaded from %s\n", cfg.File)
+	}
+	err = cfg.Print(os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to print config: %v\n", err)
+		return 1
+	}
+	err = cfg.Validate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// configScanDirs returns the scan dirs of cfg and options of those with any option set
+func configScanDirs(cfg *config.Configuration) ([]string, map[string]*parser.ScanDirOpts) {
+	var scanDirs []string
+	scanDirOpts := make(map[string]*parser.ScanDirOpts)
+	for _, dir := range cfg.MotherDirs {
+		scanDirs = append(scanDirs, dir.DirPath)
+		opts := &parser.ScanDirOpts{
+			MediaTypeDirs: make(map[common.MediaType]string),
+			Parsers:       dir.Parsers,
+			SleepDurScan:  dir.SleepInterval,
+			Workers:       dir.Workers,
+		}
+		if dir.MovieTargetDir != "" {
+			opts.MediaTypeDirs[common.MediaTypeMovie] = dir.MovieTargetDir
+		}
+		if dir.TvTargetDir != "" {
+			opts.MediaTypeDirs[common.MediaTypeTv] = dir.TvTargetDir
+		}
+		if dir.TrashDir != "" {
+			opts.MediaTypeDirs[common.MediaTypeTrash] = dir.TrashDir
+		}
+		if len(opts.MediaTypeDirs) == 0 && len(opts.Parsers) == 0 && opts.SleepDurScan == 0 && opts.Workers == 0 {
+			continue
+		}
+		scanDirOpts[dir.DirPath] = opts
+	}
+	return scanDirs, scanDirOpts
+}
+
+// configStatDirs returns the stat dirs of cfg, target dirs are always included
+func configStatDirs(cfg *config.Configuration) (movieDirs, tvDirs []string) {
+	for _, dir := range cfg.StatDirs {
+		switch dir.MediaType {
+		case config.MediaTypeMovie:
+			movieDirs = appendIfMissing(movieDirs, dir.DirPath)
+		case config.MediaTypeTv:
+			tvDirs = appendIfMissing(tvDirs, dir.DirPath)
+		}
+	}
+	movieDirs = appendIfMissing(movieDirs, cfg.DestMovieOnAirDir)
+	tvDirs = appendIfMissing(tvDirs, cfg.DestTvOnAirDir)
+	for _, dir := range cfg.MotherDirs {
+		if dir.MovieTargetDir != "" {
+			movieDirs = appendIfMissing(movieDirs, dir.MovieTargetDir)
+		}
+		if dir.TvTargetDir != "" {
+			tvDirs = appendIfMissing(tvDirs, dir.TvTargetDir)
+		}
+	}
+	return movieDirs, tvDirs
+}
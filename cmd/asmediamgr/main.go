@@ -1,223 +1,406 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"asmediamgr/pkg/admin"
 	"asmediamgr/pkg/common"
 	"asmediamgr/pkg/common/aslog"
+	"asmediamgr/pkg/config"
 	"asmediamgr/pkg/disk"
+	"asmediamgr/pkg/identify"
 	"asmediamgr/pkg/parser"
+	"asmediamgr/pkg/parser/plugin"
 	"asmediamgr/pkg/stat"
 	"asmediamgr/pkg/tmdb"
 	"asmediamgr/pkg/utils"
 
+	_ "asmediamgr/pkg/parser/fansub"
 	_ "asmediamgr/pkg/parser/moviedir"
 	_ "asmediamgr/pkg/parser/moviefile"
+	_ "asmediamgr/pkg/parser/scene"
 	_ "asmediamgr/pkg/parser/tvdir"
 	_ "asmediamgr/pkg/parser/tvepfile"
 )
 
-// flagConfig is the configuration for the program
-type flagConfig struct {
-	configFile                  string
-	parserConfigDir             string
-	loglv                       string
-	aslogConfig                 aslog.Config
-	enableParsers               flagStringSlice
-	disableParsers              flagStringSlice
-	parserDirs                  flagStringSlice
-	parserTargetMovieDir        string
-	parserTargetTvDir           string
-	parserTargetTrash           string
-	parserScanDur               time.Duration
-	parserParseDur              time.Duration
-	tmdbProxy                   string
-	tmdbCacheDur                time.Duration
-	dryRun                      bool
-	statInterval                time.Duration
-	statInitWait                time.Duration
-	statMovieDirs               flagStringSlice
-	statTvDirs                  flagStringSlice
-	statLargeMovieSize          string
-	statLargeMovieSizeBytes     int64
-	statLargeTvEpisodeSize      string
-	statLargeTvEpisodeSizeBytes int64
-	enableStat                  bool
-	enablePrometheusHTTP        bool
-	prometheusPort              int
-}
-
-type flagStringSlice []string
-
-func (f *flagStringSlice) String() string {
-	return fmt.Sprintf("%v", *f)
-}
-
-func (f *flagStringSlice) Set(value string) error {
-	*f = append(*f, value)
-	return nil
+func main() {
+	os.Exit(run())
 }
 
-func main() {
+// run runs the subcommand in os.Args, returns the exit code
+// it returns instead of exiting, so deferred cleanups such as closing plugins run
+func run() int {
+	args := os.Args[1:]
+	explain := false
+	if len(args) > 0 {
+		switch args[0] {
+		case "undo":
+			return runUndo(args[1:])
+		case "testpatterns":
+			return runTestPatterns(args[1:])
+		case "config":
+			return runConfig(args[1:])
+		case "run":
+			args = args[1:] // same as no subcommand, kept for run -once
+		case "explain":
+			args = args[1:] // same flags as run, so the entry is parsed as configured
+			explain = true
+		}
+	}
 	if os.Getenv("DEBUG") != "" {
 		runtime.SetBlockProfileRate(20)
 		runtime.SetMutexProfileFraction(20)
 	}
-	cfg := flagConfig{
-		aslogConfig: aslog.Config{},
-	}
-	flag.StringVar(&cfg.configFile, "config", "config.yaml", "config file")
-	flag.StringVar(&cfg.parserConfigDir, "parsercfg", "parsercfg", "parser dir")
-	flag.StringVar(&cfg.loglv, "loglv", "info", "log level")
-	flag.Var(&cfg.enableParsers, "enable", "enable parsers")
-	flag.Var(&cfg.disableParsers, "disable", "disable parsers")
-	flag.Var(&cfg.parserDirs, "scandir", "parser dirs")
-	flag.StringVar(&cfg.parserTargetMovieDir, "movietarget", "movies", "target movie dir")
-	flag.StringVar(&cfg.parserTargetTvDir, "tvtarget", "tv", "target tv dir")
-	flag.StringVar(&cfg.parserTargetTrash, "trash", "trash", "trash dir")
-	flag.DurationVar(&cfg.parserScanDur, "scandur", 5*time.Minute, "scan duration")
-	flag.DurationVar(&cfg.parserParseDur, "parsedur", 1*time.Second, "parse duration")
-	flag.StringVar(&cfg.tmdbProxy, "tmdbproxy", "", "tmdb proxy")
-	flag.DurationVar(&cfg.tmdbCacheDur, "tmdbcachedur", 6*time.Hour, "tmdb cache duration")
-	flag.BoolVar(&cfg.dryRun, "dryrun", false, "dry run")
-	flag.DurationVar(&cfg.statInterval, "statinterval", 6*time.Hour, "stat interval")
-	flag.DurationVar(&cfg.statInitWait, "statinitwait", 10*time.Second, "stat init wait")
-	flag.Var(&cfg.statMovieDirs, "statmoviedir", "stat movie dirs")
-	flag.Var(&cfg.statTvDirs, "stattvdir", "stat tv dirs")
-	flag.StringVar(&cfg.statLargeMovieSize, "statlargemoviesize", "10G", "stat large movie size")
-	flag.StringVar(&cfg.statLargeTvEpisodeSize, "statlargeepisodesize", "5G", "stat large tv episode size")
-	flag.BoolVar(&cfg.enableStat, "stat", true, "enable stat")
-	flag.BoolVar(&cfg.enablePrometheusHTTP, "prometheus", true, "enable prometheus http")
-	flag.IntVar(&cfg.prometheusPort, "prometheusport", 12200, "prometheus port")
-	flag.Parse()
-
-	cfg.statMovieDirs = append(cfg.statMovieDirs, cfg.parserTargetMovieDir)
-	cfg.statTvDirs = append(cfg.statTvDirs, cfg.parserTargetTvDir)
-	if n, err := utils.SizeStringToBytesNum(cfg.statLargeMovieSize); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to parse large movie size: %v\n", err)
-		os.Exit(1)
-	} else {
-		cfg.statLargeMovieSizeBytes = n
+	once := flag.Bool("once", false, "run a single scan pass, print a summary and exit, non-zero exit code on failures, "+
+		"an optional path argument limits the pass to a scan dir or a single entry")
+	flag.Usage = func() {
+		name := filepath.Base(os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [run] [flags] [-once [path]]\n       %s explain [flags] path\n       %s undo [flags]\n       %s testpatterns [flags] names.txt\n       %s config print [flags]\n", name, name, name, name, name)
+		flag.PrintDefaults()
 	}
-	if n, err := utils.SizeStringToBytesNum(cfg.statLargeTvEpisodeSize); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to parse large episode size: %v\n", err)
-		os.Exit(1)
-	} else {
-		cfg.statLargeTvEpisodeSizeBytes = n
+	cfg, err := config.Load(flag.CommandLine, args, os.Environ())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+		return 2
 	}
-
-	loglvVal, err := level.Parse(cfg.loglv) // TODO test log level is working OR not
+	if explain && flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "explain needs exactly one path, got: %v\n", flag.Args())
+		flag.Usage()
+		return 2
+	}
+	if !explain && (flag.NArg() > 1 || (flag.NArg() == 1 && !*once)) {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %v\n", flag.Args())
+		flag.Usage()
+		return 2
+	}
+	err = cfg.Validate()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to parse log level: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+		return 1
+	}
+
+	partialExts := cfg.PartialExts
+	if len(partialExts) == 0 {
+		partialExts = parser.DefaultPartialExts
+	}
+	statMovieDirs, statTvDirs := configStatDirs(cfg)
+	statLargeMovieSize, _ := utils.SizeStringToBytesNum(cfg.StatLargeMovieSize) // checked by Validate
+	statLargeTvEpisodeSize, _ := utils.SizeStringToBytesNum(cfg.StatLargeEpisodeSize)
+	recovery, _ := disk.ParseRecoveryPolicy(cfg.JournalRecovery)
+
+	loglvVal, _ := level.Parse(cfg.LogLevel)
+	logger := aslog.New(&aslog.Config{
+		Level: &aslog.AllowedLevel{
+			LevelOpt: level.Allow(loglvVal),
+		},
+	})
+	if cfg.File != "" {
+		level.Info(logger).Log("msg", "config file loaded", "file", cfg.File)
 	}
-	cfg.aslogConfig.Level = &aslog.AllowedLevel{
-		LevelOpt: level.Allow(loglvVal),
+
+	err = plugin.Register(cfg.Plugins)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to register plugins: %v\n", err)
+		return 1
 	}
-	logger := aslog.New(&cfg.aslogConfig)
+	defer closePlugins(logger)
 
 	parserMgr, err := parser.NewParserMgr(&parser.ParserMgrOpts{
 		Logger:         log.With(logger, "component", "parsermgr"),
-		ConfigDir:      cfg.parserConfigDir,
-		EnableParsers:  cfg.enableParsers,
-		DisableParsers: cfg.disableParsers,
+		ConfigDir:      cfg.ParserConfDir,
+		DataDir:        cfg.DataDir,
+		EnableParsers:  cfg.EnableParsers,
+		DisableParsers: cfg.DisableParsers,
 	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to create parser manager: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
 
 	if tmdbService, err := tmdb.NewTmdbService(&tmdb.Configuration{
 		Logger:        logger,
-		Sock5Proxy:    cfg.tmdbProxy,
-		ValidCacheDur: cfg.tmdbCacheDur,
+		Sock5Proxy:    cfg.TmdbSock5Proxy,
+		ValidCacheDur: cfg.TmdbCacheDur,
+		RateLimit:     cfg.TmdbRateLimit,
 	}); err != nil {
 		fmt.Fprintf(os.Stderr, "failed to create tmdb service: %v\n", err)
-		os.Exit(1)
+		return 1
 	} else {
 		parser.RegisterTmdbService(tmdbService)
 	}
 
+	identify.SetOpts(identify.Opts{
+		MinScore: cfg.MatchMinScore,
+		Margin:   cfg.MatchMargin,
+	})
+
 	if diskService, err := disk.NewDiskService(&disk.DiskServiceOpts{
 		Logger:         log.With(logger, "component", "disk"),
-		DryRunModeOpen: cfg.dryRun,
+		DryRunModeOpen: cfg.DryRun || explain,
+		JournalDir:     journalDir(cfg.DataDir),
 	}); err != nil {
 		fmt.Fprintf(os.Stderr, "failed to create disk service: %v\n", err)
-		os.Exit(1)
+		return 1
 	} else {
 		parser.RegisterDiskService(diskService)
 	}
 
+	scanDirs, scanDirOpts := configScanDirs(cfg)
 	parserMgrRunOpts := &parser.ParserMgrRunOpts{
-		ScanDirs: cfg.parserDirs,
+		ScanDirs:    scanDirs,
+		ScanDirOpts: scanDirOpts,
 		MediaTypeDirs: map[common.MediaType]string{
-			common.MediaTypeMovie: cfg.parserTargetMovieDir,
-			common.MediaTypeTv:    cfg.parserTargetTvDir,
-			common.MediaTypeTrash: cfg.parserTargetTrash,
+			common.MediaTypeMovie: cfg.DestMovieOnAirDir,
+			common.MediaTypeTv:    cfg.DestTvOnAirDir,
+			common.MediaTypeTrash: cfg.TrashDir,
+		},
+		SleepDurScan:  cfg.ScanInterval,
+		SleepDurParse: cfg.ParseSleep,
+		Workers:       cfg.Workers,
+		Watch:         cfg.Watch,
+		WatchDebounce: cfg.WatchDebounce,
+		Settle: parser.SettleOpts{
+			Dur:         cfg.SettleDur,
+			TwoScans:    cfg.SettleTwoScans,
+			PartialExts: partialExts,
 		},
-		SleepDurScan:  cfg.parserScanDur,
-		SleepDurParse: cfg.parserParseDur,
+		DryRun:   cfg.DryRun,
+		Recovery: recovery,
 	}
 
-	var wg sync.WaitGroup
-	if cfg.enableStat {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if explain {
+		return runExplain(parserMgr, parserMgrRunOpts, flag.Arg(0))
+	}
+	if *once {
+		return runOnce(ctx, parserMgr, parserMgrRunOpts, flag.Arg(0))
+	}
+
+	var statTask *stat.Stat
+	if cfg.EnableStat {
 		statOpts := &stat.StatOpts{
 			Logger:             log.With(logger, "component", "stat"),
-			Interval:           cfg.statInterval,
-			InitWait:           cfg.statInitWait,
-			MovieDirs:          cfg.statMovieDirs,
-			TvDirs:             cfg.statTvDirs,
-			LargeMovieSize:     cfg.statLargeMovieSizeBytes,
-			LargeTvEpisodeSize: cfg.statLargeTvEpisodeSizeBytes,
+			Interval:           cfg.StatInterval,
+			InitWait:           cfg.StatInitWait,
+			MovieDirs:          statMovieDirs,
+			TvDirs:             statTvDirs,
+			LargeMovieSize:     statLargeMovieSize,
+			LargeTvEpisodeSize: statLargeTvEpisodeSize,
 		}
-		stat, err := stat.NewStat(statOpts)
+		statTask, err = stat.NewStat(statOpts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to create stat: %v\n", err)
-			os.Exit(1)
+			return 1
 		}
+	}
+	var adminServer *http.Server
+	if cfg.AdminAddr != "" {
+		adminOpts := &admin.Opts{
+			Logger:    log.With(logger, "component", "admin"),
+			Addr:      cfg.AdminAddr,
+			Token:     cfg.AdminToken,
+			ParserMgr: parserMgr,
+			Extra:     parserMgr.ReviewHandler(),
+		}
+		if statTask != nil {
+			adminOpts.Stat = statTask // a nil *stat.Stat must not become a non nil interface
+		}
+		adminServer, err = admin.NewServer(adminOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create admin api: %v\n", err)
+			return 1
+		}
+	}
+
+	// a failed task cancels ctx, so the others shut down and deferred cleanups run before exiting
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	fatalErrs := make(chan error, 4)
+	fatal := func(err error) {
+		fatalErrs <- err
+		cancel()
+	}
+	var wg sync.WaitGroup
+	if statTask != nil {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			err = stat.Run()
+			err := statTask.Run(ctx)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "failed to run stat: %v\n", err)
-				os.Exit(1)
+				fatal(fmt.Errorf("failed to run stat: %v", err))
 			}
 		}()
 	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		err = parserMgr.RunParsers(parserMgrRunOpts)
+		err := parserMgr.RunParsers(ctx, parserMgrRunOpts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to run parsers: %v\n", err)
-			os.Exit(1)
+			fatal(fmt.Errorf("failed to run parsers: %v", err))
 		}
 	}()
-	if cfg.enablePrometheusHTTP {
+	go reloadOnSighup(ctx, logger, parserMgr)
+	if cfg.WatchConfig {
 		go func() {
-			initPrometheusHTTP()
-			err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.prometheusPort), nil)
+			err := parserMgr.WatchConfigs(ctx)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "failed to run prometheus http: %v\n", err)
-				os.Exit(1)
+				level.Error(logger).Log("msg", "failed to watch parser configs, use SIGHUP to reload", "err", err)
 			}
 		}()
 	}
-	wg.Wait()
+	var httpServers []*http.Server
+	if cfg.EnablePrometheus {
+		initPrometheusHTTP()
+		httpServer := &http.Server{Addr: fmt.Sprintf(":%d", cfg.PrometheusPort)}
+		httpServers = append(httpServers, httpServer)
+		go serveHTTP(httpServer, "prometheus", fatal)
+	}
+	if adminServer != nil {
+		httpServers = append(httpServers, adminServer)
+		go serveHTTP(adminServer, "admin", fatal)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
+	stop() // a second signal kills the process immediately
+	level.Info(logger).Log("msg", "shutting down, waiting for in-flight tasks")
+	for _, httpServer := range httpServers {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		err := httpServer.Shutdown(shutdownCtx)
+		cancel()
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to shutdown http server", "addr", httpServer.Addr, "err", err)
+		}
+	}
+	<-done
+	level.Info(logger).Log("msg", "shutdown done")
+	select {
+	case err := <-fatalErrs:
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	default:
+		return 0
+	}
+}
+
+const (
+	httpShutdownTimeout = 5 * time.Second
+)
+
+// runOnce runs a single scan pass and prints the summary, returns the exit code
+func runOnce(ctx context.Context, parserMgr *parser.ParserMgr, opts *parser.ParserMgrRunOpts, path string) int {
+	summary, err := parserMgr.RunOnce(ctx, opts, path)
+	if summary != nil {
+		fmt.Print(summary)
+	}
+	if errors.Is(err, parser.ErrDataDirLocked) {
+		fmt.Fprintf(os.Stderr, "failed to run once: %v, use the admin api to retry entries of a running daemon\n", err)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to run once: %v\n", err)
+		return 1
+	}
+	if summary.Count(parser.EntryFailed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runExplain prints how every enabled parser handles the entry at path, nothing is run, returns the exit code
+func runExplain(parserMgr *parser.ParserMgr, opts *parser.ParserMgrRunOpts, path string) int {
+	explanation, err := parserMgr.Explain(opts, path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to explain: %v\n", err)
+		return 1
+	}
+	fmt.Print(explanation)
+	return 0
+}
+
+// journalDir returns the journal dir in dataDir, empty if dataDir is empty
+func journalDir(dataDir string) string {
+	if dataDir == "" {
+		return ""
+	}
+	return filepath.Join(dataDir, "journal")
+}
+
+func appendIfMissing(dirs []string, dir string) []string {
+	for _, d := range dirs {
+		if d == dir {
+			return dirs
+		}
+	}
+	return append(dirs, dir)
+}
+
+// closePlugins stops persistent plugin parsers
+func closePlugins(logger log.Logger) {
+	for name, p := range parser.RegisteredParsers {
+		closer, ok := p.(io.Closer)
+		if !ok {
+			continue
+		}
+		err := closer.Close()
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to close parser", "parser", name, "err", err)
+		}
+	}
+}
+
+// serveHTTP runs server until it is shut down, any other error is passed to fatal
+func serveHTTP(server *http.Server, name string, fatal func(error)) {
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal(fmt.Errorf("failed to run %s http: %v", name, err))
+	}
 }
 
 func initPrometheusHTTP() {
 	http.Handle("/metrics", promhttp.Handler())
 }
+
+// reloadOnSighup reloads parser configs on every SIGHUP until ctx is done
+func reloadOnSighup(ctx context.Context, logger log.Logger, parserMgr *parser.ParserMgr) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			level.Info(logger).Log("msg", "SIGHUP received, reloading parser configs")
+			err := parserMgr.ReloadConfigs()
+			if err != nil {
+				level.Error(logger).Log("msg", "failed to reload some parser configs", "err", err)
+			}
+		}
+	}
+}
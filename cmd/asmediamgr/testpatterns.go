@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"asmediamgr/pkg/dirinfo"
+	"asmediamgr/pkg/parser"
+	"asmediamgr/pkg/parser/fakes"
+	"asmediamgr/pkg/utils"
+)
+
+// runTestPatterns runs the testpatterns subcommand, it runs names through the patterns of a parser config offline,
+// tmdb is answered by a fixture file, returns the exit code, non-zero if any result differs from the expected file
+func runTestPatterns(args []string) int {
+	fs := flag.NewFlagSet("testpatterns", flag.ContinueOnError)
+	parserName := fs.String("parser", "", "parser to test, such as tvepfile")
+	cfgPath := fs.String("config", "", "parser config file, defaults to parsercfg/<parser>.toml")
+	fixture := fs.String("tmdbfixture", "", "JSON file of recorded tmdb responses, empty means every tmdb request fails")
+	expect := fs.String("expect", "", "expected results file, in the same format as the output")
+	fileSize := fs.String("filesize", "10G", "size of every test file, so size limits of patterns are passed")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s testpatterns -parser name [-config file] [-tmdbfixture file] [-expect file] names.txt\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "each line of names.txt is a file name, or dir/file to test dir parsers, files of a dir are listed one per line\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *parserName == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if *cfgPath == "" {
+		*cfgPath = filepath.Join("parsercfg", *parserName+".toml")
+	}
+	size, err := utils.SizeStringToBytesNum(*fileSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid filesize: %v\n", err)
+		return 2
+	}
+	p, ok := parser.RegisteredParsers[*parserName]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown parser %s\n", *parserName)
+		return 2
+	}
+	if _, err := os.Stat(*cfgPath); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to stat config: %v\n", err) // Init of most parsers treats a missing config as no patterns
+		return 1
+	}
+	logger := level.NewFilter(log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr)), level.AllowWarn())
+	if _, err := p.Init(*cfgPath, logger); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to init parser %s: %v\n", *parserName, err)
+		return 1
+	}
+	tmdbService := fakes.NewFakeTmdbService()
+	if *fixture != "" {
+		tmdbService, err = fakes.LoadFakeTmdbService(*fixture)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load tmdb fixture: %v\n", err)
+			return 1
+		}
+	}
+	parser.RegisterTmdbService(tmdbService)
+	names, err := readLines(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read names: %v\n", err)
+		return 1
+	}
+	var results []*patternResult
+	for _, entry := range testEntries(names, size) {
+		result := testPattern(p, entry)
+		fmt.Println(result)
+		results = append(results, result)
+	}
+	if *expect == "" {
+		return 0
+	}
+	expectLines, err := readLines(*expect)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read expected results: %v\n", err)
+		return 1
+	}
+	diffs := diffPatternResults(results, expectLines)
+	for _, diff := range diffs {
+		fmt.Fprintln(os.Stderr, diff)
+	}
+	if len(diffs) > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d differ from %s\n", len(diffs), len(results), *expect)
+		return 1
+	}
+	return 0
+}
+
+// patternResult is what a parser extracted from an entry, printed as a tab separated line: entry, groups and outcome
+type patternResult struct {
+	entry   string
+	groups  string // named groups of all matched patterns, sorted by name
+	outcome string // "no match", "error: ..." or the ops of the plan
+}
+
+func (r *patternResult) String() string {
+	return r.entry + "\t" + r.groups + "\t" + r.outcome
+}
+
+// readLines returns lines of path, blank lines and lines starting with # are skipped
+func readLines(filePath string) ([]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("Open() error = %v", err)
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Scan() error = %v", err)
+	}
+	return lines, nil
+}
+
+// testEntries builds entries of names without touching the disk, "dir/file" names are files of dir entry "dir",
+// entries are in the order of their first name, they are in scan dir "scan" and every file is of size
+func testEntries(names []string, size int64) []*dirinfo.Entry {
+	type entryName struct {
+		name  string
+		isDir bool
+	}
+	var order []entryName
+	dirFiles := make(map[string][]string)
+	for _, name := range names {
+		dir, rel, isDir := strings.Cut(filepath.ToSlash(name), "/")
+		if !isDir || rel == "" {
+			order = append(order, entryName{name: dir})
+			continue
+		}
+		if _, ok := dirFiles[dir]; !ok {
+			order = append(order, entryName{name: dir, isDir: true})
+		}
+		dirFiles[dir] = append(dirFiles[dir], rel)
+	}
+	var entries []*dirinfo.Entry
+	for _, en := range order {
+		entry := fakes.FileEntry(en.name)
+		if en.isDir {
+			entry = fakes.DirEntry(en.name, dirFiles[en.name]...)
+		}
+		for _, file := range entry.FileList {
+			file.BytesNum = size
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// testPattern runs p on entry, its plan is neither validated nor run, as the files do not exist
+func testPattern(p parser.Parserable, entry *dirinfo.Entry) (result *patternResult) {
+	trace := &parser.Trace{}
+	opts := &parser.ParserMgrRunOpts{
+		MediaTypeDirs: fakes.MediaTypeDirs(),
+		DryRun:        true,
+		Trace:         trace,
+	}
+	result = &patternResult{entry: entry.Name()}
+	defer func() {
+		if r := recover(); r != nil {
+			result.outcome = fmt.Sprintf("error: panic: %v", r)
+		}
+		result.groups = formatGroups(trace.Groups())
+	}()
+	plan, err := p.Parse(entry, opts)
+	switch {
+	case err != nil:
+		result.outcome = "error: " + err.Error()
+	case plan == nil:
+		result.outcome = "no match"
+	default:
+		var ops []string
+		for _, op := range plan.Ops {
+			ops = append(ops, filepath.ToSlash(op.String()))
+		}
+		result.outcome = strings.Join(ops, "; ")
+	}
+	return result
+}
+
+func formatGroups(groups map[string]string) string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var ret []string
+	for _, name := range names {
+		ret = append(ret, fmt.Sprintf("%s=%q", name, groups[name]))
+	}
+	return strings.Join(ret, " ")
+}
+
+// diffPatternResults compares results with expected lines, matched by entry, entries missing on either side are differences
+func diffPatternResults(results []*patternResult, expectLines []string) []string {
+	expected := make(map[string]string)
+	var order []string
+	for _, line := range expectLines {
+		entry := strings.SplitN(line, "\t", 2)[0]
+		if _, ok := expected[entry]; !ok {
+			order = append(order, entry)
+		}
+		expected[entry] = line
+	}
+	var diffs []string
+	seen := make(map[string]bool)
+	for _, result := range results {
+		seen[result.entry] = true
+		want, ok := expected[result.entry]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: not in expected results\n  got:  %s", result.entry, result))
+			continue
+		}
+		if got := result.String(); got != want {
+			diffs = append(diffs, fmt.Sprintf("%s: differs\n  want: %s\n  got:  %s", result.entry, want, got))
+		}
+	}
+	for _, entry := range order {
+		if !seen[entry] {
+			diffs = append(diffs, fmt.Sprintf("%s: expected but not in names", entry))
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"asmediamgr/pkg/dirinfo"
+)
+
+func TestTestEntries(t *testing.T) {
+	entries := testEntries([]string{"a.mkv", "Show/01.mkv", "b.mp4", "Show/sub/01.ass"}, 100)
+	if len(entries) != 3 {
+		t.Fatalf("testEntries() got %d entries, want 3", len(entries))
+	}
+	if entries[0].Type != dirinfo.FileEntry || entries[0].Name() != "a.mkv" || entries[0].FileList[0].Ext != ".mkv" {
+		t.Errorf("testEntries() file entry got = %+v", entries[0])
+	}
+	show := entries[1]
+	if show.Type != dirinfo.DirEntry || show.Name() != "Show" || len(show.FileList) != 2 {
+		t.Fatalf("testEntries() dir entry got = %+v", show)
+	}
+	sub := show.FileList[1]
+	if sub.RelPathToMother != "Show/sub/01.ass" || sub.Name != "01.ass" || sub.Ext != ".ass" || sub.BytesNum != 100 {
+		t.Errorf("testEntries() dir file got = %+v", sub)
+	}
+	if entries[2].Name() != "b.mp4" {
+		t.Errorf("testEntries() entries should keep the order of names, got = %s", entries[2].Name())
+	}
+}
+
+func TestDiffPatternResults(t *testing.T) {
+	results := []*patternResult{
+		{entry: "a", groups: `name="A"`, outcome: "no match"},
+		{entry: "b", outcome: "no match"},
+		{entry: "c", outcome: "no match"},
+	}
+	expectLines := []string{
+		"a\tname=\"A\"\tno match",
+		"b\t\terror: x",
+		"d\t\tno match",
+	}
+	diffs := diffPatternResults(results, expectLines)
+	if len(diffs) != 3 {
+		t.Fatalf("diffPatternResults() got = %v, want diffs of b, c and d", diffs)
+	}
+	if len(diffPatternResults(results[:1], expectLines[:1])) != 0 {
+		t.Errorf("diffPatternResults() same results should have no diff")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"asmediamgr/pkg/config"
+	"asmediamgr/pkg/disk"
+)
+
+// runUndo runs the undo subcommand, it reverts disk ops recorded in the audit log, returns the exit code
+// every selected op is checked before any is reverted, so a changed destination refuses the whole undo
+// the audit log is in the data dir of the config, loaded the same way as run
+func runUndo(args []string) int {
+	fs := flag.NewFlagSet("undo", flag.ContinueOnError)
+	batch := fs.String("batch", "", "revert ops of a batch")
+	entry := fs.String("entry", "", "revert ops of an entry name")
+	since := fs.String("since", "", "revert ops since a time, RFC3339 or a duration ago such as 2h")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s undo [-batch id] [-entry name] [-since time] [-dryrun] [config flags]\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	cfg, err := config.Load(fs, args, os.Environ())
+	if err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+		}
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %v\n", fs.Args())
+		return 2
+	}
+	filter := disk.UndoFilter{Batch: *batch, Entry: *entry}
+	if *since != "" {
+		t, err := parseSince(*since, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid since: %v\n", err)
+			return 2
+		}
+		filter.Since = t
+	}
+	auditLog := disk.NewAuditLog(filepath.Join(cfg.DataDir, disk.AuditFileName))
+	records, err := disk.ReadAuditLog(auditLog.Path())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read audit log: %v\n", err)
+		return 1
+	}
+	selected, err := disk.SelectUndo(records, filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		fs.Usage()
+		return 2
+	}
+	if len(selected) == 0 {
+		fmt.Println("nothing to undo")
+		return 0
+	}
+	refused := false
+	for _, rec := range selected {
+		fmt.Printf("[%s] %s: %s -> %s\n", rec.Batch, rec.Op, rec.NewPath, rec.OldPath)
+		if err := disk.CheckUndo(rec); err != nil {
+			fmt.Fprintf(os.Stderr, "  refused: %v\n", err)
+			refused = true
+		}
+	}
+	if refused {
+		fmt.Fprintf(os.Stderr, "undo refused, nothing reverted\n")
+		return 1
+	}
+	if cfg.DryRun {
+		return 0
+	}
+	for _, rec := range selected {
+		undone, err := disk.Undo(rec, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to undo %s, stopped: %v\n", rec.NewPath, err)
+			return 1
+		}
+		err = auditLog.Append(undone)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to record undo of %s, stopped: %v\n", rec.NewPath, err)
+			return 1
+		}
+	}
+	fmt.Printf("%d ops reverted, add an override before the entries are scanned again\n", len(selected))
+	return 0
+}
+
+// parseSince parses an RFC3339 time, or a duration before now
+func parseSince(str string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(str); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, str)
+}
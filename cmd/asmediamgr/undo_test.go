@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"asmediamgr/pkg/disk"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	tests := []struct {
+		str     string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2h", now.Add(-2 * time.Hour), false},
+		{"2024-01-01T00:00:00Z", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), false},
+		{"yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSince(tt.str, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSince(%s) error = %v, wantErr %v", tt.str, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseSince(%s) got = %v, want = %v", tt.str, got, tt.want)
+		}
+	}
+}
+
+func TestRunUndoDataDirFromEnv(t *testing.T) {
+	dataDir := t.TempDir()
+	auditLog := disk.NewAuditLog(filepath.Join(dataDir, disk.AuditFileName))
+	err := auditLog.Append(&disk.AuditRecord{
+		Time:    time.Now(),
+		Batch:   "b",
+		Op:      "rename movie",
+		OldPath: filepath.Join(dataDir, "old.mkv"),
+		NewPath: filepath.Join(dataDir, "missing.mkv"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ASMEDIAMGR_DATA_DIR", dataDir)
+	// the new path is missing, so the record found in the data dir refuses the undo
+	if code := runUndo([]string{"-batch", "b", "-dryrun"}); code != 1 {
+		t.Fatalf("runUndo() got = %d, want = 1", code)
+	}
+}
@@ -0,0 +1,200 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"asmediamgr/pkg/parser"
+)
+
+// ParserMgr is the part of parser manager controlled by the admin api
+type ParserMgr interface {
+	ScanDirStates() []*parser.ScanDirState
+	RetryEntry(scanDir, entryName string) error
+	ResetBackoff(scanDir, entryName string) error
+	PauseScanDir(scanDir string) error
+	ResumeScanDir(scanDir string) error
+}
+
+// Stat is the part of stat controlled by the admin api
+type Stat interface {
+	RunNow() bool
+}
+
+// Opts is the options to create the admin api handler
+type Opts struct {
+	Logger    log.Logger
+	Addr      string       // bind address, such as 127.0.0.1:12201
+	Token     string       // bearer token required by every request, empty means no auth
+	ParserMgr ParserMgr    // required
+	Stat      Stat         // nil if stat is disabled
+	Extra     http.Handler // optional, serves paths not handled by the admin api, auth still applies
+}
+
+// NewServer creates the http server of the admin api, the caller runs and shuts it down
+func NewServer(opts *Opts) (*http.Server, error) {
+	if opts.Addr == "" {
+		return nil, fmt.Errorf("no bind address")
+	}
+	handler, err := NewHandler(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Token == "" && !isLoopback(opts.Addr) {
+		level.Warn(opts.Logger).Log("msg", "admin api has no token but is not bound to loopback", "addr", opts.Addr)
+	}
+	return &http.Server{Addr: opts.Addr, Handler: handler}, nil
+}
+
+// NewHandler creates the admin api handler
+//
+//	GET  /api/scandirs                              lists scan dirs and backoff state of entries
+//	POST /api/scandirs/retry?scan_dir=&entry=       resets backoff of the entry and runs it right away
+//	POST /api/scandirs/reset?scan_dir=&entry=       resets backoff of the entry, it is run at the next scan
+//	POST /api/scandirs/pause?scan_dir=              stops running entries of the scan dir
+//	POST /api/scandirs/resume?scan_dir=             resumes the scan dir and scans it right away
+//	POST /api/stat/run                              runs a stat task right away
+func NewHandler(opts *Opts) (http.Handler, error) {
+	if opts.ParserMgr == nil {
+		return nil, fmt.Errorf("no parser manager")
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.NewNopLogger()
+	}
+	a := &admin{
+		logger:    opts.Logger,
+		token:     opts.Token,
+		parserMgr: opts.ParserMgr,
+		stat:      opts.Stat,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/scandirs", a.handleScanDirs)
+	mux.HandleFunc("/api/scandirs/retry", a.entryAction(opts.ParserMgr.RetryEntry))
+	mux.HandleFunc("/api/scandirs/reset", a.entryAction(opts.ParserMgr.ResetBackoff))
+	mux.HandleFunc("/api/scandirs/pause", a.scanDirAction(opts.ParserMgr.PauseScanDir))
+	mux.HandleFunc("/api/scandirs/resume", a.scanDirAction(opts.ParserMgr.ResumeScanDir))
+	mux.HandleFunc("/api/stat/run", a.handleStatRun)
+	if opts.Extra != nil {
+		mux.Handle("/", opts.Extra)
+	}
+	return a.auth(mux), nil
+}
+
+type admin struct {
+	logger    log.Logger
+	token     string
+	parserMgr ParserMgr
+	stat      Stat
+}
+
+// auth checks the bearer token of every request if a token is set
+func (a *admin) auth(next http.Handler) http.Handler {
+	if a.token == "" {
+		return next
+	}
+	want := []byte("Bearer " + a.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *admin) handleScanDirs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.parserMgr.ScanDirStates())
+}
+
+func (a *admin) entryAction(action func(scanDir, entryName string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		scanDir, entryName := r.URL.Query().Get("scan_dir"), r.URL.Query().Get("entry")
+		if scanDir == "" || entryName == "" {
+			http.Error(w, "scan_dir and entry are required", http.StatusBadRequest)
+			return
+		}
+		a.respond(w, r, action(scanDir, entryName))
+	}
+}
+
+func (a *admin) scanDirAction(action func(scanDir string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		scanDir := r.URL.Query().Get("scan_dir")
+		if scanDir == "" {
+			http.Error(w, "scan_dir is required", http.StatusBadRequest)
+			return
+		}
+		a.respond(w, r, action(scanDir))
+	}
+}
+
+func (a *admin) handleStatRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.stat == nil {
+		http.Error(w, "stat disabled", http.StatusNotFound)
+		return
+	}
+	queued := a.stat.RunNow()
+	level.Info(a.logger).Log("msg", "admin request", "path", r.URL.Path, "queued", queued)
+	writeJSON(w, http.StatusAccepted, struct {
+		Queued bool `json:"queued"` // false means a stat task is already pending
+	}{queued})
+}
+
+// respond maps the result of a parser manager action to the http status
+func (a *admin) respond(w http.ResponseWriter, r *http.Request, err error) {
+	level.Info(a.logger).Log("msg", "admin request", "path", r.URL.Path, "query", r.URL.RawQuery, "err", err)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusAccepted, struct{}{})
+	case errors.Is(err, parser.ErrScanDirNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, parser.ErrScanDirPaused), errors.Is(err, parser.ErrScanDirBusy):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		fmt.Fprintf(w, "encode error: %v", err)
+	}
+}
+
+// isLoopback returns true if addr only listens on loopback
+func isLoopback(addr string) bool {
+	host := addr
+	if i := strings.LastIndex(addr, ":"); i >= 0 {
+		host = addr[:i]
+	}
+	host = strings.Trim(host, "[]")
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
@@ -0,0 +1,114 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"asmediamgr/pkg/parser"
+)
+
+type fakeParserMgr struct {
+	paused map[string]bool
+	reset  []string
+}
+
+func (f *fakeParserMgr) ScanDirStates() []*parser.ScanDirState {
+	return []*parser.ScanDirState{{ScanDir: "downloads", Paused: f.paused["downloads"]}}
+}
+
+func (f *fakeParserMgr) RetryEntry(scanDir, entryName string) error {
+	if scanDir != "downloads" {
+		return parser.ErrScanDirNotFound
+	}
+	if f.paused[scanDir] {
+		return parser.ErrScanDirPaused
+	}
+	return nil
+}
+
+func (f *fakeParserMgr) ResetBackoff(scanDir, entryName string) error {
+	f.reset = append(f.reset, entryName)
+	return nil
+}
+
+func (f *fakeParserMgr) PauseScanDir(scanDir string) error {
+	f.paused[scanDir] = true
+	return nil
+}
+
+func (f *fakeParserMgr) ResumeScanDir(scanDir string) error {
+	f.paused[scanDir] = false
+	return nil
+}
+
+type fakeStat struct {
+	pending bool
+}
+
+func (f *fakeStat) RunNow() bool {
+	if f.pending {
+		return false
+	}
+	f.pending = true
+	return true
+}
+
+func TestHandler(t *testing.T) {
+	pm := &fakeParserMgr{paused: make(map[string]bool)}
+	handler, err := NewHandler(&Opts{Token: "secret", ParserMgr: pm, Stat: &fakeStat{}})
+	if err != nil {
+		t.Fatalf("NewHandler() error = %v", err)
+	}
+	tests := []struct {
+		method string
+		target string
+		token  string
+		want   int
+	}{
+		{http.MethodGet, "/api/scandirs", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/scandirs", "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/api/scandirs", "secret", http.StatusOK},
+		{http.MethodGet, "/api/scandirs/retry?scan_dir=downloads&entry=a", "secret", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/scandirs/retry?scan_dir=downloads", "secret", http.StatusBadRequest},
+		{http.MethodPost, "/api/scandirs/retry?scan_dir=other&entry=a", "secret", http.StatusNotFound},
+		{http.MethodPost, "/api/scandirs/retry?scan_dir=downloads&entry=a", "secret", http.StatusAccepted},
+		{http.MethodPost, "/api/scandirs/reset?scan_dir=downloads&entry=a", "secret", http.StatusAccepted},
+		{http.MethodPost, "/api/scandirs/pause?scan_dir=downloads", "secret", http.StatusAccepted},
+		{http.MethodPost, "/api/scandirs/retry?scan_dir=downloads&entry=a", "secret", http.StatusConflict},
+		{http.MethodPost, "/api/scandirs/resume?scan_dir=downloads", "secret", http.StatusAccepted},
+		{http.MethodPost, "/api/stat/run", "secret", http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s got = %d, want = %d, body = %s", tt.method, tt.target, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+	if len(pm.reset) != 1 || pm.reset[0] != "a" {
+		t.Errorf("ResetBackoff() got = %v", pm.reset)
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1:12201", true},
+		{"localhost:12201", true},
+		{"[::1]:12201", true},
+		{":12201", false},
+		{"0.0.0.0:12201", false},
+	}
+	for _, tt := range tests {
+		if got := isLoopback(tt.addr); got != tt.want {
+			t.Errorf("isLoopback(%s) got = %v, want = %v", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package common
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -25,32 +28,124 @@ func ParseTmdbDateStr(tmdbDateTimeStr string) (dt *DateTime, err error) {
 	return dt, nil
 }
 
-// ChineseToNum converts Chinese number to Arabic number
-// Notes: only support 0-9
+var (
+	chineseDigits = map[rune]int{
+		'零': 0, '〇': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9,
+	}
+	chineseUnits = map[rune]int{'十': 10, '百': 100, '千': 1000}
+)
+
+// digitOf returns the value of a Chinese, full-width or Arabic digit
+func digitOf(r rune) (int, bool) {
+	switch {
+	case r >= '0' && r <= '9':
+		return int(r - '0'), true
+	case r >= '０' && r <= '９':
+		return int(r - '０'), true
+	}
+	d, ok := chineseDigits[r]
+	return d, ok
+}
+
+// ChineseToNum converts Chinese number to Arabic number, such as 十二, 二十三, 一百零五, 两千 or 第１２集's １２
+// digits without units are read one by one, such as 二〇二三 and １２, Arabic digits are accepted as well
 func ChineseToNum(chnStr string) (num int, ok bool) {
-	switch chnStr {
-	case "零":
-		num = 0
-	case "一":
-		num = 1
-	case "二":
-		num = 2
-	case "三":
-		num = 3
-	case "四":
-		num = 4
-	case "五":
-		num = 5
-	case "六":
-		num = 6
-	case "七":
-		num = 7
-	case "八":
-		num = 8
-	case "九":
-		num = 9
-	default:
-		num = -1
-	}
-	return num, num >= 0
+	runes := []rune(chnStr)
+	if len(runes) == 0 {
+		return -1, false
+	}
+	hasUnit := false
+	for _, r := range runes {
+		if _, ok := chineseUnits[r]; ok {
+			hasUnit = true
+			break
+		}
+	}
+	if !hasUnit {
+		for _, r := range runes {
+			d, ok := digitOf(r)
+			if !ok {
+				return -1, false
+			}
+			num = num*10 + d
+		}
+		return num, true
+	}
+	// digit is the pending digit before a unit, -1 if none, lastUnit keeps units descending
+	digit, lastUnit := -1, 10000
+	for _, r := range runes {
+		if unit, ok := chineseUnits[r]; ok {
+			if unit >= lastUnit {
+				return -1, false
+			}
+			if digit < 0 {
+				if unit != 10 {
+					return -1, false
+				}
+				digit = 1 // 十二 is 12, 一百十 is 110
+			}
+			num += digit * unit
+			digit, lastUnit = -1, unit
+			continue
+		}
+		d, ok := digitOf(r)
+		if !ok || digit > 0 {
+			return -1, false
+		}
+		if d == 0 {
+			continue // 一百零五, the zero only marks a skipped unit
+		}
+		digit = d
+	}
+	if digit > 0 {
+		num += digit
+	}
+	return num, true
+}
+
+// SleepContext sleeps for d, or returns early when ctx is done
+// returns false if ctx is done before d elapsed
+func SleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// CopyUrlOptions returns a copy of tmdb url options, so shared defaults are never modified
+func CopyUrlOptions(urlOptions map[string]string) map[string]string {
+	ret := make(map[string]string, len(urlOptions))
+	for k, v := range urlOptions {
+		ret[k] = v
+	}
+	return ret
+}
+
+// WriteFileAtomic writes content to path by writing a synced temp file in the same dir and renaming it,
+// so path is either the old content or the new content, even if the process crashes
+func WriteFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("CreateTemp() error = %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write temp file error = %v", err)
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("Rename() error = %v", err)
+	}
+	return nil
 }
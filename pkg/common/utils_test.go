@@ -1,7 +1,9 @@
 package common
 
 import (
+	"context"
 	"testing"
+	"time"
 )
 
 func TestParserTmdbDateStr(t *testing.T) {
@@ -96,6 +98,25 @@ func TestChineseToNum(t *testing.T) {
 			expected: 9,
 			ok:       true,
 		},
+		{"〇", 0, true},
+		{"两", 2, true},
+		{"十", 10, true},
+		{"十二", 12, true},
+		{"二十", 20, true},
+		{"二十三", 23, true},
+		{"一百", 100, true},
+		{"一百零五", 105, true},
+		{"一百十", 110, true},
+		{"三百二十一", 321, true},
+		{"两千零二十四", 2024, true},
+		{"二〇二三", 2023, true},
+		{"１２", 12, true},
+		{"12", 12, true},
+		{"", -1, false},
+		{"十百", -1, false},
+		{"百", -1, false},
+		{"二三十", -1, false},
+		{"第二", -1, false},
 	}
 	for _, tt := range tests {
 		num, ok := ChineseToNum(tt.chnStr)
@@ -104,3 +125,18 @@ func TestChineseToNum(t *testing.T) {
 		}
 	}
 }
+
+func TestSleepContext(t *testing.T) {
+	if !SleepContext(context.Background(), time.Millisecond) {
+		t.Fatalf("SleepContext() got = false, want = true")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if SleepContext(ctx, time.Hour) {
+		t.Fatalf("SleepContext() got = true, want = false")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("SleepContext() should return early when ctx is done")
+	}
+}
@@ -1,24 +1,76 @@
 package config
 
 import (
+	"fmt"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
+
+	"asmediamgr/pkg/identify"
+)
+
+const (
+	// DefaultConfigFile is the config file loaded if no other is given, it may be missing
+	DefaultConfigFile = "config.toml"
+	// EnvPrefix is the prefix of environment variables, the rest is the upper case config key, such as ASMEDIAMGR_DATA_DIR
+	EnvPrefix = "ASMEDIAMGR_"
 )
 
+// Configuration is the whole configuration of the program, layered from defaults, the config file,
+// environment variables and flags, each layer overrides the former
 type Configuration struct {
-	ServiceConfDir    string       `toml:"service_conf_dir"`
-	ParserConfDir     string       `toml:"parser_conf_dir"`
-	TmdbSock5Proxy    string       `toml:"tmdb_sock5_proxy"`
-	DestTvOnAirDir    string       `toml:"dest_tv_on_air_dir"`
-	DestMovieOnAirDir string       `toml:"dest_movie_on_air_dir"`
-	MotherDirs        []MontherDir `toml:"mother_dirs"`
-	StatDirs          []StatDir    `toml:"stat_dirs"`
+	File string `toml:"-"` // config file loaded, empty if none
+
+	ServiceConfDir       string        `toml:"service_conf_dir"` // unused, kept so old config files still load
+	ParserConfDir        string        `toml:"parser_conf_dir"`
+	DataDir              string        `toml:"data_dir"`
+	LogLevel             string        `toml:"log_level"`
+	EnableParsers        []string      `toml:"enable_parsers"`
+	DisableParsers       []string      `toml:"disable_parsers"`
+	Plugins              []string      `toml:"plugins"` // plugin parsers, each configured by <name>.toml in ParserConfDir
+	MotherDirs           []MontherDir  `toml:"mother_dirs"`
+	DestMovieOnAirDir    string        `toml:"dest_movie_on_air_dir"`
+	DestTvOnAirDir       string        `toml:"dest_tv_on_air_dir"`
+	TrashDir             string        `toml:"trash_dir"`
+	ScanInterval         time.Duration `toml:"scan_interval"`
+	ParseSleep           time.Duration `toml:"parse_sleep"`
+	Workers              int           `toml:"workers"`
+	Watch                bool          `toml:"watch"`
+	WatchDebounce        time.Duration `toml:"watch_debounce"`
+	WatchConfig          bool          `toml:"watch_config"`
+	SettleDur            time.Duration `toml:"settle_dur"`
+	SettleTwoScans       bool          `toml:"settle_two_scans"`
+	PartialExts          []string      `toml:"partial_exts"`
+	TmdbSock5Proxy       string        `toml:"tmdb_sock5_proxy"`
+	TmdbCacheDur         time.Duration `toml:"tmdb_cache_dur"`
+	TmdbRateLimit        float64       `toml:"tmdb_rate_limit"`
+	MatchMinScore        float64       `toml:"match_min_score"`
+	MatchMargin          float64       `toml:"match_margin"`
+	DryRun               bool          `toml:"dry_run"`
+	JournalRecovery      string        `toml:"journal_recovery"`
+	EnableStat           bool          `toml:"stat"`
+	StatInterval         time.Duration `toml:"stat_interval"`
+	StatInitWait         time.Duration `toml:"stat_init_wait"`
+	StatDirs             []StatDir     `toml:"stat_dirs"`
+	StatLargeMovieSize   string        `toml:"stat_large_movie_size"`
+	StatLargeEpisodeSize string        `toml:"stat_large_episode_size"`
+	EnablePrometheus     bool          `toml:"prometheus"`
+	PrometheusPort       int           `toml:"prometheus_port"`
+	AdminAddr            string        `toml:"admin_addr"`
+	AdminToken           string        `toml:"admin_token"`
 }
 
+// MontherDir is a scan dir, empty fields fall back to the global ones
 type MontherDir struct {
-	DirPath       string        `toml:"dir_path"`
-	SleepInterval time.Duration `toml:"sleep_interval"`
+	DirPath        string        `toml:"dir_path"`
+	SleepInterval  time.Duration `toml:"sleep_interval"`
+	MovieTargetDir string        `toml:"movie_target_dir"`
+	TvTargetDir    string        `toml:"tv_target_dir"`
+	TrashDir       string        `toml:"trash_dir"`
+	Parsers        []string      `toml:"parsers"`
+	Workers        int           `toml:"workers"`
 }
 
 const (
@@ -31,11 +83,67 @@ type StatDir struct {
 	MediaType string `toml:"media_type"`
 }
 
+// Default returns the configuration of defaults
+func Default() *Configuration {
+	return &Configuration{
+		ParserConfDir:        "parsercfg",
+		DataDir:              "data",
+		LogLevel:             "info",
+		DestMovieOnAirDir:    "movies",
+		DestTvOnAirDir:       "tv",
+		TrashDir:             "trash",
+		ScanInterval:         5 * time.Minute,
+		Workers:              4,
+		WatchDebounce:        10 * time.Second,
+		SettleDur:            1 * time.Minute,
+		SettleTwoScans:       true,
+		TmdbCacheDur:         6 * time.Hour,
+		TmdbRateLimit:        20,
+		MatchMinScore:        identify.DefaultOpts.MinScore,
+		MatchMargin:          identify.DefaultOpts.Margin,
+		JournalRecovery:      "back",
+		EnableStat:           true,
+		StatInterval:         6 * time.Hour,
+		StatInitWait:         10 * time.Second,
+		StatLargeMovieSize:   "10G",
+		StatLargeEpisodeSize: "5G",
+		EnablePrometheus:     true,
+		PrometheusPort:       12200,
+		AdminAddr:            "127.0.0.1:12201", // the review queue is served only by the admin api
+	}
+}
+
 func LoadConfigurationFromFile(file string) (*Configuration, error) {
 	c := &Configuration{}
-	_, err := toml.DecodeFile(file, c)
+	err := c.LoadFile(file)
 	if err != nil {
 		return nil, err
 	}
 	return c, nil
 }
+
+// LoadFile decodes the TOML file over c, keys in the file override fields of c, unknown keys are an error
+func (c *Configuration) LoadFile(file string) error {
+	md, err := toml.DecodeFile(file, c)
+	if err != nil {
+		return err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		return fmt.Errorf("unknown keys in %s: %s", file, strings.Join(keys, ", "))
+	}
+	c.File = file
+	return nil
+}
+
+// Print writes c as TOML, secrets are redacted
+func (c *Configuration) Print(w io.Writer) error {
+	printed := *c
+	if printed.AdminToken != "" {
+		printed.AdminToken = "<redacted>"
+	}
+	return toml.NewEncoder(w).Encode(&printed)
+}
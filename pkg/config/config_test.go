@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"testing"
 	"time"
 )
@@ -27,6 +28,8 @@ func TestLoadConfiguration(t *testing.T) {
 			{
 				DirPath:       "path/to/motherdir2",
 				SleepInterval: time.Duration(9)*time.Minute + time.Duration(13)*time.Second,
+				TvTargetDir:   "path/to/anime",
+				Parsers:       []string{"tvepfile"},
 			},
 		},
 		TmdbSock5Proxy: "localhost:11000",
@@ -51,6 +54,12 @@ func testConfigurationSame(t testing.TB, expect, real *Configuration) {
 		if expect.MotherDirs[i].SleepInterval != real.MotherDirs[i].SleepInterval {
 			t.Errorf("MotherDirs[%d].SleepInterval: expected %s, got %s", i, expect.MotherDirs[i].SleepInterval, real.MotherDirs[i].SleepInterval)
 		}
+		if expect.MotherDirs[i].TvTargetDir != real.MotherDirs[i].TvTargetDir {
+			t.Errorf("MotherDirs[%d].TvTargetDir: expected %s, got %s", i, expect.MotherDirs[i].TvTargetDir, real.MotherDirs[i].TvTargetDir)
+		}
+		if fmt.Sprint(expect.MotherDirs[i].Parsers) != fmt.Sprint(real.MotherDirs[i].Parsers) {
+			t.Errorf("MotherDirs[%d].Parsers: expected %v, got %v", i, expect.MotherDirs[i].Parsers, real.MotherDirs[i].Parsers)
+		}
 	}
 	if expect.TmdbSock5Proxy != real.TmdbSock5Proxy {
 		t.Errorf("TmdbSock5Proxy: expected %s, got %s", expect.TmdbSock5Proxy, real.TmdbSock5Proxy)
@@ -0,0 +1,220 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// flagKeys maps flag names to config keys, set by defineFlags, the environment variable of a flag is EnvPrefix + upper case key
+type flagKeys map[string]string
+
+// definer defines flags bound to fields of a configuration, the current values of the fields are the flag defaults
+type definer struct {
+	fs   *flag.FlagSet
+	keys flagKeys
+}
+
+func (d *definer) define(name, key string) string {
+	d.keys[name] = key
+	return name
+}
+
+func (d *definer) str(p *string, name, key, usage string) {
+	d.fs.StringVar(p, d.define(name, key), *p, usage)
+}
+
+func (d *definer) boolean(p *bool, name, key, usage string) {
+	d.fs.BoolVar(p, d.define(name, key), *p, usage)
+}
+
+func (d *definer) integer(p *int, name, key, usage string) {
+	d.fs.IntVar(p, d.define(name, key), *p, usage)
+}
+
+func (d *definer) float(p *float64, name, key, usage string) {
+	d.fs.Float64Var(p, d.define(name, key), *p, usage)
+}
+
+func (d *definer) duration(p *time.Duration, name, key, usage string) {
+	d.fs.DurationVar(p, d.define(name, key), *p, usage)
+}
+
+func (d *definer) value(v flag.Value, name, key, usage string) {
+	d.fs.Var(v, d.define(name, key), usage)
+}
+
+// defineFlags defines a flag per setting of c on fs, bound to fields of c, the current values of c are the defaults
+func (c *Configuration) defineFlags(fs *flag.FlagSet) flagKeys {
+	d := &definer{fs: fs, keys: make(flagKeys)}
+	d.str(&c.ParserConfDir, "parsercfg", "parser_conf_dir", "parser dir")
+	d.str(&c.DataDir, "datadir", "data_dir", "data dir to persist runtime state")
+	d.str(&c.LogLevel, "loglv", "log_level", "log level")
+	d.value(&stringsValue{p: &c.EnableParsers}, "enable", "enable_parsers", "enable parsers")
+	d.value(&stringsValue{p: &c.DisableParsers}, "disable", "disable_parsers", "disable parsers")
+	d.value(&stringsValue{p: &c.Plugins}, "plugin", "plugins", "plugin parser, a subprocess configured by <name>.toml in the parser dir")
+	d.value(&motherDirsValue{p: &c.MotherDirs}, "scandir", "mother_dirs", "parser dirs, in form of path[;movie=dir][;tv=dir][;trash=dir][;parsers=a,b][;interval=5m][;workers=4]")
+	d.str(&c.DestMovieOnAirDir, "movietarget", "dest_movie_on_air_dir", "target movie dir")
+	d.str(&c.DestTvOnAirDir, "tvtarget", "dest_tv_on_air_dir", "target tv dir")
+	d.str(&c.TrashDir, "trash", "trash_dir", "trash dir")
+	d.duration(&c.ScanInterval, "scandur", "scan_interval", "scan duration")
+	d.duration(&c.ParseSleep, "parsedur", "parse_sleep", "extra sleep after each parser run, 0 to disable")
+	d.integer(&c.Workers, "workers", "workers", "entries parsed in parallel within a scan dir")
+	d.boolean(&c.Watch, "watch", "watch", "watch scan dirs for changes, linux only")
+	d.duration(&c.WatchDebounce, "watchdebounce", "watch_debounce", "watch debounce duration")
+	d.boolean(&c.WatchConfig, "watchconfig", "watch_config", "watch parser config dir and reload changed configs, linux only, SIGHUP always reloads")
+	d.duration(&c.SettleDur, "settledur", "settle_dur", "entry settled if unchanged for this duration, 0 to disable")
+	d.boolean(&c.SettleTwoScans, "settletwoscans", "settle_two_scans", "entry settled if unchanged across two scans")
+	d.value(&stringsValue{p: &c.PartialExts}, "partialext", "partial_exts", "partial download file ext, entry containing it is never parsed")
+	d.str(&c.TmdbSock5Proxy, "tmdbproxy", "tmdb_sock5_proxy", "tmdb proxy")
+	d.duration(&c.TmdbCacheDur, "tmdbcachedur", "tmdb_cache_dur", "tmdb cache duration")
+	d.float(&c.TmdbRateLimit, "tmdbrate", "tmdb_rate_limit", "max tmdb requests per second, 0 means no limit")
+	d.float(&c.MatchMinScore, "matchminscore", "match_min_score", "min score of the best tmdb search candidate")
+	d.float(&c.MatchMargin, "matchmargin", "match_margin", "min score lead of the best tmdb search candidate over the second")
+	d.boolean(&c.DryRun, "dryrun", "dry_run", "dry run")
+	d.str(&c.JournalRecovery, "journalrecovery", "journal_recovery", "recovery of multi-file entries left unfinished by a crash, back, forward or keep")
+	d.duration(&c.StatInterval, "statinterval", "stat_interval", "stat interval")
+	d.duration(&c.StatInitWait, "statinitwait", "stat_init_wait", "stat init wait")
+	d.value(&statDirsValue{p: &c.StatDirs, mediaType: MediaTypeMovie}, "statmoviedir", "stat_movie_dirs", "stat movie dirs")
+	d.value(&statDirsValue{p: &c.StatDirs, mediaType: MediaTypeTv}, "stattvdir", "stat_tv_dirs", "stat tv dirs")
+	d.str(&c.StatLargeMovieSize, "statlargemoviesize", "stat_large_movie_size", "stat large movie size")
+	d.str(&c.StatLargeEpisodeSize, "statlargeepisodesize", "stat_large_episode_size", "stat large tv episode size")
+	d.boolean(&c.EnableStat, "stat", "stat", "enable stat")
+	d.boolean(&c.EnablePrometheus, "prometheus", "prometheus", "enable http server of prometheus metrics")
+	d.integer(&c.PrometheusPort, "prometheusport", "prometheus_port", "prometheus port")
+	d.str(&c.AdminAddr, "adminaddr", "admin_addr", "bind address of the admin api and review queue, empty to disable")
+	d.str(&c.AdminToken, "admintoken", "admin_token", "bearer token of the admin api, empty means no auth")
+	fs.Lookup("admintoken").DefValue = "" // never printed by usage
+	return d.keys
+}
+
+// stringsValue is a repeated flag, the first Set replaces values of former layers instead of appending to them
+type stringsValue struct {
+	p   *[]string
+	set bool
+}
+
+func (v *stringsValue) String() string {
+	if v.p == nil {
+		return "[]"
+	}
+	return fmt.Sprintf("%v", *v.p)
+}
+
+func (v *stringsValue) Set(value string) error {
+	if !v.set {
+		*v.p, v.set = nil, true
+	}
+	*v.p = append(*v.p, value)
+	return nil
+}
+
+// motherDirsValue is a repeated -scandir flag, the first Set replaces scan dirs of former layers
+type motherDirsValue struct {
+	p   *[]MontherDir
+	set bool
+}
+
+func (v *motherDirsValue) String() string {
+	if v.p == nil {
+		return "[]"
+	}
+	var dirs []string
+	for _, dir := range *v.p {
+		dirs = append(dirs, dir.DirPath)
+	}
+	return fmt.Sprintf("%v", dirs)
+}
+
+func (v *motherDirsValue) Set(value string) error {
+	dir, err := ParseMotherDir(value)
+	if err != nil {
+		return err
+	}
+	if !v.set {
+		*v.p, v.set = nil, true
+	}
+	*v.p = append(*v.p, dir)
+	return nil
+}
+
+// statDirsValue is a repeated flag of stat dirs of a media type, the first Set replaces stat dirs of the media type of former layers
+type statDirsValue struct {
+	p         *[]StatDir
+	mediaType string
+	set       bool
+}
+
+func (v *statDirsValue) String() string {
+	if v.p == nil {
+		return "[]"
+	}
+	var dirs []string
+	for _, dir := range *v.p {
+		if dir.MediaType == v.mediaType {
+			dirs = append(dirs, dir.DirPath)
+		}
+	}
+	return fmt.Sprintf("%v", dirs)
+}
+
+func (v *statDirsValue) Set(value string) error {
+	if !v.set {
+		var kept []StatDir
+		for _, dir := range *v.p {
+			if dir.MediaType != v.mediaType {
+				kept = append(kept, dir)
+			}
+		}
+		*v.p, v.set = kept, true
+	}
+	*v.p = append(*v.p, StatDir{DirPath: value, MediaType: v.mediaType})
+	return nil
+}
+
+// ParseMotherDir parses a -scandir flag value in form of
+// "path[;movie=dir][;tv=dir][;trash=dir][;parsers=name1,name2][;interval=5m][;workers=4]"
+func ParseMotherDir(value string) (dir MontherDir, err error) {
+	segments := strings.Split(value, ";")
+	dir.DirPath = strings.TrimSpace(segments[0])
+	if dir.DirPath == "" {
+		return MontherDir{}, fmt.Errorf("empty scan dir in %q", value)
+	}
+	for _, segment := range segments[1:] {
+		key, val, ok := strings.Cut(segment, "=")
+		if !ok {
+			return MontherDir{}, fmt.Errorf("invalid option %q of scan dir %s", segment, dir.DirPath)
+		}
+		key = strings.TrimSpace(key)
+		val = strings.TrimSpace(val)
+		switch key {
+		case "movie":
+			dir.MovieTargetDir = val
+		case "tv":
+			dir.TvTargetDir = val
+		case "trash":
+			dir.TrashDir = val
+		case "parsers":
+			for _, name := range strings.Split(val, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					dir.Parsers = append(dir.Parsers, name)
+				}
+			}
+		case "interval":
+			dir.SleepInterval, err = time.ParseDuration(val)
+			if err != nil {
+				return MontherDir{}, fmt.Errorf("invalid interval of scan dir %s: %v", dir.DirPath, err)
+			}
+		case "workers":
+			dir.Workers, err = strconv.Atoi(val)
+			if err != nil {
+				return MontherDir{}, fmt.Errorf("invalid workers of scan dir %s: %v", dir.DirPath, err)
+			}
+		default:
+			return MontherDir{}, fmt.Errorf("unknown option %q of scan dir %s", key, dir.DirPath)
+		}
+	}
+	return dir, nil
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMotherDir(t *testing.T) {
+	dir, err := ParseMotherDir("path/to/download")
+	if err != nil {
+		t.Fatalf("ParseMotherDir() error = %v", err)
+	}
+	if dir.DirPath != "path/to/download" || dir.TvTargetDir != "" || dir.Parsers != nil {
+		t.Fatalf("ParseMotherDir() got = %+v", dir)
+	}
+
+	dir, err = ParseMotherDir("path/to/anime;tv=path/to/animelib;parsers=tvepfile, tvdir;interval=1m;workers=2")
+	if err != nil {
+		t.Fatalf("ParseMotherDir() error = %v", err)
+	}
+	if dir.DirPath != "path/to/anime" {
+		t.Fatalf("ParseMotherDir() DirPath got = %s", dir.DirPath)
+	}
+	if dir.TvTargetDir != "path/to/animelib" || dir.MovieTargetDir != "" {
+		t.Fatalf("ParseMotherDir() target dirs got = %+v", dir)
+	}
+	if len(dir.Parsers) != 2 || dir.Parsers[0] != "tvepfile" || dir.Parsers[1] != "tvdir" {
+		t.Fatalf("ParseMotherDir() Parsers got = %v", dir.Parsers)
+	}
+	if dir.SleepInterval != time.Minute || dir.Workers != 2 {
+		t.Fatalf("ParseMotherDir() got = %+v", dir)
+	}
+
+	_, err = ParseMotherDir("path/to/download;unknown=1")
+	if err == nil {
+		t.Fatalf("ParseMotherDir() unknown option should fail")
+	}
+}
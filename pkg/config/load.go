@@ -0,0 +1,244 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/log/level"
+
+	"asmediamgr/pkg/disk"
+	"asmediamgr/pkg/utils"
+)
+
+const (
+	configFlag = "config"
+	configKey  = "config" // ASMEDIAMGR_CONFIG selects the config file if -config is not given
+	envListSep = "|"      // separates values of a repeated flag in its environment variable
+)
+
+// Load loads the configuration in layers: defaults, then the config file, then environment variables, then flags in args
+// flags of the configuration and -config are defined on fs, other flags already defined on fs are parsed as usual,
+// environ is in form of os.Environ, unknown variables with EnvPrefix are an error,
+// the config file is DefaultConfigFile unless given by -config or the environment, only a missing default file is allowed
+func Load(fs *flag.FlagSet, args []string, environ []string) (*Configuration, error) {
+	env := make(map[string]string)
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(key, EnvPrefix) {
+			env[key] = value
+		}
+	}
+	file, explicit := configFile(fs, args, env)
+	c := Default()
+	err := c.LoadFile(file)
+	if err != nil && (explicit || !os.IsNotExist(err)) {
+		return nil, fmt.Errorf("failed to load config file: %v", err)
+	}
+	err = c.applyEnv(env)
+	if err != nil {
+		return nil, err
+	}
+	keys := c.defineFlags(fs)
+	fs.String(configFlag, DefaultConfigFile, fmt.Sprintf("TOML config file, flags override the environment, which overrides the file, "+
+		"the environment variable of a flag is %s plus the upper case key in the file", EnvPrefix))
+	for name, key := range keys {
+		if f := fs.Lookup(name); f != nil {
+			f.Usage += fmt.Sprintf(" (key %s)", key)
+		}
+	}
+	err = fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// configFile returns the config file given by -config in args, or by the environment, or DefaultConfigFile
+func configFile(fs *flag.FlagSet, args []string, env map[string]string) (file string, explicit bool) {
+	scratch := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	scratch.SetOutput(io.Discard)
+	Default().defineFlags(scratch)
+	path := scratch.String(configFlag, "", "")
+	fs.VisitAll(func(f *flag.Flag) {
+		if scratch.Lookup(f.Name) == nil {
+			scratch.Var(ignoredValue{f.Value}, f.Name, "")
+		}
+	})
+	_ = scratch.Parse(args) // errors are reported by the real parse
+	if *path != "" {
+		return *path, true
+	}
+	if file = env[EnvPrefix+strings.ToUpper(configKey)]; file != "" {
+		return file, true
+	}
+	return DefaultConfigFile, false
+}
+
+// ignoredValue is a flag of fs parsed only to find -config, it must not change the flag
+type ignoredValue struct {
+	flag.Value
+}
+
+func (v ignoredValue) Set(string) error {
+	return nil
+}
+
+func (v ignoredValue) IsBoolFlag() bool {
+	b, ok := v.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// applyEnv sets fields of c from environment variables, values of a repeated flag are separated by envListSep
+func (c *Configuration) applyEnv(env map[string]string) error {
+	fs := flag.NewFlagSet("env", flag.ContinueOnError)
+	keys := c.defineFlags(fs)
+	known := map[string]string{EnvPrefix + strings.ToUpper(configKey): configFlag}
+	for name, key := range keys {
+		known[EnvPrefix+strings.ToUpper(key)] = name
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, envName := range names {
+		flagName, ok := known[envName]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown environment variable %s", envName))
+			continue
+		}
+		if flagName == configFlag {
+			continue
+		}
+		values := []string{env[envName]}
+		if isRepeated(fs.Lookup(flagName).Value) {
+			values = strings.Split(env[envName], envListSep)
+		}
+		for _, value := range values {
+			err := fs.Set(flagName, value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid environment variable %s: %v", envName, err))
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func isRepeated(v flag.Value) bool {
+	switch v.(type) {
+	case *stringsValue, *motherDirsValue, *statDirsValue:
+		return true
+	default:
+		return false
+	}
+}
+
+// Validate checks c as a whole, it returns all problems found joined
+// scan dirs and target dirs must exist, a target dir must not be a scan dir or inside one
+func (c *Configuration) Validate() error {
+	var errs []error
+	if _, err := level.Parse(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("log_level: %v", err))
+	}
+	if _, err := disk.ParseRecoveryPolicy(c.JournalRecovery); err != nil {
+		errs = append(errs, fmt.Errorf("journal_recovery: %v", err))
+	}
+	if _, err := utils.SizeStringToBytesNum(c.StatLargeMovieSize); err != nil {
+		errs = append(errs, fmt.Errorf("stat_large_movie_size: %v", err))
+	}
+	if _, err := utils.SizeStringToBytesNum(c.StatLargeEpisodeSize); err != nil {
+		errs = append(errs, fmt.Errorf("stat_large_episode_size: %v", err))
+	}
+	if c.Workers <= 0 {
+		errs = append(errs, fmt.Errorf("workers: %d, must be positive", c.Workers))
+	}
+	for _, dir := range c.StatDirs {
+		if dir.MediaType != MediaTypeMovie && dir.MediaType != MediaTypeTv {
+			errs = append(errs, fmt.Errorf("stat_dirs: media type %q of %s, want %s or %s", dir.MediaType, dir.DirPath, MediaTypeMovie, MediaTypeTv))
+		}
+	}
+	var scanDirs []string
+	seen := make(map[string]bool)
+	for _, dir := range c.MotherDirs {
+		if err := checkDir(dir.DirPath); err != nil {
+			errs = append(errs, fmt.Errorf("scan dir: %v", err))
+		}
+		if seen[filepath.Clean(dir.DirPath)] {
+			errs = append(errs, fmt.Errorf("scan dir %s: listed more than once", dir.DirPath))
+		}
+		seen[filepath.Clean(dir.DirPath)] = true
+		scanDirs = append(scanDirs, dir.DirPath)
+	}
+	if len(c.MotherDirs) == 0 {
+		return errors.Join(errs...) // target dirs are not used
+	}
+	targets := map[string]string{
+		"dest_movie_on_air_dir": c.DestMovieOnAirDir,
+		"dest_tv_on_air_dir":    c.DestTvOnAirDir,
+		"trash_dir":             c.TrashDir,
+	}
+	for _, dir := range c.MotherDirs {
+		for name, target := range map[string]string{"movie_target_dir": dir.MovieTargetDir, "tv_target_dir": dir.TvTargetDir, "trash_dir": dir.TrashDir} {
+			if target != "" {
+				targets[fmt.Sprintf("%s of scan dir %s", name, dir.DirPath)] = target
+			}
+		}
+	}
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		target := targets[name]
+		if err := checkDir(target); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			continue
+		}
+		for _, scanDir := range scanDirs {
+			if isInside(target, scanDir) {
+				errs = append(errs, fmt.Errorf("%s: %s is scan dir %s or inside it, renamed files would be parsed again", name, target, scanDir))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func checkDir(dir string) error {
+	if dir == "" {
+		return fmt.Errorf("empty dir")
+	}
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("%s is not a dir", dir)
+	}
+	return nil
+}
+
+// isInside returns true if path is dir or inside dir
+func isInside(path, dir string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
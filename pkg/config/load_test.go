@@ -0,0 +1,195 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.toml")
+	content := `
+workers = 2
+log_level = "debug"
+scan_interval = "1m"
+enable_parsers = ["tvepfile", "tvdir"]
+
+[[mother_dirs]]
+dir_path = "from/file"
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load(newFlagSet(), []string{"-config", file}, nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if c.File != file || c.Workers != 2 || c.LogLevel != "debug" || c.ScanInterval != time.Minute || c.ParserConfDir != "parsercfg" {
+		t.Errorf("Load() file layer got = %+v", c)
+	}
+	if len(c.MotherDirs) != 1 || c.MotherDirs[0].DirPath != "from/file" {
+		t.Errorf("Load() MotherDirs got = %+v", c.MotherDirs)
+	}
+
+	environ := []string{"ASMEDIAMGR_WORKERS=3", "ASMEDIAMGR_ENABLE_PARSERS=moviedir|moviefile", "ASMEDIAMGR_CONFIG=" + file, "HOME=/root"}
+	fs := newFlagSet()
+	once := fs.Bool("once", false, "")
+	c, err = Load(fs, []string{"-loglv", "warn", "-once", "-scandir", "from/flag;workers=1", "path"}, environ)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if c.Workers != 3 || c.LogLevel != "warn" {
+		t.Errorf("Load() env and flag layers got workers = %d, log level = %s", c.Workers, c.LogLevel)
+	}
+	if strings.Join(c.EnableParsers, ",") != "moviedir,moviefile" {
+		t.Errorf("Load() env should replace enable_parsers of the file, got = %v", c.EnableParsers)
+	}
+	if len(c.MotherDirs) != 1 || c.MotherDirs[0].DirPath != "from/flag" || c.MotherDirs[0].Workers != 1 {
+		t.Errorf("Load() -scandir should replace mother_dirs of the file, got = %+v", c.MotherDirs)
+	}
+	if !*once || fs.NArg() != 1 || fs.Arg(0) != "path" {
+		t.Errorf("Load() other flags and args should be parsed, got once = %v, args = %v", *once, fs.Args())
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bad.toml"), []byte("workers = 2\nunknown_key = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil { // no DefaultConfigFile in dir
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tests := []struct {
+		name    string
+		args    []string
+		environ []string
+		want    string
+	}{
+		{"unknown key", []string{"-config", "bad.toml"}, nil, "unknown_key"},
+		{"missing explicit file", []string{"-config", "missing.toml"}, nil, "missing.toml"},
+		{"missing env file", nil, []string{"ASMEDIAMGR_CONFIG=missing.toml"}, "missing.toml"},
+		{"unknown env", nil, []string{"ASMEDIAMGR_NO_SUCH=1"}, "ASMEDIAMGR_NO_SUCH"},
+		{"invalid env", nil, []string{"ASMEDIAMGR_WORKERS=many"}, "ASMEDIAMGR_WORKERS"},
+		{"invalid flag", []string{"-workers", "many"}, nil, "many"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(newFlagSet(), tt.args, tt.environ)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+
+	c, err := Load(newFlagSet(), nil, nil)
+	if err != nil {
+		t.Fatalf("Load() missing default file should be allowed, error = %v", err)
+	}
+	if c.File != "" || c.Workers != Default().Workers || c.AdminAddr != "127.0.0.1:12201" {
+		t.Errorf("Load() defaults got = %+v", c)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"scan", "scan/movies", "movies", "tv", "trash"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	valid := func() *Configuration {
+		c := Default()
+		c.DestMovieOnAirDir = filepath.Join(dir, "movies")
+		c.DestTvOnAirDir = filepath.Join(dir, "tv")
+		c.TrashDir = filepath.Join(dir, "trash")
+		c.MotherDirs = []MontherDir{{DirPath: filepath.Join(dir, "scan")}}
+		return c
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if err := Default().Validate(); err != nil {
+		t.Errorf("Validate() target dirs should not be checked without scan dirs, error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Configuration)
+		want   []string
+	}{
+		{"missing scan dir", func(c *Configuration) {
+			c.MotherDirs = append(c.MotherDirs, MontherDir{DirPath: filepath.Join(dir, "missing")})
+		}, []string{"scan dir", "missing"}},
+		{"duplicated scan dir", func(c *Configuration) {
+			c.MotherDirs = append(c.MotherDirs, MontherDir{DirPath: filepath.Join(dir, "scan") + "/"})
+		}, []string{"more than once"}},
+		{"target is scan dir", func(c *Configuration) {
+			c.DestTvOnAirDir = filepath.Join(dir, "scan")
+		}, []string{"dest_tv_on_air_dir", "renamed files would be parsed again"}},
+		{"target inside scan dir", func(c *Configuration) {
+			c.MotherDirs[0].MovieTargetDir = filepath.Join(dir, "scan", "movies")
+		}, []string{"movie_target_dir of scan dir", "renamed files would be parsed again"}},
+		{"missing target", func(c *Configuration) {
+			c.TrashDir = filepath.Join(dir, "missing")
+		}, []string{"trash_dir"}},
+		{"all errors", func(c *Configuration) {
+			c.LogLevel = "loud"
+			c.Workers = 0
+			c.JournalRecovery = "sideways"
+			c.StatDirs = []StatDir{{DirPath: dir, MediaType: "music"}}
+		}, []string{"log_level", "workers", "journal_recovery", "stat_dirs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.modify(c)
+			err := c.Validate()
+			if err == nil {
+				t.Fatalf("Validate() should fail")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %v, want containing %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsInside(t *testing.T) {
+	tests := []struct {
+		path, dir string
+		want      bool
+	}{
+		{"a", "a", true},
+		{"a/b", "a", true},
+		{"a/../a/b", "a/", true},
+		{"ab", "a", false},
+		{"..a", ".", true},
+		{"b", "a", false},
+	}
+	for _, tt := range tests {
+		if got := isInside(tt.path, tt.dir); got != tt.want {
+			t.Errorf("isInside(%q, %q) = %v, want %v", tt.path, tt.dir, got, tt.want)
+		}
+	}
+}
@@ -5,12 +5,14 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type File struct {
 	RelPathToMother string
 	Name, Ext       string
 	BytesNum        int64
+	ModTime         time.Time
 }
 
 type EntryType int
@@ -92,6 +94,7 @@ func fileEntry(sub fs.DirEntry, motherPath string) (*Entry, error) {
 				Name:            sub.Name(),
 				Ext:             filepath.Ext(sub.Name()),
 				BytesNum:        info.Size(),
+				ModTime:         info.ModTime(),
 			},
 		},
 	}
@@ -130,8 +133,23 @@ func dirEntry(sub fs.DirEntry, motherPath string) (*Entry, error) {
 			Name:            d.Name(),
 			Ext:             filepath.Ext(d.Name()),
 			BytesNum:        info.Size(),
+			ModTime:         info.ModTime(),
 		})
 		return nil
 	})
 	return e, nil
 }
+
+// ScanEntry scans a single entry named name in motherPath
+// returns an error satisfying os.IsNotExist if the entry does not exist
+func ScanEntry(motherPath, name string) (*Entry, error) {
+	info, err := os.Stat(filepath.Join(motherPath, name))
+	if err != nil {
+		return nil, err
+	}
+	sub := fs.FileInfoToDirEntry(info)
+	if sub.IsDir() {
+		return dirEntry(sub, motherPath)
+	}
+	return fileEntry(sub, motherPath)
+}
@@ -1,6 +1,7 @@
 package dirinfo
 
 import (
+	"os"
 	"testing"
 )
 
@@ -93,3 +94,24 @@ func testCheckFileSame(t testing.TB, expectFile, file *File) {
 		t.Fatalf("file bytes num not match: %d != %d", expectFile.BytesNum, file.BytesNum)
 	}
 }
+
+func TestScanEntry(t *testing.T) {
+	entry, err := ScanEntry(motherDirPath, "entry2")
+	if err != nil {
+		t.Fatalf("failed to scan entry: %v", err)
+	}
+	if entry.Type != DirEntry || entry.Name() != "entry2" || len(entry.FileList) != 2 {
+		t.Fatalf("scan entry not match: %+v", entry)
+	}
+	entry, err = ScanEntry(motherDirPath, "entry1.txt")
+	if err != nil {
+		t.Fatalf("failed to scan entry: %v", err)
+	}
+	if entry.Type != FileEntry || entry.Name() != "entry1.txt" {
+		t.Fatalf("scan entry not match: %+v", entry)
+	}
+	_, err = ScanEntry(motherDirPath, "not_existed")
+	if !os.IsNotExist(err) {
+		t.Fatalf("scan not existed entry error: %v", err)
+	}
+}
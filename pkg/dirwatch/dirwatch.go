@@ -0,0 +1,79 @@
+package dirwatch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotSupported is returned by Watch on platforms without a watcher implementation
+	ErrNotSupported = errors.New("dir watch is not supported on this platform")
+)
+
+const (
+	defaultDebounce = 10 * time.Second
+)
+
+// Watch watches motherPath and sends the name of every top level entry that changed,
+// including changes deep inside a dir entry, once the entry has been quiet for debounce.
+// The returned channel is closed when ctx is done or the watcher stops on error.
+func Watch(ctx context.Context, motherPath string, debounce time.Duration) (<-chan string, error) {
+	if debounce <= 0 {
+		debounce = defaultDebounce
+	}
+	raw, err := watchRaw(ctx, motherPath)
+	if err != nil {
+		return nil, err
+	}
+	return debounceNames(ctx, raw, debounce), nil
+}
+
+// debounceNames sends a name from in to the returned channel only after
+// no more same name is received for debounce, so a file still being written is reported once
+func debounceNames(ctx context.Context, in <-chan string, debounce time.Duration) <-chan string {
+	out := make(chan string)
+	go func() {
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		timers := make(map[string]*time.Timer)
+		defer func() {
+			mu.Lock()
+			for _, timer := range timers {
+				if timer.Stop() {
+					wg.Done() // the pending func will never run
+				}
+			}
+			mu.Unlock()
+			wg.Wait()
+			close(out)
+		}()
+		for name := range in {
+			mu.Lock()
+			if timer, ok := timers[name]; ok && timer.Stop() {
+				timer.Reset(debounce)
+				mu.Unlock()
+				continue
+			}
+			name := name
+			var timer *time.Timer
+			wg.Add(1)
+			timer = time.AfterFunc(debounce, func() {
+				defer wg.Done()
+				mu.Lock()
+				if timers[name] == timer {
+					delete(timers, name)
+				}
+				mu.Unlock()
+				select {
+				case out <- name:
+				case <-ctx.Done():
+				}
+			})
+			timers[name] = timer
+			mu.Unlock()
+		}
+	}()
+	return out
+}
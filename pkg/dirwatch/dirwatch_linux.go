@@ -0,0 +1,129 @@
+package dirwatch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	watchMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_MODIFY | unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_DELETE
+)
+
+// inotifyWatcher watches motherPath and all dirs inside it, inotify itself is not recursive
+type inotifyWatcher struct {
+	file       *os.File
+	fd         int
+	motherPath string
+	relDirs    map[int]string // watch descriptor -> dir path relative to motherPath, "" is motherPath itself
+}
+
+func watchRaw(ctx context.Context, motherPath string) (<-chan string, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("InotifyInit1() error = %v", err)
+	}
+	w := &inotifyWatcher{
+		file:       os.NewFile(uintptr(fd), "inotify"), // non-blocking fd, so Close() wakes up Read()
+		fd:         fd,
+		motherPath: motherPath,
+		relDirs:    make(map[int]string),
+	}
+	err = w.addTree("")
+	if err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	out := make(chan string)
+	go func() {
+		<-ctx.Done()
+		w.file.Close()
+	}()
+	go func() {
+		defer close(out)
+		w.readLoop(ctx, out)
+	}()
+	return out, nil
+}
+
+// addTree adds watches to the dir relDir and all dirs inside it
+func (w *inotifyWatcher) addTree(relDir string) error {
+	root := filepath.Join(w.motherPath, relDir)
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != root && os.IsNotExist(err) {
+				return nil // removed while walking
+			}
+			return fmt.Errorf("failed to walk dir: %v", err)
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(w.motherPath, path)
+		if err != nil {
+			return fmt.Errorf("failed to get rel path to mother: %v", err)
+		}
+		if rel == "." {
+			rel = ""
+		}
+		wd, err := unix.InotifyAddWatch(w.fd, path, watchMask)
+		if err != nil {
+			if path != root && os.IsNotExist(err) {
+				return nil
+			}
+			return fmt.Errorf("InotifyAddWatch() path = %s, error = %v", path, err)
+		}
+		w.relDirs[wd] = rel
+		return nil
+	})
+}
+
+func (w *inotifyWatcher) readLoop(ctx context.Context, out chan<- string) {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return // closed by ctx, or broken fd
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(event.Len)]
+			offset += unix.SizeofInotifyEvent + int(event.Len)
+			name := string(bytes.TrimRight(nameBytes, "\x00"))
+			entryName, ok := w.handleEvent(int(event.Wd), event.Mask, name)
+			if !ok {
+				continue
+			}
+			select {
+			case out <- entryName:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// handleEvent keeps the watch list up to date and returns the top level entry name of the event
+func (w *inotifyWatcher) handleEvent(wd int, mask uint32, name string) (entryName string, ok bool) {
+	relDir, known := w.relDirs[wd]
+	if mask&unix.IN_IGNORED != 0 {
+		delete(w.relDirs, wd)
+		return "", false
+	}
+	if !known || (relDir == "" && name == "") {
+		return "", false
+	}
+	rel := filepath.Join(relDir, name)
+	if mask&unix.IN_ISDIR != 0 && mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+		w.addTree(rel) // best effort, a dir may be removed right after created
+	}
+	entryName, _, _ = strings.Cut(filepath.ToSlash(rel), "/")
+	return entryName, entryName != ""
+}
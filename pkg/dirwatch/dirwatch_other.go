@@ -0,0 +1,11 @@
+//go:build !linux
+
+package dirwatch
+
+import (
+	"context"
+)
+
+func watchRaw(ctx context.Context, motherPath string) (<-chan string, error) {
+	return nil, ErrNotSupported
+}
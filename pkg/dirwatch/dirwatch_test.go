@@ -0,0 +1,71 @@
+package dirwatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestDebounceNames(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan string)
+	out := debounceNames(ctx, in, 50*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		in <- "entry1"
+		time.Sleep(10 * time.Millisecond)
+	}
+	in <- "entry2"
+	got := make(map[string]int)
+	timeout := time.After(2 * time.Second)
+	for len(got) < 2 {
+		select {
+		case name := <-out:
+			got[name]++
+		case <-timeout:
+			t.Fatalf("debounceNames() timeout, got = %v", got)
+		}
+	}
+	if got["entry1"] != 1 || got["entry2"] != 1 {
+		t.Fatalf("debounceNames() got = %v, want each entry once", got)
+	}
+	close(in)
+	if _, ok := <-out; ok {
+		t.Fatalf("debounceNames() out should be closed after in is closed")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("dir watch only supported on linux")
+	}
+	motherDir := t.TempDir()
+	err := os.Mkdir(filepath.Join(motherDir, "entry2"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := Watch(ctx, motherDir, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	err = os.WriteFile(filepath.Join(motherDir, "entry2", "file21.txt"), []byte("content"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case name := <-changes:
+		if name != "entry2" {
+			t.Fatalf("Watch() got = %s, want = entry2", name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Watch() timeout")
+	}
+	cancel()
+	for range changes {
+	}
+}
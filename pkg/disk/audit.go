@@ -0,0 +1,257 @@
+package disk
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AuditFileName is the audit log in the data dir
+	AuditFileName = "audit.jsonl"
+)
+
+// AuditRecord is a single line of the audit log, a disk op done or reverted
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	Batch      string    `json:"batch"` // ops of an entry run share a batch
+	Seq        int       `json:"seq"`   // index of the op in the plan
+	ScanDir    string    `json:"scan_dir"`
+	Entry      string    `json:"entry"`
+	Parser     string    `json:"parser"`
+	Op         string    `json:"op"`
+	Tmdbid     int       `json:"tmdbid,omitempty"`
+	OldPath    string    `json:"old_path"`
+	NewPath    string    `json:"new_path"`
+	TargetRoot string    `json:"target_root"` // dir the new path is built in
+	IsDir      bool      `json:"is_dir,omitempty"`
+	Size       int64     `json:"size"`             // of the new path right after the op
+	ModTime    time.Time `json:"mod_time"`         // of the new path right after the op
+	Undone     bool      `json:"undone,omitempty"` // true if the record reverts the op of Batch and Seq
+}
+
+func (r *AuditRecord) key() string {
+	return fmt.Sprintf("%s/%d", r.Batch, r.Seq)
+}
+
+// AuditTag is what the audit log needs to know about the entry run besides the op
+type AuditTag struct {
+	Batch   string
+	ScanDir string
+	Entry   string
+	Parser  string
+}
+
+// NewBatchID returns a new batch id, sortable by time
+func NewBatchID(now time.Time) string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return now.Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+// AuditLog is an append-only JSONL log of disk ops
+// Note: this struct is concurrent safe, every record is synced to disk before Append returns
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewAuditLog creates an audit log at path, the file is created on the first record
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{path: path}
+}
+
+// Path returns the path of the audit log
+func (a *AuditLog) Path() string {
+	return a.path
+}
+
+// Record appends the record of op, seq is the index of op in its plan, op must have been run successfully
+func (a *AuditLog) Record(tag AuditTag, seq int, op *Op, now time.Time) error {
+	newPath, err := op.NewPath()
+	if err != nil {
+		return err
+	}
+	rec := &AuditRecord{
+		Time:       now,
+		Batch:      tag.Batch,
+		Seq:        seq,
+		ScanDir:    tag.ScanDir,
+		Entry:      tag.Entry,
+		Parser:     tag.Parser,
+		Op:         op.Type.String(),
+		Tmdbid:     op.Tmdbid(),
+		OldPath:    op.OldPath(),
+		NewPath:    newPath,
+		TargetRoot: op.targetMotherDir(),
+	}
+	stat, err := os.Lstat(newPath)
+	if err != nil {
+		return fmt.Errorf("Lstat() error = %v", err)
+	}
+	rec.IsDir, rec.Size, rec.ModTime = stat.IsDir(), stat.Size(), stat.ModTime()
+	return a.Append(rec)
+}
+
+// Append appends rec as a single line
+func (a *AuditLog) Append(rec *AuditRecord) error {
+	content, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("Marshal() error = %v", err)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("OpenFile() error = %v", err)
+	}
+	_, err = f.Write(append(content, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("append audit log %s error = %v", a.path, err)
+	}
+	return nil
+}
+
+// ReadAuditLog reads all records of the audit log at path in file order, a missing file means no records
+// a truncated last line, left by a crash, is ignored
+func ReadAuditLog(path string) ([]*AuditRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Open() error = %v", err)
+	}
+	defer f.Close()
+	var records []*AuditRecord
+	var lastErr error
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if lastErr != nil {
+			return nil, lastErr // only the last line may be broken
+		}
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		rec := &AuditRecord{}
+		err := json.Unmarshal(scanner.Bytes(), rec)
+		if err != nil {
+			lastErr = fmt.Errorf("audit log %s line %d: Unmarshal() error = %v", path, line, err)
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Scan() error = %v", err)
+	}
+	return records, nil
+}
+
+// UndoFilter selects the records to undo, all set fields must match, at least one field must be set
+type UndoFilter struct {
+	Batch string
+	Entry string
+	Since time.Time
+}
+
+// SelectUndo returns the records matching filter and not undone yet, newest first, the order to undo them
+func SelectUndo(records []*AuditRecord, filter UndoFilter) ([]*AuditRecord, error) {
+	if filter.Batch == "" && filter.Entry == "" && filter.Since.IsZero() {
+		return nil, fmt.Errorf("one of batch, entry and since is required")
+	}
+	undone := make(map[string]struct{})
+	for _, rec := range records {
+		if rec.Undone {
+			undone[rec.key()] = struct{}{}
+		}
+	}
+	var ret []*AuditRecord
+	for _, rec := range records {
+		if rec.Undone {
+			continue
+		}
+		if _, ok := undone[rec.key()]; ok {
+			continue
+		}
+		if filter.Batch != "" && rec.Batch != filter.Batch {
+			continue
+		}
+		if filter.Entry != "" && rec.Entry != filter.Entry {
+			continue
+		}
+		if !filter.Since.IsZero() && rec.Time.Before(filter.Since) {
+			continue
+		}
+		ret = append(ret, rec)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if !ret[i].Time.Equal(ret[j].Time) {
+			return ret[i].Time.After(ret[j].Time)
+		}
+		if ret[i].Batch != ret[j].Batch {
+			return ret[i].Batch > ret[j].Batch
+		}
+		return ret[i].Seq > ret[j].Seq
+	})
+	return ret, nil
+}
+
+// CheckUndo checks rec can be reverted, its new path must be unchanged since the op and its old path must be free
+func CheckUndo(rec *AuditRecord) error {
+	stat, err := os.Lstat(rec.NewPath)
+	if err != nil {
+		return fmt.Errorf("%s: Lstat() error = %v", rec.NewPath, err)
+	}
+	if stat.IsDir() != rec.IsDir || !stat.ModTime().Equal(rec.ModTime) || (!rec.IsDir && stat.Size() != rec.Size) {
+		return fmt.Errorf("%s: changed since %s", rec.NewPath, rec.Time.Format(time.RFC3339))
+	}
+	if fileExists(rec.OldPath) {
+		return fmt.Errorf("%s: already existed", rec.OldPath)
+	}
+	return nil
+}
+
+// Undo reverts the op of rec by renaming its new path back, empty dirs left under its target root are removed
+// the returned record is to be appended to the audit log
+func Undo(rec *AuditRecord, now time.Time) (*AuditRecord, error) {
+	err := CheckUndo(rec)
+	if err != nil {
+		return nil, err
+	}
+	err = revertRename(rec.OldPath, rec.NewPath, rec.TargetRoot)
+	if err != nil {
+		return nil, err
+	}
+	undone := *rec
+	undone.Time = now
+	undone.Undone = true
+	return &undone, nil
+}
+
+// removeEmptyParents removes dir and its parents while they are empty, root itself is kept
+func removeEmptyParents(dir, root string) {
+	if root == "" {
+		return
+	}
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return // not empty
+		}
+	}
+}
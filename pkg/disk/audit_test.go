@@ -0,0 +1,110 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuditUndo(t *testing.T) {
+	srcDir := t.TempDir()
+	targetDir := t.TempDir()
+	auditLog := NewAuditLog(filepath.Join(t.TempDir(), AuditFileName))
+	oldPath := filepath.Join(srcDir, "show", "ep1.mkv")
+	err := os.MkdirAll(filepath.Dir(oldPath), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(oldPath, []byte("content"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &Plan{}
+	op := plan.AddTvEpisode(&TvEpisodeRenameTask{
+		OldPath:      oldPath,
+		NewMotherDir: targetDir,
+		OriginalName: "name",
+		Year:         2024,
+		Tmdbid:       1,
+		Season:       1,
+		Episode:      1,
+	})
+	d, err := NewDiskService(&DiskServiceOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.RenameTvEpisode(op.TvEpisode)
+	if err != nil {
+		t.Fatalf("RenameTvEpisode() error = %v", err)
+	}
+	now := time.Now()
+	tag := AuditTag{Batch: NewBatchID(now), ScanDir: srcDir, Entry: "show", Parser: "tvdir"}
+	err = auditLog.Record(tag, 0, op, now)
+	if err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	records, err := ReadAuditLog(auditLog.Path())
+	if err != nil || len(records) != 1 {
+		t.Fatalf("ReadAuditLog() got = %d records, err = %v", len(records), err)
+	}
+	if _, err := SelectUndo(records, UndoFilter{}); err == nil {
+		t.Fatalf("SelectUndo() empty filter should fail")
+	}
+	selected, err := SelectUndo(records, UndoFilter{Entry: "show"})
+	if err != nil || len(selected) != 1 || selected[0].Tmdbid != 1 || selected[0].Parser != "tvdir" {
+		t.Fatalf("SelectUndo() got = %v, err = %v", selected, err)
+	}
+
+	newPath := selected[0].NewPath
+	err = os.WriteFile(newPath, []byte("changed content"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckUndo(selected[0]); err == nil {
+		t.Fatalf("CheckUndo() changed destination should fail")
+	}
+	err = os.WriteFile(newPath, []byte("content"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(newPath, selected[0].ModTime, selected[0].ModTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	undone, err := Undo(selected[0], time.Now())
+	if err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	if !fileExists(oldPath) || fileExists(newPath) {
+		t.Fatalf("Undo() should move %s back to %s", newPath, oldPath)
+	}
+	entries, _ := os.ReadDir(targetDir)
+	if len(entries) != 0 {
+		t.Fatalf("Undo() should remove empty dirs in target root, got %d", len(entries))
+	}
+	err = auditLog.Append(undone)
+	if err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	f, err := os.OpenFile(auditLog.Path(), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString(`{"time":"2024-01`) // crashed while appending
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err = ReadAuditLog(auditLog.Path())
+	if err != nil || len(records) != 2 {
+		t.Fatalf("ReadAuditLog() got = %d records, err = %v", len(records), err)
+	}
+	selected, err = SelectUndo(records, UndoFilter{Batch: tag.Batch})
+	if err != nil || len(selected) != 0 {
+		t.Fatalf("SelectUndo() undone ops got = %d, err = %v", len(selected), err)
+	}
+}
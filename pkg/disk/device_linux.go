@@ -0,0 +1,22 @@
+package disk
+
+import (
+	"os"
+	"syscall"
+)
+
+// sameDevice reports whether a and b are in the same filesystem, so a can be renamed into b
+// if it can not be told, false is returned
+func sameDevice(a, b string) bool {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	aStat, aOk := aInfo.Sys().(*syscall.Stat_t)
+	bStat, bOk := bInfo.Sys().(*syscall.Stat_t)
+	return aOk && bOk && aStat.Dev == bStat.Dev
+}
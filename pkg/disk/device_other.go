@@ -0,0 +1,8 @@
+//go:build !linux
+
+package disk
+
+// sameDevice is not supported on this platform, every rename is treated as same device
+func sameDevice(a, b string) bool {
+	return true
+}
@@ -1,10 +1,12 @@
 package disk
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -13,18 +15,107 @@ import (
 type DiskServiceOpts struct {
 	Logger         log.Logger
 	DryRunModeOpen bool
+	JournalDir     string // dir of journal records of multi-op plans, empty means no journal
 }
 
 type DiskService struct {
-	logger     log.Logger
-	dryRunMode bool
+	logger      log.Logger
+	dryRunMode  bool
+	targetLocks *pathLocker // two callers never touch the same target path at the same time
+	journal     *journal    // nil means no journal
 }
 
 func NewDiskService(opts *DiskServiceOpts) (*DiskService, error) {
 	if opts.Logger == nil {
 		opts.Logger = log.NewLogfmtLogger(os.Stderr)
 	}
-	return &DiskService{logger: opts.Logger, dryRunMode: opts.DryRunModeOpen}, nil
+	d := &DiskService{logger: opts.Logger, dryRunMode: opts.DryRunModeOpen, targetLocks: newPathLocker()}
+	if opts.JournalDir != "" && !opts.DryRunModeOpen {
+		j, err := newJournal(opts.JournalDir)
+		if err != nil {
+			return nil, err
+		}
+		d.journal = j
+	}
+	return d, nil
+}
+
+// BeginPlan writes the journal record of plan before its first op runs, plans of a single op are not journaled
+// it returns the journal id to pass to EndPlan, empty if not journaled
+func (d *DiskService) BeginPlan(plan *Plan, tag AuditTag) (journalID string, err error) {
+	if d.journal == nil || len(plan.Ops) < 2 {
+		return "", nil
+	}
+	rec, err := newJournalRecord(plan, tag, time.Now())
+	if err != nil {
+		return "", err
+	}
+	err = d.journal.write(rec)
+	if err != nil {
+		return "", fmt.Errorf("write journal error = %v", err)
+	}
+	return rec.Batch, nil
+}
+
+// EndPlan marks the plan of journalID finished by removing its journal record,
+// if the plan failed, its done ops are reverted first so the entry is left as before, reverted returns their audit records
+func (d *DiskService) EndPlan(journalID string, succ bool) (reverted []*AuditRecord, err error) {
+	if journalID == "" {
+		return nil, nil
+	}
+	if !succ {
+		rec, err := d.journal.read(journalID)
+		if err != nil {
+			return nil, err
+		}
+		reverted, err = rollBack(rec, time.Now())
+		if err != nil {
+			return reverted, fmt.Errorf("roll back batch %s error = %v, journal kept", journalID, err)
+		}
+		level.Info(d.logger).Log("msg", "failed plan rolled back", "batch", journalID, "entry", rec.Entry, "reverted", len(reverted))
+	}
+	return reverted, d.journal.remove(journalID)
+}
+
+// RecoverJournals recovers plans left unfinished by a crash with policy, it must be called before any plan runs,
+// it returns the audit records of ops run or reverted, a journal failed to recover is kept and reported in err
+func (d *DiskService) RecoverJournals(policy RecoveryPolicy) (records []*AuditRecord, err error) {
+	if d.journal == nil {
+		return nil, nil
+	}
+	batches, err := d.journal.unfinished()
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, batch := range batches {
+		rec, err := d.journal.read(batch)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if policy == RecoverKeep {
+			level.Warn(d.logger).Log("msg", "unfinished plan kept", "batch", batch, "entry", rec.Entry, "journal", d.journal.path(batch))
+			continue
+		}
+		var recovered []*AuditRecord
+		if policy == RecoverForward {
+			recovered, err = rollForward(rec, time.Now())
+		} else {
+			recovered, err = rollBack(rec, time.Now())
+		}
+		records = append(records, recovered...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("recover batch %s %s error = %v, journal kept", batch, policy, err))
+			continue
+		}
+		level.Info(d.logger).Log("msg", "unfinished plan recovered", "batch", batch, "entry", rec.Entry, "policy", policy, "ops", len(recovered))
+		err = d.journal.remove(batch)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return records, errors.Join(errs...)
 }
 
 type TvEpisodeRenameTask struct {
@@ -35,6 +126,7 @@ type TvEpisodeRenameTask struct {
 	Tmdbid       int
 	Season       int
 	Episode      int
+	EpisodeEnd   int // last episode of a multi-episode file, such as 2 of S01E01-E02, 0 if single
 }
 
 type TvSubtitleRenameTask struct {
@@ -45,6 +137,7 @@ type TvSubtitleRenameTask struct {
 	Tmdbid       int
 	Season       int
 	Episode      int
+	EpisodeEnd   int // last episode of a multi-episode file, 0 if single
 	Language     string
 }
 
@@ -73,7 +166,7 @@ type MoveToTrashTask struct {
 func BuildNewEpisodePath(tvEpTask *TvEpisodeRenameTask) (dir, path string, err error) {
 	ext := filepath.Ext(tvEpTask.OldPath)
 	seasonDir := BuildRelTvEpDirPath(tvEpTask.OriginalName, tvEpTask.Year, tvEpTask.Tmdbid, tvEpTask.Season)
-	epFile := BuildRelTvEpPath(tvEpTask.OriginalName, tvEpTask.Year, tvEpTask.Tmdbid, tvEpTask.Season, tvEpTask.Episode, ext)
+	epFile := BuildRelTvEpPath(tvEpTask.OriginalName, tvEpTask.Year, tvEpTask.Tmdbid, tvEpTask.Season, tvEpTask.Episode, tvEpTask.EpisodeEnd, ext)
 	return filepath.Join(tvEpTask.NewMotherDir, seasonDir), filepath.Join(tvEpTask.NewMotherDir, epFile), nil
 }
 
@@ -82,24 +175,34 @@ func BuildRelTvEpDirPath(originalName string, year, tmdbid, season int) string {
 	return fmt.Sprintf("%s (%d) [tmdbid-%d]/Season %d", originalName, year, tmdbid, season)
 }
 
-func BuildRelTvEpPath(originalName string, year, tmdbid, season, episode int, ext string) string {
+func BuildRelTvEpPath(originalName string, year, tmdbid, season, episode, episodeEnd int, ext string) string {
 	originalName = EscapeSpecialChars(originalName)
-	return fmt.Sprintf("%s (%d) [tmdbid-%d]/Season %d/S%02dE%02d%s", originalName, year, tmdbid, season, season, episode, ext)
+	return fmt.Sprintf("%s (%d) [tmdbid-%d]/Season %d/%s%s", originalName, year, tmdbid, season, BuildTvEpName(season, episode, episodeEnd), ext)
+}
+
+// BuildTvEpName returns S01E01, or S01E01-E02 of a multi-episode file as named by jellyfin and plex,
+// episodeEnd not after episode means a single episode
+func BuildTvEpName(season, episode, episodeEnd int) string {
+	if episodeEnd > episode {
+		return fmt.Sprintf("S%02dE%02d-E%02d", season, episode, episodeEnd)
+	}
+	return fmt.Sprintf("S%02dE%02d", season, episode)
 }
 
 func BuildNewTvSubtitlePath(tvSubTask *TvSubtitleRenameTask) (dir, path string, err error) {
 	ext := filepath.Ext(tvSubTask.OldPath)
 	seasonDir := BuildRelTvEpDirPath(tvSubTask.OriginalName, tvSubTask.Year, tvSubTask.Tmdbid, tvSubTask.Season)
-	subtileFile := BuildRelTvSubtitlePath(tvSubTask.OriginalName, tvSubTask.Year, tvSubTask.Tmdbid, tvSubTask.Season, tvSubTask.Episode, tvSubTask.Language, ext)
+	subtileFile := BuildRelTvSubtitlePath(tvSubTask.OriginalName, tvSubTask.Year, tvSubTask.Tmdbid, tvSubTask.Season, tvSubTask.Episode, tvSubTask.EpisodeEnd, tvSubTask.Language, ext)
 	return filepath.Join(tvSubTask.NewMotherDir, seasonDir), filepath.Join(tvSubTask.NewMotherDir, subtileFile), nil
 }
 
-func BuildRelTvSubtitlePath(originalName string, year, tmdbid, season, episode int, lang, ext string) string {
+func BuildRelTvSubtitlePath(originalName string, year, tmdbid, season, episode, episodeEnd int, lang, ext string) string {
 	originalName = EscapeSpecialChars(originalName)
+	epName := BuildTvEpName(season, episode, episodeEnd)
 	if lang == "" {
-		return fmt.Sprintf("%s (%d) [tmdbid-%d]/Season %d/S%02dE%02d%s", originalName, year, tmdbid, season, season, episode, ext)
+		return fmt.Sprintf("%s (%d) [tmdbid-%d]/Season %d/%s%s", originalName, year, tmdbid, season, epName, ext)
 	} else {
-		return fmt.Sprintf("%s (%d) [tmdbid-%d]/Season %d/S%02dE%02d.%s%s", originalName, year, tmdbid, season, season, episode, lang, ext)
+		return fmt.Sprintf("%s (%d) [tmdbid-%d]/Season %d/%s.%s%s", originalName, year, tmdbid, season, epName, lang, ext)
 	}
 }
 
@@ -168,6 +271,7 @@ func (d *DiskService) RenameTvEpisode(task *TvEpisodeRenameTask) error {
 	if err != nil {
 		return fmt.Errorf("BuildNewEpisodePath() error = %v", err)
 	}
+	defer d.targetLocks.lock(epFilePath)()
 	if !d.dryRunMode {
 		err = os.MkdirAll(seasonDir, motherDirMode)
 		if err != nil {
@@ -200,6 +304,7 @@ func (d *DiskService) RenameTvSubtitle(task *TvSubtitleRenameTask) error {
 	if err != nil {
 		return fmt.Errorf("BuildNewTvSubtitlePath() error = %v", err)
 	}
+	defer d.targetLocks.lock(subtitleFilePath)()
 	if !d.dryRunMode {
 		err := os.MkdirAll(seasonDir, motherDirMode)
 		if err != nil {
@@ -232,6 +337,7 @@ func (d *DiskService) RenameMovie(task *MovieRenameTask) error {
 	if err != nil {
 		return fmt.Errorf("BuildNewMovieDir() error = %v", err)
 	}
+	defer d.targetLocks.lock(movieFilePath)()
 	if !d.dryRunMode {
 		err := os.MkdirAll(movieDir, motherDirMode)
 		if err != nil {
@@ -264,6 +370,7 @@ func (d *DiskService) RenameMovieSubtitle(task *MovieSubtitleRenameTask) error {
 	if err != nil {
 		return fmt.Errorf("BuildNewMovieDir() error = %v", err)
 	}
+	defer d.targetLocks.lock(movieSubtitleFilePath)()
 	if !d.dryRunMode {
 		err := os.MkdirAll(movieDir, motherDirMode)
 		if err != nil {
@@ -293,6 +400,7 @@ func (d *DiskService) MoveToTrash(task *MoveToTrashTask) error {
 	defer old.Close()
 	oldBase := filepath.Base(task.Path)
 	trashTarget := filepath.Join(task.TrashDir, oldBase)
+	defer d.targetLocks.lock(trashTarget)()
 	if !d.dryRunMode {
 		if fileExists(trashTarget) {
 			return os.ErrExist
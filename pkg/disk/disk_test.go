@@ -52,6 +52,21 @@ func TestBuildTvEpTask(t *testing.T) {
 			wantSeasonDir: "path/to/mediabank/name1      name2 (2021) [tmdbid-123456789]/Season 2",
 			wantEpFile:    "path/to/mediabank/name1      name2 (2021) [tmdbid-123456789]/Season 2/S02E03.ext",
 		},
+		{
+			name: "multi episode",
+			tvEpTask: &TvEpisodeRenameTask{
+				OldPath:      "path/to/oldfile.ext",
+				NewMotherDir: "path/to/mediabank",
+				OriginalName: "original name",
+				Year:         2021,
+				Tmdbid:       123456789,
+				Season:       2,
+				Episode:      3,
+				EpisodeEnd:   4,
+			},
+			wantSeasonDir: "path/to/mediabank/original name (2021) [tmdbid-123456789]/Season 2",
+			wantEpFile:    "path/to/mediabank/original name (2021) [tmdbid-123456789]/Season 2/S02E03-E04.ext",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,287 @@
+package disk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"asmediamgr/pkg/common"
+)
+
+// RecoveryPolicy is how an unfinished journal is recovered on startup
+type RecoveryPolicy int
+
+const (
+	RecoverBack    RecoveryPolicy = iota // revert done ops, the entry is parsed again
+	RecoverForward                       // run pending ops, the entry is finished as planned
+	RecoverKeep                          // leave files and journal as they are, for manual recovery
+)
+
+func (p RecoveryPolicy) String() string {
+	switch p {
+	case RecoverBack:
+		return "back"
+	case RecoverForward:
+		return "forward"
+	case RecoverKeep:
+		return "keep"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseRecoveryPolicy parses "back", "forward" or "keep"
+func ParseRecoveryPolicy(str string) (RecoveryPolicy, error) {
+	for _, p := range []RecoveryPolicy{RecoverBack, RecoverForward, RecoverKeep} {
+		if p.String() == str {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid recovery policy %q, want back, forward or keep", str)
+}
+
+// JournalRecord is the intent of a multi-op plan, written before its first op and removed after its last op
+// the state of each op is not written, it is told by whether its old path or new path exists
+type JournalRecord struct {
+	Batch   string       `json:"batch"`
+	ScanDir string       `json:"scan_dir"`
+	Entry   string       `json:"entry"`
+	Parser  string       `json:"parser"`
+	Time    time.Time    `json:"time"`
+	Ops     []*JournalOp `json:"ops"`
+}
+
+// JournalOp is a single op of a journal record
+type JournalOp struct {
+	Seq          int    `json:"seq"` // index of the op in the plan
+	Op           string `json:"op"`
+	Tmdbid       int    `json:"tmdbid,omitempty"`
+	OldPath      string `json:"old_path"`
+	NewPath      string `json:"new_path"`
+	TargetRoot   string `json:"target_root"`
+	SkipExisting bool   `json:"skip_existing,omitempty"`
+	Optional     bool   `json:"optional,omitempty"`
+}
+
+type journalOpState int
+
+const (
+	opPending journalOpState = iota // old path only
+	opDone                          // new path only
+	opSkipped                       // both paths, the target existed before
+	opMissing                       // neither path
+)
+
+func (jo *JournalOp) state() journalOpState {
+	oldExisted, newExisted := fileExists(jo.OldPath), fileExists(jo.NewPath)
+	switch {
+	case oldExisted && !newExisted:
+		return opPending
+	case !oldExisted && newExisted:
+		return opDone
+	case oldExisted && newExisted:
+		return opSkipped
+	default:
+		return opMissing
+	}
+}
+
+func (jo *JournalOp) String() string {
+	return fmt.Sprintf("%s: %s -> %s", jo.Op, jo.OldPath, jo.NewPath)
+}
+
+func (jo *JournalOp) auditRecord(rec *JournalRecord, now time.Time, undone bool) *AuditRecord {
+	ret := &AuditRecord{
+		Time:       now,
+		Batch:      rec.Batch,
+		Seq:        jo.Seq,
+		ScanDir:    rec.ScanDir,
+		Entry:      rec.Entry,
+		Parser:     rec.Parser,
+		Op:         jo.Op,
+		Tmdbid:     jo.Tmdbid,
+		OldPath:    jo.OldPath,
+		NewPath:    jo.NewPath,
+		TargetRoot: jo.TargetRoot,
+		Undone:     undone,
+	}
+	if stat, err := os.Lstat(jo.NewPath); err == nil {
+		ret.IsDir, ret.Size, ret.ModTime = stat.IsDir(), stat.Size(), stat.ModTime()
+	}
+	return ret
+}
+
+// journal keeps a journal record file per running multi-op plan in dir
+type journal struct {
+	dir string
+}
+
+func newJournal(dir string) (*journal, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("MkdirAll() error = %v", err)
+	}
+	return &journal{dir: dir}, nil
+}
+
+func (j *journal) path(batch string) string {
+	return filepath.Join(j.dir, batch+".json")
+}
+
+func (j *journal) write(rec *JournalRecord) error {
+	content, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("MarshalIndent() error = %v", err)
+	}
+	return common.WriteFileAtomic(j.path(rec.Batch), content)
+}
+
+func (j *journal) read(batch string) (*JournalRecord, error) {
+	content, err := os.ReadFile(j.path(batch))
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile() error = %v", err)
+	}
+	rec := &JournalRecord{}
+	err = json.Unmarshal(content, rec)
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshal() journal %s error = %v", j.path(batch), err)
+	}
+	return rec, nil
+}
+
+func (j *journal) remove(batch string) error {
+	err := os.Remove(j.path(batch))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Remove() error = %v", err)
+	}
+	return nil
+}
+
+// unfinished returns batches of all journal records left, sorted
+func (j *journal) unfinished() ([]string, error) {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return nil, fmt.Errorf("ReadDir() error = %v", err)
+	}
+	var ret []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue // temp files of an interrupted write are removed by WriteFileAtomic or are garbage
+		}
+		ret = append(ret, strings.TrimSuffix(name, ".json"))
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// newJournalRecord builds the journal record of plan
+func newJournalRecord(plan *Plan, tag AuditTag, now time.Time) (*JournalRecord, error) {
+	rec := &JournalRecord{
+		Batch:   tag.Batch,
+		ScanDir: tag.ScanDir,
+		Entry:   tag.Entry,
+		Parser:  tag.Parser,
+		Time:    now,
+	}
+	for seq, op := range plan.Ops {
+		newPath, err := op.NewPath()
+		if err != nil {
+			return nil, err
+		}
+		rec.Ops = append(rec.Ops, &JournalOp{
+			Seq:          seq,
+			Op:           op.Type.String(),
+			Tmdbid:       op.Tmdbid(),
+			OldPath:      op.OldPath(),
+			NewPath:      newPath,
+			TargetRoot:   op.targetMotherDir(),
+			SkipExisting: op.SkipExisting,
+			Optional:     op.Optional,
+		})
+	}
+	return rec, nil
+}
+
+// rollBack reverts done ops of rec in reverse order, returns the audit records of reverted ops
+// it tries every op, and returns the joined errors of failed ones
+func rollBack(rec *JournalRecord, now time.Time) ([]*AuditRecord, error) {
+	var records []*AuditRecord
+	var errs []error
+	for i := len(rec.Ops) - 1; i >= 0; i-- {
+		jo := rec.Ops[i]
+		if jo.state() != opDone {
+			continue
+		}
+		auditRec := jo.auditRecord(rec, now, true)
+		err := revertRename(jo.OldPath, jo.NewPath, jo.TargetRoot)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("revert %s: %v", jo, err))
+			continue
+		}
+		records = append(records, auditRec)
+	}
+	return records, errors.Join(errs...)
+}
+
+// rollForward runs pending ops of rec in order, returns the audit records of ops run
+// it stops at the first failed op unless the op is optional
+func rollForward(rec *JournalRecord, now time.Time) ([]*AuditRecord, error) {
+	var records []*AuditRecord
+	for _, jo := range rec.Ops {
+		switch jo.state() {
+		case opDone, opSkipped:
+			continue
+		case opMissing:
+			if jo.Optional {
+				continue
+			}
+			return records, fmt.Errorf("%s: neither path existed", jo)
+		}
+		err := forwardRename(jo.OldPath, jo.NewPath, jo.TargetRoot)
+		if err != nil {
+			if jo.Optional {
+				continue
+			}
+			return records, fmt.Errorf("%s: %v", jo, err)
+		}
+		records = append(records, jo.auditRecord(rec, now, false))
+	}
+	return records, nil
+}
+
+// forwardRename renames oldPath to newPath, parents of newPath are created with the mode of targetRoot
+func forwardRename(oldPath, newPath, targetRoot string) error {
+	stat, err := os.Stat(targetRoot)
+	if err != nil {
+		return fmt.Errorf("Stat() error = %v", err)
+	}
+	err = os.MkdirAll(filepath.Dir(newPath), stat.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("MkdirAll() error = %v", err)
+	}
+	err = os.Rename(oldPath, newPath)
+	if err != nil {
+		return fmt.Errorf("Rename() error = %v", err)
+	}
+	return nil
+}
+
+// revertRename renames newPath back to oldPath, empty dirs left under targetRoot are removed
+func revertRename(oldPath, newPath, targetRoot string) error {
+	err := os.MkdirAll(filepath.Dir(oldPath), 0755)
+	if err != nil {
+		return fmt.Errorf("MkdirAll() error = %v", err)
+	}
+	err = os.Rename(newPath, oldPath)
+	if err != nil {
+		return fmt.Errorf("Rename() error = %v", err)
+	}
+	removeEmptyParents(filepath.Dir(newPath), targetRoot)
+	return nil
+}
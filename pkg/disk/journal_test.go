@@ -0,0 +1,150 @@
+package disk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func TestJournalRecover(t *testing.T) {
+	newEntry := func(t *testing.T) (srcDir string, plan *Plan) {
+		scanDir := t.TempDir()
+		targetDir := t.TempDir()
+		trashDir := t.TempDir()
+		srcDir = filepath.Join(scanDir, "show")
+		err := os.Mkdir(srcDir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan = &Plan{}
+		for episode := 1; episode <= 2; episode++ {
+			oldPath := filepath.Join(srcDir, fmt.Sprintf("ep%d.mkv", episode))
+			err := os.WriteFile(oldPath, []byte("content"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plan.AddTvEpisode(&TvEpisodeRenameTask{
+				OldPath:      oldPath,
+				NewMotherDir: targetDir,
+				OriginalName: "name",
+				Year:         2024,
+				Tmdbid:       1,
+				Season:       1,
+				Episode:      episode,
+			})
+		}
+		plan.AddMoveToTrash(&MoveToTrashTask{Path: srcDir, TrashDir: trashDir}).Optional = true
+		return srcDir, plan
+	}
+	// crashed after the first op
+	crash := func(t *testing.T, d *DiskService, plan *Plan) {
+		journalID, err := d.BeginPlan(plan, AuditTag{Batch: NewBatchID(time.Now()), Entry: "show"})
+		if err != nil || journalID == "" {
+			t.Fatalf("BeginPlan() got = %s, err = %v", journalID, err)
+		}
+		err = d.RenameTvEpisode(plan.Ops[0].TvEpisode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	newDiskService := func(t *testing.T, journalDir string) *DiskService {
+		d, err := NewDiskService(&DiskServiceOpts{Logger: log.NewNopLogger(), JournalDir: journalDir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	t.Run("back", func(t *testing.T) {
+		journalDir := t.TempDir()
+		srcDir, plan := newEntry(t)
+		crash(t, newDiskService(t, journalDir), plan)
+		records, err := newDiskService(t, journalDir).RecoverJournals(RecoverBack)
+		if err != nil || len(records) != 1 || !records[0].Undone {
+			t.Fatalf("RecoverJournals() got = %v, err = %v", records, err)
+		}
+		for _, name := range []string{"ep1.mkv", "ep2.mkv"} {
+			if !fileExists(filepath.Join(srcDir, name)) {
+				t.Fatalf("RecoverJournals() %s should be back", name)
+			}
+		}
+		if entries, _ := os.ReadDir(plan.Ops[0].TvEpisode.NewMotherDir); len(entries) != 0 {
+			t.Fatalf("RecoverJournals() should remove empty dirs in target root")
+		}
+		if entries, _ := os.ReadDir(journalDir); len(entries) != 0 {
+			t.Fatalf("RecoverJournals() should remove the journal")
+		}
+	})
+
+	t.Run("forward", func(t *testing.T) {
+		journalDir := t.TempDir()
+		srcDir, plan := newEntry(t)
+		crash(t, newDiskService(t, journalDir), plan)
+		records, err := newDiskService(t, journalDir).RecoverJournals(RecoverForward)
+		if err != nil || len(records) != 2 || records[0].Undone {
+			t.Fatalf("RecoverJournals() got = %v, err = %v", records, err)
+		}
+		for _, op := range plan.Ops {
+			newPath, _ := op.NewPath()
+			if !fileExists(newPath) {
+				t.Fatalf("RecoverJournals() %s should be done", newPath)
+			}
+		}
+		if fileExists(srcDir) {
+			t.Fatalf("RecoverJournals() %s should be trashed", srcDir)
+		}
+	})
+
+	t.Run("keep", func(t *testing.T) {
+		journalDir := t.TempDir()
+		_, plan := newEntry(t)
+		crash(t, newDiskService(t, journalDir), plan)
+		records, err := newDiskService(t, journalDir).RecoverJournals(RecoverKeep)
+		if err != nil || len(records) != 0 {
+			t.Fatalf("RecoverJournals() got = %v, err = %v", records, err)
+		}
+		if entries, _ := os.ReadDir(journalDir); len(entries) != 1 {
+			t.Fatalf("RecoverJournals() should keep the journal")
+		}
+	})
+
+	t.Run("failed plan", func(t *testing.T) {
+		journalDir := t.TempDir()
+		srcDir, plan := newEntry(t)
+		d := newDiskService(t, journalDir)
+		journalID, err := d.BeginPlan(plan, AuditTag{Batch: NewBatchID(time.Now()), Entry: "show"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = d.RenameTvEpisode(plan.Ops[0].TvEpisode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reverted, err := d.EndPlan(journalID, false)
+		if err != nil || len(reverted) != 1 {
+			t.Fatalf("EndPlan() got = %v, err = %v", reverted, err)
+		}
+		if !fileExists(filepath.Join(srcDir, "ep1.mkv")) {
+			t.Fatalf("EndPlan() failed plan should be rolled back")
+		}
+		if entries, _ := os.ReadDir(journalDir); len(entries) != 0 {
+			t.Fatalf("EndPlan() should remove the journal")
+		}
+	})
+}
+
+func TestParseRecoveryPolicy(t *testing.T) {
+	for _, p := range []RecoveryPolicy{RecoverBack, RecoverForward, RecoverKeep} {
+		got, err := ParseRecoveryPolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParseRecoveryPolicy(%s) got = %v, err = %v", p, got, err)
+		}
+	}
+	if _, err := ParseRecoveryPolicy("sideways"); err == nil {
+		t.Errorf("ParseRecoveryPolicy() invalid policy should fail")
+	}
+}
@@ -0,0 +1,45 @@
+package disk
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// pathLocker serializes disk operations on the same target path
+// Note: this struct is concurrent safe
+type pathLocker struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+type pathLock struct {
+	mu  sync.Mutex
+	ref int
+}
+
+func newPathLocker() *pathLocker {
+	return &pathLocker{locks: make(map[string]*pathLock)}
+}
+
+// lock locks path and returns the func to unlock it
+func (pl *pathLocker) lock(path string) (unlock func()) {
+	path = filepath.Clean(path)
+	pl.mu.Lock()
+	l, ok := pl.locks[path]
+	if !ok {
+		l = &pathLock{}
+		pl.locks[path] = l
+	}
+	l.ref++
+	pl.mu.Unlock()
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		pl.mu.Lock()
+		l.ref--
+		if l.ref == 0 {
+			delete(pl.locks, path)
+		}
+		pl.mu.Unlock()
+	}
+}
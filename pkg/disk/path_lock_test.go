@@ -0,0 +1,34 @@
+package disk
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestPathLocker(t *testing.T) {
+	pl := newPathLocker()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inside := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := pl.lock("path/to/../to/target")
+			defer unlock()
+			mu.Lock()
+			inside++
+			if inside != 1 {
+				t.Errorf("lock() %d callers inside at the same time", inside)
+			}
+			mu.Unlock()
+			mu.Lock()
+			inside--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if len(pl.locks) != 0 {
+		t.Fatalf("lock() got = %d locks left, want = 0", len(pl.locks))
+	}
+}
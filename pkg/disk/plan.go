@@ -0,0 +1,249 @@
+package disk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OpType is the type of a disk operation in a plan
+type OpType int
+
+const (
+	OpRenameTvEpisode OpType = iota
+	OpRenameTvSubtitle
+	OpRenameMovie
+	OpRenameMovieSubtitle
+	OpMoveToTrash
+)
+
+func (t OpType) String() string {
+	switch t {
+	case OpRenameTvEpisode:
+		return "rename tv episode"
+	case OpRenameTvSubtitle:
+		return "rename tv subtitle"
+	case OpRenameMovie:
+		return "rename movie"
+	case OpRenameMovieSubtitle:
+		return "rename movie subtitle"
+	case OpMoveToTrash:
+		return "move to trash"
+	default:
+		return "unknown"
+	}
+}
+
+// Op is a single disk operation of a plan, only the task of Type is set
+type Op struct {
+	Type          OpType
+	TvEpisode     *TvEpisodeRenameTask
+	TvSubtitle    *TvSubtitleRenameTask
+	Movie         *MovieRenameTask
+	MovieSubtitle *MovieSubtitleRenameTask
+	Trash         *MoveToTrashTask
+	SkipExisting  bool // skip the op instead of failing the plan if its target already existed
+	Optional      bool // failure of the op is only logged, never fails the plan
+}
+
+// OldPath returns the source path of the op
+func (op *Op) OldPath() string {
+	switch op.Type {
+	case OpRenameTvEpisode:
+		return op.TvEpisode.OldPath
+	case OpRenameTvSubtitle:
+		return op.TvSubtitle.OldPath
+	case OpRenameMovie:
+		return op.Movie.OldPath
+	case OpRenameMovieSubtitle:
+		return op.MovieSubtitle.OldPath
+	case OpMoveToTrash:
+		return op.Trash.Path
+	default:
+		return ""
+	}
+}
+
+// NewPath returns the target path of the op, built the same way as DiskService does
+func (op *Op) NewPath() (string, error) {
+	var path string
+	var err error
+	switch op.Type {
+	case OpRenameTvEpisode:
+		_, path, err = BuildNewEpisodePath(op.TvEpisode)
+	case OpRenameTvSubtitle:
+		_, path, err = BuildNewTvSubtitlePath(op.TvSubtitle)
+	case OpRenameMovie:
+		_, path, err = BuildNewMovieDir(op.Movie)
+	case OpRenameMovieSubtitle:
+		_, path, err = BuildNewMovieSubtitleDir(op.MovieSubtitle)
+	case OpMoveToTrash:
+		path = filepath.Join(op.Trash.TrashDir, filepath.Base(op.Trash.Path))
+	default:
+		err = fmt.Errorf("unknown op type %d", op.Type)
+	}
+	return path, err
+}
+
+// Tmdbid returns the tmdbid of the op, 0 for ops without one
+func (op *Op) Tmdbid() int {
+	switch op.Type {
+	case OpRenameTvEpisode:
+		return op.TvEpisode.Tmdbid
+	case OpRenameTvSubtitle:
+		return op.TvSubtitle.Tmdbid
+	case OpRenameMovie:
+		return op.Movie.Tmdbid
+	case OpRenameMovieSubtitle:
+		return op.MovieSubtitle.Tmdbid
+	default:
+		return 0
+	}
+}
+
+// targetMotherDir returns the dir the target path is built in
+func (op *Op) targetMotherDir() string {
+	switch op.Type {
+	case OpRenameTvEpisode:
+		return op.TvEpisode.NewMotherDir
+	case OpRenameTvSubtitle:
+		return op.TvSubtitle.NewMotherDir
+	case OpRenameMovie:
+		return op.Movie.NewMotherDir
+	case OpRenameMovieSubtitle:
+		return op.MovieSubtitle.NewMotherDir
+	case OpMoveToTrash:
+		return op.Trash.TrashDir
+	default:
+		return ""
+	}
+}
+
+func (op *Op) String() string {
+	newPath, err := op.NewPath()
+	if err != nil {
+		newPath = fmt.Sprintf("<%v>", err)
+	}
+	str := fmt.Sprintf("%s: %s -> %s", op.Type, op.OldPath(), newPath)
+	if op.SkipExisting {
+		str += " (skip existing)"
+	}
+	if op.Optional {
+		str += " (optional)"
+	}
+	return str
+}
+
+// Plan is the disk operations to run for an entry, in order
+type Plan struct {
+	Ops []*Op
+}
+
+func (p *Plan) AddTvEpisode(task *TvEpisodeRenameTask) *Op {
+	return p.add(&Op{Type: OpRenameTvEpisode, TvEpisode: task})
+}
+
+func (p *Plan) AddTvSubtitle(task *TvSubtitleRenameTask) *Op {
+	return p.add(&Op{Type: OpRenameTvSubtitle, TvSubtitle: task})
+}
+
+func (p *Plan) AddMovie(task *MovieRenameTask) *Op {
+	return p.add(&Op{Type: OpRenameMovie, Movie: task})
+}
+
+func (p *Plan) AddMovieSubtitle(task *MovieSubtitleRenameTask) *Op {
+	return p.add(&Op{Type: OpRenameMovieSubtitle, MovieSubtitle: task})
+}
+
+func (p *Plan) AddMoveToTrash(task *MoveToTrashTask) *Op {
+	return p.add(&Op{Type: OpMoveToTrash, Trash: task})
+}
+
+func (p *Plan) add(op *Op) *Op {
+	p.Ops = append(p.Ops, op)
+	return op
+}
+
+func (p *Plan) String() string {
+	var sb strings.Builder
+	for i, op := range p.Ops {
+		sb.WriteString(fmt.Sprintf("  %d. %s\n", i+1, op))
+	}
+	return sb.String()
+}
+
+const (
+	maxNameBytes = 255  // max bytes of a single path component on common filesystems
+	maxPathBytes = 4096 // max bytes of a whole path on linux
+)
+
+// ValidatePlan checks the whole plan before any op runs, so an invalid plan never leaves an entry half-moved,
+// it checks sources existed, target collisions, path length and that every source is in the filesystem of its
+// target dir, ops are run by rename, which never copies, so a plan across filesystems would fail partway
+// problems of optional ops are ignored here, they are reported when the op runs
+func ValidatePlan(plan *Plan) error {
+	if plan == nil || len(plan.Ops) == 0 {
+		return fmt.Errorf("empty plan")
+	}
+	targets := make(map[string]*Op)
+	for _, op := range plan.Ops {
+		if op.Optional {
+			continue
+		}
+		newPath, err := op.NewPath()
+		if err != nil {
+			return fmt.Errorf("%s: %v", op.Type, err)
+		}
+		err = checkPathLength(newPath)
+		if err != nil {
+			return fmt.Errorf("%s: %v", op.Type, err)
+		}
+		_, err = os.Stat(op.OldPath())
+		if err != nil {
+			return fmt.Errorf("%s: source: %v", op.Type, err)
+		}
+		if other, ok := targets[newPath]; ok {
+			return fmt.Errorf("target collision: %s and %s -> %s", other.OldPath(), op.OldPath(), newPath)
+		}
+		targets[newPath] = op
+		if fileExists(newPath) {
+			if op.SkipExisting {
+				continue
+			}
+			return fmt.Errorf("%s: target %s already existed", op.Type, newPath)
+		}
+		motherDir := op.targetMotherDir()
+		if !sameDevice(op.OldPath(), existingAncestor(motherDir)) {
+			return fmt.Errorf("%s: %s is not in the filesystem of target dir %s, moves across filesystems are not supported",
+				op.Type, op.OldPath(), motherDir)
+		}
+	}
+	return nil
+}
+
+// existingAncestor returns dir or its nearest existing parent, target dirs are created only when ops run
+func existingAncestor(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+func checkPathLength(path string) error {
+	if len(path) > maxPathBytes {
+		return fmt.Errorf("path too long, %d bytes: %s", len(path), path)
+	}
+	for _, name := range strings.Split(filepath.ToSlash(path), "/") {
+		if len(name) > maxNameBytes {
+			return fmt.Errorf("name too long, %d bytes: %s", len(name), name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidatePlanCrossDevice(t *testing.T) {
+	srcDir := t.TempDir()
+	const otherFs = "/dev/shm"
+	if _, err := os.Stat(otherFs); err != nil || sameDevice(srcDir, otherFs) {
+		t.Skipf("no filesystem other than the one of %s", srcDir)
+	}
+	targetDir, err := os.MkdirTemp(otherFs, "plan")
+	if err != nil {
+		t.Skipf("MkdirTemp() error = %v", err)
+	}
+	defer os.RemoveAll(targetDir)
+	err = os.WriteFile(filepath.Join(srcDir, "ep1.mkv"), []byte("content"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &Plan{}
+	plan.AddTvEpisode(&TvEpisodeRenameTask{
+		OldPath:      filepath.Join(srcDir, "ep1.mkv"),
+		NewMotherDir: targetDir,
+		OriginalName: "name",
+		Year:         2024,
+		Tmdbid:       1,
+		Season:       1,
+		Episode:      1,
+	})
+	if err := ValidatePlan(plan); err == nil || !strings.Contains(err.Error(), "filesystem") {
+		t.Fatalf("ValidatePlan() error = %v, want across filesystems", err)
+	}
+}
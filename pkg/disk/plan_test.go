@@ -0,0 +1,90 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidatePlan(t *testing.T) {
+	srcDir := t.TempDir()
+	targetDir := t.TempDir()
+	for _, name := range []string{"ep1.mkv", "ep2.mkv"} {
+		err := os.WriteFile(filepath.Join(srcDir, name), []byte("content"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	newEpisodeTask := func(name string, episode int) *TvEpisodeRenameTask {
+		return &TvEpisodeRenameTask{
+			OldPath:      filepath.Join(srcDir, name),
+			NewMotherDir: targetDir,
+			OriginalName: "name",
+			Year:         2024,
+			Tmdbid:       1,
+			Season:       1,
+			Episode:      episode,
+		}
+	}
+
+	if err := ValidatePlan(&Plan{}); err == nil {
+		t.Fatalf("ValidatePlan() empty plan should fail")
+	}
+
+	plan := &Plan{}
+	plan.AddTvEpisode(newEpisodeTask("ep1.mkv", 1))
+	plan.AddTvEpisode(newEpisodeTask("ep2.mkv", 2))
+	plan.AddMoveToTrash(&MoveToTrashTask{Path: filepath.Join(srcDir, "not_existed"), TrashDir: targetDir}).Optional = true
+	if err := ValidatePlan(plan); err != nil {
+		t.Fatalf("ValidatePlan() error = %v", err)
+	}
+
+	plan = &Plan{}
+	plan.AddTvEpisode(newEpisodeTask("ep1.mkv", 1))
+	plan.AddTvEpisode(newEpisodeTask("ep2.mkv", 1))
+	if err := ValidatePlan(plan); err == nil || !strings.Contains(err.Error(), "collision") {
+		t.Fatalf("ValidatePlan() error = %v, want collision", err)
+	}
+
+	plan = &Plan{}
+	plan.AddTvEpisode(newEpisodeTask("not_existed.mkv", 1))
+	if err := ValidatePlan(plan); err == nil {
+		t.Fatalf("ValidatePlan() missing source should fail")
+	}
+
+	plan = &Plan{}
+	op := plan.AddTvEpisode(newEpisodeTask("ep1.mkv", 1))
+	newPath, _ := op.NewPath()
+	err := os.MkdirAll(filepath.Dir(newPath), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(newPath, []byte("content"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidatePlan(plan); err == nil {
+		t.Fatalf("ValidatePlan() existing target should fail")
+	}
+	op.SkipExisting = true
+	if err := ValidatePlan(plan); err != nil {
+		t.Fatalf("ValidatePlan() skip existing error = %v", err)
+	}
+
+	plan = &Plan{}
+	task := newEpisodeTask("ep1.mkv", 1)
+	task.OriginalName = strings.Repeat("a", maxNameBytes)
+	plan.AddTvEpisode(task)
+	if err := ValidatePlan(plan); err == nil || !strings.Contains(err.Error(), "too long") {
+		t.Fatalf("ValidatePlan() error = %v, want too long", err)
+	}
+
+	plan = &Plan{}
+	task = newEpisodeTask("ep1.mkv", 1)
+	task.NewMotherDir = filepath.Join(targetDir, "not_created", "tv")
+	plan.AddTvEpisode(task)
+	if err := ValidatePlan(plan); err != nil {
+		t.Fatalf("ValidatePlan() target dir not created yet error = %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package identify
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"asmediamgr/pkg/common"
+)
+
+// Candidate is a single tmdb search result to be scored
+type Candidate struct {
+	ID            int
+	Title         string
+	OriginalTitle string
+	AltTitles     []string
+	Year          int // 0 if unknown
+	Popularity    float32
+}
+
+// Score is the score breakdown of a candidate, every part is in [0, 1]
+type Score struct {
+	Candidate  *Candidate
+	Title      float64 // best similarity among title, original title and alternative titles
+	Year       float64 // year closeness, 0 if the query has no year
+	Popularity float64 // popularity relative to the most popular candidate, in log scale
+	Total      float64 // weighted sum of all parts
+}
+
+func (s *Score) String() string {
+	return fmt.Sprintf("%s-%d(title=%.2f year=%.2f pop=%.2f total=%.2f)", s.Candidate.Title, s.Candidate.ID, s.Title, s.Year, s.Popularity, s.Total)
+}
+
+const (
+	titleWeight      = 0.6
+	yearWeight       = 0.25
+	popularityWeight = 0.15
+	altTitlesTopN    = 3 // alternative titles are only loaded for top candidates
+	logTopN          = 3 // score breakdown of top candidates is logged
+	ambiguousTopN    = 5 // top candidates kept in AmbiguousError for review
+)
+
+// ErrNoCandidate is returned if tmdb found nothing to pick from
+var ErrNoCandidate = errors.New("no candidate")
+
+// AmbiguousError is returned if no candidate is confident enough, it keeps top candidates for review
+type AmbiguousError struct {
+	MediaType common.MediaType // media type searched, set by SearchMovie and SearchTv
+	Query     Query
+	Total     int      // number of candidates
+	Scores    []*Score // top candidates sorted by total score descending
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("ambiguous, %d candidates, top: %v", e.Total, topScores(e.Scores))
+}
+
+// Opts is the acceptance policy of the best candidate
+type Opts struct {
+	MinScore float64 // best candidate total score must be at least MinScore
+	Margin   float64 // best candidate total score must lead the second by at least Margin
+}
+
+var (
+	// DefaultOpts is the default acceptance policy
+	DefaultOpts = Opts{MinScore: 0.6, Margin: 0.1}
+
+	optsMu sync.RWMutex
+	opts   = DefaultOpts
+)
+
+// SetOpts sets the acceptance policy used by all parsers
+// Note: this function is concurrent safe
+func SetOpts(o Opts) {
+	optsMu.Lock()
+	defer optsMu.Unlock()
+	opts = o
+}
+
+// GetOpts returns the acceptance policy used by all parsers
+// Note: this function is concurrent safe
+func GetOpts() Opts {
+	optsMu.RLock()
+	defer optsMu.RUnlock()
+	return opts
+}
+
+// Query is what is scraped from an entry
+type Query struct {
+	Name string
+	Year int // 0 if unknown
+}
+
+// AltTitlesFunc loads alternative titles of a candidate
+type AltTitlesFunc func(id int) ([]string, error)
+
+// Pick scores candidates and returns the best one if it is confident enough, a single candidate is always accepted
+// alternative titles of top candidates are loaded by altTitles only if the first round is not confident,
+// altTitles can be nil
+func Pick(query Query, candidates []*Candidate, altTitles AltTitlesFunc, o Opts, logger log.Logger) (*Candidate, error) {
+	if len(candidates) == 0 {
+		return nil, ErrNoCandidate
+	}
+	scores := scoreAll(query, candidates)
+	if len(candidates) == 1 {
+		logScores(logger, query, scores, "accepted, single candidate")
+		return candidates[0], nil
+	}
+	if best, ok := confident(scores, o); ok {
+		logScores(logger, query, scores, "accepted")
+		return best, nil
+	}
+	if altTitles != nil {
+		for i := 0; i < altTitlesTopN && i < len(scores); i++ {
+			candidate := scores[i].Candidate
+			titles, err := altTitles(candidate.ID)
+			if err != nil {
+				level.Warn(logger).Log("msg", "failed to load alternative titles", "id", candidate.ID, "err", err)
+				continue
+			}
+			candidate.AltTitles = titles
+		}
+		scores = scoreAll(query, candidates)
+		if best, ok := confident(scores, o); ok {
+			logScores(logger, query, scores, "accepted with alternative titles")
+			return best, nil
+		}
+	}
+	logScores(logger, query, scores, "ambiguous")
+	if len(scores) > ambiguousTopN {
+		scores = scores[:ambiguousTopN]
+	}
+	return nil, &AmbiguousError{Query: query, Total: len(candidates), Scores: scores}
+}
+
+func confident(scores []*Score, o Opts) (*Candidate, bool) {
+	best := scores[0]
+	if best.Total < o.MinScore {
+		return nil, false
+	}
+	if len(scores) > 1 && best.Total-scores[1].Total < o.Margin {
+		return nil, false
+	}
+	return best.Candidate, true
+}
+
+// scoreAll returns scores of candidates sorted by total score descending
+func scoreAll(query Query, candidates []*Candidate) []*Score {
+	var maxPopularity float32
+	for _, candidate := range candidates {
+		if candidate.Popularity > maxPopularity {
+			maxPopularity = candidate.Popularity
+		}
+	}
+	normQuery := Normalize(query.Name)
+	scores := make([]*Score, 0, len(candidates))
+	for _, candidate := range candidates {
+		score := &Score{Candidate: candidate}
+		for _, title := range append([]string{candidate.Title, candidate.OriginalTitle}, candidate.AltTitles...) {
+			if sim := Similarity(normQuery, Normalize(title)); sim > score.Title {
+				score.Title = sim
+			}
+		}
+		score.Year = yearCloseness(query.Year, candidate.Year)
+		if maxPopularity > 0 && candidate.Popularity > 0 {
+			score.Popularity = math.Log1p(float64(candidate.Popularity)) / math.Log1p(float64(maxPopularity))
+		}
+		score.Total = titleWeight*score.Title + yearWeight*score.Year + popularityWeight*score.Popularity
+		scores = append(scores, score)
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Total > scores[j].Total
+	})
+	return scores
+}
+
+func yearCloseness(queryYear, year int) float64 {
+	if queryYear <= common.ValidStartYear || year <= common.ValidStartYear {
+		return 0
+	}
+	switch diff := queryYear - year; {
+	case diff == 0:
+		return 1
+	case diff == 1 || diff == -1:
+		return 0.5
+	default:
+		return 0
+	}
+}
+
+func topScores(scores []*Score) []*Score {
+	if len(scores) > logTopN {
+		return scores[:logTopN]
+	}
+	return scores
+}
+
+func logScores(logger log.Logger, query Query, scores []*Score, result string) {
+	level.Info(logger).Log("msg", "identify", "name", query.Name, "year", query.Year, "result", result, "candidates", len(scores), "top", fmt.Sprint(topScores(scores)))
+}
+
+// Normalize lowers title, drops punctuation and collapses spaces, so titles can be compared
+func Normalize(title string) string {
+	title = strings.ReplaceAll(strings.ToLower(title), "&", " and ")
+	var sb strings.Builder
+	space := false
+	for _, r := range title {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && sb.Len() > 0 {
+				sb.WriteByte(' ')
+			}
+			space = false
+			sb.WriteRune(r)
+			continue
+		}
+		if r == '\'' || r == '’' {
+			continue // "Don't" and "Dont" are the same
+		}
+		space = true
+	}
+	return strings.TrimPrefix(sb.String(), "the ")
+}
+
+// Similarity returns 1 minus the normalized levenshtein distance of a and b in runes, in [0, 1]
+func Similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	maxLen := len(ra)
+	if len(rb) > maxLen {
+		maxLen = len(rb)
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(maxLen)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,91 @@
+package identify
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"The Lord of the Rings: The Fellowship", "lord of the rings the fellowship"},
+		{"Tom & Jerry", "tom and jerry"},
+		{"Don't  Look-Up!", "dont look up"},
+		{"进击的巨人", "进击的巨人"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.title); got != tt.want {
+			t.Errorf("Normalize(%s) got = %q, want = %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	if got := Similarity("dune", "dune"); got != 1 {
+		t.Fatalf("Similarity() got = %v, want = 1", got)
+	}
+	if got := Similarity("dune", "dunes"); got != 0.8 {
+		t.Fatalf("Similarity() got = %v, want = 0.8", got)
+	}
+	if got := Similarity("", "dune"); got != 0 {
+		t.Fatalf("Similarity() got = %v, want = 0", got)
+	}
+}
+
+func TestPick(t *testing.T) {
+	logger := log.NewNopLogger()
+	candidates := []*Candidate{
+		{ID: 1, Title: "Dune", Year: 1984, Popularity: 30},
+		{ID: 2, Title: "Dune", Year: 2021, Popularity: 200},
+		{ID: 3, Title: "Dune: Part Two", Year: 2024, Popularity: 300},
+	}
+	best, err := Pick(Query{Name: "Dune", Year: 2021}, candidates, nil, DefaultOpts, logger)
+	if err != nil {
+		t.Fatalf("Pick() error = %v", err)
+	}
+	if best.ID != 2 {
+		t.Fatalf("Pick() got = %d, want = 2", best.ID)
+	}
+
+	candidates = []*Candidate{
+		{ID: 1, Title: "Dune", Year: 1984, Popularity: 30},
+		{ID: 2, Title: "Dune", Year: 2021, Popularity: 30},
+	}
+	_, err = Pick(Query{Name: "Dune"}, candidates, nil, DefaultOpts, logger)
+	if err == nil {
+		t.Fatalf("Pick() same title without year should be ambiguous")
+	}
+
+	best, err = Pick(Query{Name: "whatever"}, candidates[:1], nil, DefaultOpts, logger)
+	if err != nil || best.ID != 1 {
+		t.Fatalf("Pick() single candidate got = %v, %v", best, err)
+	}
+}
+
+func TestPickAltTitles(t *testing.T) {
+	candidates := []*Candidate{
+		{ID: 1, Title: "Attack on Titan", OriginalTitle: "進撃の巨人", Popularity: 100},
+		{ID: 2, Title: "Attack on Titan: Junior High", OriginalTitle: "進撃!巨人中学校", Popularity: 100},
+	}
+	altTitles := func(id int) ([]string, error) {
+		if id == 1 {
+			return []string{"进击的巨人"}, nil
+		}
+		return nil, fmt.Errorf("not found")
+	}
+	_, err := Pick(Query{Name: "进击的巨人"}, candidates, nil, DefaultOpts, log.NewNopLogger())
+	if err == nil {
+		t.Fatalf("Pick() without alternative titles should be ambiguous")
+	}
+	best, err := Pick(Query{Name: "进击的巨人"}, candidates, altTitles, DefaultOpts, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Pick() error = %v", err)
+	}
+	if best.ID != 1 {
+		t.Fatalf("Pick() got = %d, want = 1", best.ID)
+	}
+}
@@ -0,0 +1,161 @@
+package identify
+
+import (
+	"fmt"
+	"strconv"
+
+	tmdb "github.com/cyruzin/golang-tmdb"
+	"github.com/go-kit/log"
+
+	"asmediamgr/pkg/common"
+)
+
+// TmdbSearcher is the part of tmdb service needed to identify a movie or a tv
+type TmdbSearcher interface {
+	GetSearchMovies(query string, urlOptions map[string]string) (*tmdb.SearchMovies, error)
+	GetMovieAlternativeTitles(id int, urlOptions map[string]string) (*tmdb.MovieAlternativeTitles, error)
+	GetSearchTVShow(query string, urlOptions map[string]string) (*tmdb.SearchTVShows, error)
+	GetTVAlternativeTitles(id int, urlOptions map[string]string) (*tmdb.TVAlternativeTitles, error)
+}
+
+func searchOpts(year int) map[string]string {
+	urlOptions := common.CopyUrlOptions(common.DefaultTmdbSearchOpts)
+	if year > common.ValidStartYear {
+		urlOptions["year"] = strconv.Itoa(year)
+	}
+	return urlOptions
+}
+
+// yearOf returns year of a tmdb date string, 0 if invalid
+func yearOf(tmdbDateStr string) int {
+	dt, err := common.ParseTmdbDateStr(tmdbDateStr)
+	if err != nil {
+		return 0
+	}
+	return dt.Year
+}
+
+// SearchMovie searches tmdb for name and returns tmdbid of the best scored movie
+func SearchMovie(searcher TmdbSearcher, name string, year int, logger log.Logger) (tmdbid int, err error) {
+	results, err := searcher.GetSearchMovies(name, searchOpts(year))
+	if err != nil {
+		return 0, err
+	}
+	if results.SearchMoviesResults == nil || len(results.Results) == 0 {
+		return 0, fmt.Errorf("no movie found, name = %s, year = %d, %w", name, year, ErrNoCandidate)
+	}
+	var candidates []*Candidate
+	for _, result := range results.Results {
+		candidates = append(candidates, &Candidate{
+			ID:            int(result.ID),
+			Title:         result.Title,
+			OriginalTitle: result.OriginalTitle,
+			Year:          yearOf(result.ReleaseDate),
+			Popularity:    result.Popularity,
+		})
+	}
+	altTitles := func(id int) ([]string, error) {
+		titles, err := searcher.GetMovieAlternativeTitles(id, nil)
+		if err != nil {
+			return nil, err
+		}
+		var ret []string
+		for _, title := range titles.Titles {
+			ret = append(ret, title.Title)
+		}
+		return ret, nil
+	}
+	best, err := Pick(Query{Name: name, Year: year}, candidates, altTitles, GetOpts(), logger)
+	if err != nil {
+		setMediaType(err, common.MediaTypeMovie)
+		return 0, fmt.Errorf("movie name = %s, year = %d, %w", name, year, err)
+	}
+	return best.ID, nil
+}
+
+// SearchTv searches tmdb for name and returns tmdbid of the best scored tv
+func SearchTv(searcher TmdbSearcher, name string, year int, logger log.Logger) (tmdbid int, err error) {
+	results, err := searcher.GetSearchTVShow(name, searchOpts(year))
+	if err != nil {
+		return 0, err
+	}
+	if results.SearchTVShowsResults == nil || len(results.Results) == 0 {
+		return 0, fmt.Errorf("no tv found, name = %s, year = %d, %w", name, year, ErrNoCandidate)
+	}
+	var candidates []*Candidate
+	for _, result := range results.Results {
+		candidates = append(candidates, &Candidate{
+			ID:            int(result.ID),
+			Title:         result.Name,
+			OriginalTitle: result.OriginalName,
+			Year:          yearOf(result.FirstAirDate),
+			Popularity:    result.Popularity,
+		})
+	}
+	altTitles := func(id int) ([]string, error) {
+		titles, err := searcher.GetTVAlternativeTitles(id, nil)
+		if err != nil {
+			return nil, err
+		}
+		if titles.TVAlternativeTitlesResults == nil {
+			return nil, nil
+		}
+		var ret []string
+		for _, title := range titles.Results {
+			ret = append(ret, title.Title)
+		}
+		return ret, nil
+	}
+	best, err := Pick(Query{Name: name, Year: year}, candidates, altTitles, GetOpts(), logger)
+	if err != nil {
+		setMediaType(err, common.MediaTypeTv)
+		return 0, fmt.Errorf("tv name = %s, year = %d, %w", name, year, err)
+	}
+	return best.ID, nil
+}
+
+func setMediaType(err error, mediaType common.MediaType) {
+	if ambiguousErr, ok := err.(*AmbiguousError); ok {
+		ambiguousErr.MediaType = mediaType
+	}
+}
+
+// MultiSearcher is the part of tmdb service needed to identify an entry of unknown media type
+type MultiSearcher interface {
+	GetSearchMulti(query string, urlOptions map[string]string) (*tmdb.SearchMulti, error)
+}
+
+// SearchMulti searches tmdb movies and tvs for name at once and returns the media type and tmdbid of the best scored one
+// alternative titles are not loaded, ids of a movie and a tv may be the same
+func SearchMulti(searcher MultiSearcher, name string, year int, logger log.Logger) (mediaType common.MediaType, tmdbid int, err error) {
+	results, err := searcher.GetSearchMulti(name, common.CopyUrlOptions(common.DefaultTmdbSearchOpts))
+	if err != nil {
+		return 0, 0, err
+	}
+	var candidates []*Candidate
+	mediaTypes := make(map[*Candidate]common.MediaType)
+	if results.SearchMultiResults != nil {
+		for _, result := range results.Results {
+			candidate := &Candidate{ID: int(result.ID), Popularity: result.Popularity}
+			switch result.MediaType {
+			case "movie":
+				candidate.Title, candidate.OriginalTitle, candidate.Year = result.Title, result.OriginalTitle, yearOf(result.ReleaseDate)
+				mediaTypes[candidate] = common.MediaTypeMovie
+			case "tv":
+				candidate.Title, candidate.OriginalTitle, candidate.Year = result.Name, result.OriginalName, yearOf(result.FirstAirDate)
+				mediaTypes[candidate] = common.MediaTypeTv
+			default:
+				continue // person
+			}
+			candidates = append(candidates, candidate)
+		}
+	}
+	if len(candidates) == 0 {
+		return 0, 0, fmt.Errorf("no movie or tv found, name = %s, year = %d, %w", name, year, ErrNoCandidate)
+	}
+	best, err := Pick(Query{Name: name, Year: year}, candidates, nil, GetOpts(), logger)
+	if err != nil {
+		return 0, 0, fmt.Errorf("multi name = %s, year = %d, %w", name, year, err)
+	}
+	return mediaTypes[best], best.ID, nil
+}
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+
+	"asmediamgr/pkg/common"
+)
+
+const (
+	// AbsoluteFileName is the per-show absolute episode mapping file in the parser config dir
+	AbsoluteFileName = "absolute.toml"
+)
+
+// AbsoluteMapping maps absolute episodes From to To of a tv to season Season from episode Episode,
+// for shows whose tmdb seasons do not add up to the absolute numbering of releases
+type AbsoluteMapping struct {
+	Tmdbid  int `toml:"tmdbid"`
+	From    int `toml:"from"`    // first absolute episode
+	To      int `toml:"to"`      // last absolute episode, 0 means no end
+	Season  int `toml:"season"`  // season of From
+	Episode int `toml:"episode"` // episode of From in season, 0 means 1
+}
+
+type absoluteConfig struct {
+	Mappings []*AbsoluteMapping `toml:"mappings"`
+}
+
+// AbsoluteEpisodes maps absolute episode numbers, such as One Piece - 1085, to tmdb seasons and episodes,
+// the mappings of AbsoluteFileName win over episode counts of tmdb seasons, season 0 specials are never counted
+// a nil AbsoluteEpisodes maps by tmdb only
+type AbsoluteEpisodes struct {
+	mappings []*AbsoluteMapping
+}
+
+// Map returns season and episode of the absolute episode of tv tmdbid
+func (a *AbsoluteEpisodes) Map(tmdbService TmdbService, tmdbid, absolute int) (season, episode int, err error) {
+	if absolute <= 0 {
+		return -1, -1, fmt.Errorf("invalid absolute episode %d", absolute)
+	}
+	if a != nil {
+		for _, m := range a.mappings {
+			if m.Tmdbid != tmdbid || absolute < m.From || (m.To != 0 && absolute > m.To) {
+				continue
+			}
+			first := m.Episode
+			if first == 0 {
+				first = 1
+			}
+			return m.Season, first + absolute - m.From, nil
+		}
+	}
+	detail, err := tmdbService.GetTVDetails(tmdbid, common.DefaultTmdbSearchOpts)
+	if err != nil {
+		return -1, -1, fmt.Errorf("get tv detail of tmdbid = %d, error = %v", tmdbid, err)
+	}
+	type seasonCount struct{ season, count int }
+	var seasons []seasonCount
+	for _, s := range detail.Seasons {
+		if s.SeasonNumber > 0 {
+			seasons = append(seasons, seasonCount{s.SeasonNumber, s.EpisodeCount})
+		}
+	}
+	sort.Slice(seasons, func(i, j int) bool { return seasons[i].season < seasons[j].season })
+	passed := 0
+	for _, s := range seasons {
+		if absolute > passed+s.count {
+			passed += s.count
+			continue
+		}
+		// some seasons keep the absolute numbering on tmdb, so the episode number is taken from the season itself
+		seasonDetail, err := tmdbService.GetTVSeasonDetails(tmdbid, s.season, common.DefaultTmdbSearchOpts)
+		if err != nil {
+			return -1, -1, fmt.Errorf("get season %d of tmdbid = %d, error = %v", s.season, tmdbid, err)
+		}
+		i := absolute - passed - 1
+		if i >= len(seasonDetail.Episodes) {
+			return -1, -1, fmt.Errorf("absolute episode %d is episode %d of season %d, tmdbid = %d, but the season has %d episodes",
+				absolute, i+1, s.season, tmdbid, len(seasonDetail.Episodes))
+		}
+		return s.season, seasonDetail.Episodes[i].EpisodeNumber, nil
+	}
+	return -1, -1, fmt.Errorf("absolute episode %d is beyond %d episodes of tmdbid = %d", absolute, passed, tmdbid)
+}
+
+// loadAbsoluteEpisodes loads and checks the absolute mapping file, a missing file means no mappings
+func loadAbsoluteEpisodes(path string) (*AbsoluteEpisodes, error) {
+	cfg := &absoluteConfig{}
+	_, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &AbsoluteEpisodes{}, nil
+		}
+		return nil, fmt.Errorf("DecodeFile() error = %v", err)
+	}
+	for i, m := range cfg.Mappings {
+		if m.Tmdbid <= 0 || m.From <= 0 || m.Season <= 0 || m.Episode < 0 {
+			return nil, fmt.Errorf("mapping %d: tmdbid, from and season must be positive", i)
+		}
+		if m.To != 0 && m.To < m.From {
+			return nil, fmt.Errorf("mapping %d: to %d is before from %d", i, m.To, m.From)
+		}
+	}
+	return &AbsoluteEpisodes{mappings: cfg.Mappings}, nil
+}
+
+func (pm *ParserMgr) absoluteEpisodes() *AbsoluteEpisodes {
+	pm.overridesMu.RLock()
+	defer pm.overridesMu.RUnlock()
+	return pm.absolute
+}
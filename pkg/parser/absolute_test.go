@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"asmediamgr/pkg/parser/fakes"
+)
+
+// absoluteTmdbService is a tv of specials and two seasons of 3 episodes, the second one is numbered absolutely
+// on tmdb and has only 2 episodes aired
+func absoluteTmdbService(t *testing.T) *fakes.FakeTmdbService {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tmdb.json")
+	err := os.WriteFile(path, []byte(`{
+		"tv": {"1": {"id": 1, "seasons": [
+			{"season_number": 2, "episode_count": 3},
+			{"season_number": 0, "episode_count": 5},
+			{"season_number": 1, "episode_count": 3}
+		]}},
+		"tv_season": {"1": {
+			"1": {"episodes": [{"episode_number": 1}, {"episode_number": 2}, {"episode_number": 3}]},
+			"2": {"episodes": [{"episode_number": 4}, {"episode_number": 5}]}
+		}}
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := fakes.LoadFakeTmdbService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAbsoluteEpisodesMap(t *testing.T) {
+	tmdbService := absoluteTmdbService(t)
+	absolute := &AbsoluteEpisodes{mappings: []*AbsoluteMapping{
+		{Tmdbid: 1, From: 7, To: 8, Season: 3},
+		{Tmdbid: 2, From: 1, Season: 9, Episode: 5},
+	}}
+	tests := []struct {
+		absolute *AbsoluteEpisodes
+		tmdbid   int
+		episode  int
+		season   int
+		want     int
+		wantErr  bool
+	}{
+		{absolute: absolute, tmdbid: 1, episode: 2, season: 1, want: 2},
+		{absolute: absolute, tmdbid: 1, episode: 4, season: 2, want: 4},
+		{absolute: absolute, tmdbid: 1, episode: 5, season: 2, want: 5},
+		{absolute: absolute, tmdbid: 1, episode: 6, wantErr: true}, // counted by the tv, not aired in the season
+		{absolute: absolute, tmdbid: 1, episode: 8, season: 3, want: 2},
+		{absolute: absolute, tmdbid: 1, episode: 9, wantErr: true},
+		{absolute: absolute, tmdbid: 2, episode: 100, season: 9, want: 104},
+		{absolute: nil, tmdbid: 1, episode: 3, season: 1, want: 3},
+		{absolute: nil, tmdbid: 1, episode: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		season, episode, err := tt.absolute.Map(tmdbService, tt.tmdbid, tt.episode)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("Map() tmdbid = %d, episode = %d, error = %v, wantErr = %v", tt.tmdbid, tt.episode, err, tt.wantErr)
+		}
+		if err == nil && (season != tt.season || episode != tt.want) {
+			t.Errorf("Map() tmdbid = %d, episode = %d, got = S%dE%d, want = S%dE%d", tt.tmdbid, tt.episode, season, episode, tt.season, tt.want)
+		}
+	}
+}
+
+func TestLoadAbsoluteEpisodes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, AbsoluteFileName)
+	absolute, err := loadAbsoluteEpisodes(path)
+	if err != nil || absolute == nil || len(absolute.mappings) != 0 {
+		t.Fatalf("loadAbsoluteEpisodes() missing file got = %v, %v", absolute, err)
+	}
+	err = os.WriteFile(path, []byte("[[mappings]]\ntmdbid = 37854\nfrom = 1086\nseason = 22\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	absolute, err = loadAbsoluteEpisodes(path)
+	if err != nil || len(absolute.mappings) != 1 || absolute.mappings[0].From != 1086 {
+		t.Fatalf("loadAbsoluteEpisodes() got = %v, %v", absolute, err)
+	}
+	for _, content := range []string{
+		"[[mappings]]\nfrom = 1\nseason = 1\n",
+		"[[mappings]]\ntmdbid = 1\nfrom = 10\nto = 5\nseason = 1\n",
+		"[[mappings]]\ntmdbid = 1\nfrom = 1\n",
+		"invalid toml [",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadAbsoluteEpisodes(path); err == nil {
+			t.Errorf("loadAbsoluteEpisodes() %q should fail", content)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+var (
+	// ErrScanDirNotFound is returned by admin operations on a scan dir not being run
+	ErrScanDirNotFound = errors.New("scan dir not found")
+	// ErrScanDirPaused is returned by admin operations that need to run entries of a paused scan dir
+	ErrScanDirPaused = errors.New("scan dir paused")
+	// ErrScanDirBusy is returned if the command queue of a scan dir is full
+	ErrScanDirBusy = errors.New("scan dir busy, too many pending commands")
+)
+
+type dirCmdType int
+
+const (
+	cmdRunNow       dirCmdType = iota // reset the backoff of entry and run it right away
+	cmdResetBackoff                   // reset the backoff of entry, it is run at the next scan
+	cmdRescan                         // start the next full scan right away
+)
+
+// dirCmd is a command to the goroutine of a scan dir, handled between scans
+// doNextTime is only touched by that goroutine, so every change to it goes through a command
+type dirCmd struct {
+	typ   dirCmdType
+	entry string
+}
+
+// ScanDirState is the state of a scan dir, entries are as of the last saved state
+type ScanDirState struct {
+	ScanDir string        `json:"scan_dir"`
+	Paused  bool          `json:"paused"`
+	Entries []*EntryState `json:"entries"`
+}
+
+// EntryState is the backoff state of an entry
+type EntryState struct {
+	Entry     string    `json:"entry"`
+	FailCnt   int32     `json:"fail_cnt"`
+	ValidTime time.Time `json:"valid_time"` // entry is not run before this time
+	LastErr   string    `json:"last_err,omitempty"`
+}
+
+// cmdChan returns the command channel of scanDir, nil if scanDir is not being run
+func (pm *ParserMgr) cmdChan(scanDir string) chan dirCmd {
+	pm.dirsMu.Lock()
+	defer pm.dirsMu.Unlock()
+	return pm.cmds[scanDir]
+}
+
+func (pm *ParserMgr) isPaused(scanDir string) bool {
+	pm.dirsMu.Lock()
+	defer pm.dirsMu.Unlock()
+	return pm.paused[scanDir]
+}
+
+// sendCmd queues cmd to the goroutine of scanDir without blocking
+func (pm *ParserMgr) sendCmd(scanDir string, cmd dirCmd) error {
+	cmds := pm.cmdChan(scanDir)
+	if cmds == nil {
+		return ErrScanDirNotFound
+	}
+	select {
+	case cmds <- cmd:
+		return nil
+	default:
+		return ErrScanDirBusy
+	}
+}
+
+// handleCmd handles a command in the goroutine of scanDir, returns true if the next full scan should start right away
+func (pm *ParserMgr) handleCmd(ctx context.Context, scanDir string, cmd dirCmd, events *dirEvents, doNextTime map[string]*failNextTime, settle *settleTracker, opts *ParserMgrRunOpts) (rescan bool) {
+	switch cmd.typ {
+	case cmdRunNow:
+		if pm.isPaused(scanDir) {
+			return false // run at the next scan after resume
+		}
+		pm.runChangedEntry(ctx, scanDir, cmd.entry, events, doNextTime, settle, opts)
+	case cmdResetBackoff:
+		level.Info(pm.logger).Log("msg", "entry backoff reset", "scanDir", scanDir, "entry", cmd.entry)
+		delete(doNextTime, cmd.entry)
+	case cmdRescan:
+		return true
+	}
+	pm.saveState(scanDir, doNextTime)
+	return false
+}
+
+// ScanDirStates returns the state of all scan dirs being run, sorted by scan dir
+// Note: this function is concurrent safe
+func (pm *ParserMgr) ScanDirStates() []*ScanDirState {
+	pm.dirsMu.Lock()
+	var ret []*ScanDirState
+	for scanDir := range pm.cmds {
+		ret = append(ret, &ScanDirState{ScanDir: scanDir, Paused: pm.paused[scanDir]})
+	}
+	pm.dirsMu.Unlock()
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ScanDir < ret[j].ScanDir })
+	for _, dirState := range ret {
+		dirState.Entries = []*EntryState{}
+		for name, record := range pm.state.load(dirState.ScanDir) {
+			dirState.Entries = append(dirState.Entries, &EntryState{
+				Entry:     name,
+				FailCnt:   record.FailCnt,
+				ValidTime: record.ValidTime,
+				LastErr:   record.LastErr,
+			})
+		}
+		sort.Slice(dirState.Entries, func(i, j int) bool { return dirState.Entries[i].Entry < dirState.Entries[j].Entry })
+	}
+	return ret
+}
+
+// RetryEntry resets the backoff of an entry and runs it right away
+// Note: this function is concurrent safe
+func (pm *ParserMgr) RetryEntry(scanDir, entryName string) error {
+	if pm.isPaused(scanDir) {
+		return ErrScanDirPaused
+	}
+	err := pm.sendCmd(scanDir, dirCmd{typ: cmdRunNow, entry: entryName})
+	if err != nil {
+		return err
+	}
+	level.Info(pm.logger).Log("msg", "entry retry requested", "scanDir", scanDir, "entry", entryName)
+	return nil
+}
+
+// ResetBackoff resets the backoff of an entry, it is run at the next scan
+// Note: this function is concurrent safe
+func (pm *ParserMgr) ResetBackoff(scanDir, entryName string) error {
+	return pm.sendCmd(scanDir, dirCmd{typ: cmdResetBackoff, entry: entryName})
+}
+
+// PauseScanDir stops running entries of scanDir until it is resumed, in-flight entries are finished,
+// entries of the running pass not dispatched yet are skipped
+// Note: this function is concurrent safe
+func (pm *ParserMgr) PauseScanDir(scanDir string) error {
+	return pm.setPaused(scanDir, true)
+}
+
+// ResumeScanDir resumes a paused scanDir and starts a full scan right away
+// Note: this function is concurrent safe
+func (pm *ParserMgr) ResumeScanDir(scanDir string) error {
+	err := pm.setPaused(scanDir, false)
+	if err != nil {
+		return err
+	}
+	err = pm.sendCmd(scanDir, dirCmd{typ: cmdRescan})
+	if errors.Is(err, ErrScanDirBusy) {
+		return nil // scanned at the next interval
+	}
+	return err
+}
+
+func (pm *ParserMgr) setPaused(scanDir string, paused bool) error {
+	pm.dirsMu.Lock()
+	defer pm.dirsMu.Unlock()
+	if _, ok := pm.cmds[scanDir]; !ok {
+		return fmt.Errorf("%w: %s", ErrScanDirNotFound, scanDir)
+	}
+	pm.paused[scanDir] = paused
+	level.Info(pm.logger).Log("msg", "scanDir paused changed", "scanDir", scanDir, "paused", paused)
+	return nil
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func TestAdminCmds(t *testing.T) {
+	state, err := newStateStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &ParserMgr{
+		logger: log.NewNopLogger(),
+		state:  state,
+		cmds:   map[string]chan dirCmd{"downloads": make(chan dirCmd, 1)},
+		paused: make(map[string]bool),
+	}
+	doNextTime := map[string]*failNextTime{
+		"a": {ValidTime: time.Now().Add(time.Hour), FailCnt: 3, LastErr: "no match"},
+		"b": {ValidTime: time.Now().Add(time.Hour), FailCnt: 1},
+	}
+	pm.saveState("downloads", doNextTime)
+
+	states := pm.ScanDirStates()
+	if len(states) != 1 || len(states[0].Entries) != 2 || states[0].Entries[0].Entry != "a" || states[0].Entries[0].FailCnt != 3 {
+		t.Fatalf("ScanDirStates() got = %+v", states)
+	}
+	if err := pm.RetryEntry("other", "a"); !errors.Is(err, ErrScanDirNotFound) {
+		t.Fatalf("RetryEntry() unknown scan dir error = %v", err)
+	}
+
+	if err := pm.ResetBackoff("downloads", "a"); err != nil {
+		t.Fatalf("ResetBackoff() error = %v", err)
+	}
+	if err := pm.ResetBackoff("downloads", "b"); !errors.Is(err, ErrScanDirBusy) {
+		t.Fatalf("ResetBackoff() full queue error = %v", err)
+	}
+	cmd := <-pm.cmds["downloads"]
+	if rescan := pm.handleCmd(context.Background(), "downloads", cmd, nil, doNextTime, nil, &ParserMgrRunOpts{}); rescan {
+		t.Fatalf("handleCmd() reset should not rescan")
+	}
+	if _, ok := doNextTime["a"]; ok {
+		t.Fatalf("handleCmd() reset should drop the record")
+	}
+	if states := pm.ScanDirStates(); len(states[0].Entries) != 1 {
+		t.Fatalf("ScanDirStates() after reset got = %d entries, want = 1", len(states[0].Entries))
+	}
+
+	if err := pm.PauseScanDir("downloads"); err != nil {
+		t.Fatalf("PauseScanDir() error = %v", err)
+	}
+	if err := pm.RetryEntry("downloads", "b"); !errors.Is(err, ErrScanDirPaused) {
+		t.Fatalf("RetryEntry() paused error = %v", err)
+	}
+	if err := pm.ResumeScanDir("downloads"); err != nil {
+		t.Fatalf("ResumeScanDir() error = %v", err)
+	}
+	cmd = <-pm.cmds["downloads"]
+	if rescan := pm.handleCmd(context.Background(), "downloads", cmd, nil, doNextTime, nil, &ParserMgrRunOpts{}); !rescan {
+		t.Fatalf("handleCmd() resume should rescan")
+	}
+	if states := pm.ScanDirStates(); states[0].Paused {
+		t.Fatalf("ScanDirStates() after resume should not be paused")
+	}
+}
@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	dataLockFileName = "asmediamgr.lock"
+)
+
+// ErrDataDirLocked is returned by RunParsers and RunOnce if another process runs on the same data dir
+var ErrDataDirLocked = errors.New("data dir locked by another process")
+
+// lockDataDir takes an exclusive lock on dataDir, so journals and state are never recovered or written
+// by two processes at once, it fails fast if the lock is held, release unlocks it, an empty dataDir is not locked
+func lockDataDir(dataDir string) (release func(), err error) {
+	if dataDir == "" {
+		return func() {}, nil
+	}
+	path := filepath.Join(dataDir, dataLockFileName)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("OpenFile() error = %v", err)
+	}
+	locked, err := tryLockFile(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s, error = %v", path, err)
+	}
+	if !locked {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s", ErrDataDirLocked, path)
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
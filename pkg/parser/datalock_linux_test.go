@@ -0,0 +1,31 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestLockDataDir(t *testing.T) {
+	dataDir := t.TempDir()
+	release, err := lockDataDir(dataDir)
+	if err != nil {
+		t.Fatalf("lockDataDir() error = %v", err)
+	}
+	pm := &ParserMgr{logger: log.NewNopLogger(), dataDir: dataDir}
+	opts := &ParserMgrRunOpts{ScanDirs: []string{t.TempDir()}}
+	if _, err := pm.RunOnce(context.Background(), opts, ""); !errors.Is(err, ErrDataDirLocked) {
+		t.Fatalf("RunOnce() locked data dir error = %v", err)
+	}
+	if err := pm.RunParsers(context.Background(), opts); !errors.Is(err, ErrDataDirLocked) {
+		t.Fatalf("RunParsers() locked data dir error = %v", err)
+	}
+	release()
+	release, err = lockDataDir(dataDir)
+	if err != nil {
+		t.Fatalf("lockDataDir() after release error = %v", err)
+	}
+	release()
+}
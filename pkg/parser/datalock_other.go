@@ -0,0 +1,14 @@
+//go:build !linux
+
+package parser
+
+import (
+	"os"
+)
+
+// tryLockFile is not supported on this platform, the data dir is never locked
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(f *os.File) {}
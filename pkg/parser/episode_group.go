@@ -0,0 +1,32 @@
+package parser
+
+import (
+	"fmt"
+
+	"asmediamgr/pkg/common"
+)
+
+// MapEpisodeGroup maps season and episode in the ordering of tmdb episode group groupId of tv tmdbid
+// to the default tmdb season and episode, season is the order of a group and episode is 1 based in the group
+func MapEpisodeGroup(tmdbService TmdbService, tmdbid int, groupId string, season, episode int) (defaultSeason, defaultEpisode int, err error) {
+	detail, err := tmdbService.GetTVEpisodeGroupsDetails(groupId, common.DefaultTmdbSearchOpts)
+	if err != nil {
+		return -1, -1, fmt.Errorf("get episode group %s, error = %v", groupId, err)
+	}
+	for _, group := range detail.Groups {
+		if group.Order != season {
+			continue
+		}
+		for _, ep := range group.Episodes {
+			if ep.Order+1 != episode {
+				continue
+			}
+			if ep.ShowID != int64(tmdbid) {
+				return -1, -1, fmt.Errorf("episode group %s is of tmdbid = %d, not %d", groupId, ep.ShowID, tmdbid)
+			}
+			return ep.SeasonNumber, ep.EpisodeNumber, nil
+		}
+		return -1, -1, fmt.Errorf("no episode %d in group %q of episode group %s", episode, group.Name, groupId)
+	}
+	return -1, -1, fmt.Errorf("no group of order %d in episode group %s", season, groupId)
+}
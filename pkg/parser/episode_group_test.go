@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"asmediamgr/pkg/parser/fakes"
+)
+
+func TestMapEpisodeGroup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tmdb.json")
+	err := os.WriteFile(path, []byte(`{
+		"tv_episode_group": {"group": {"id": "group", "groups": [
+			{"name": "Part 1", "order": 1, "episodes": [
+				{"show_id": 1, "season_number": 1, "episode_number": 1, "order": 0},
+				{"show_id": 1, "season_number": 1, "episode_number": 2, "order": 1}
+			]},
+			{"name": "Part 2", "order": 2, "episodes": [
+				{"show_id": 1, "season_number": 1, "episode_number": 3, "order": 0},
+				{"show_id": 1, "season_number": 2, "episode_number": 1, "order": 1}
+			]}
+		]}}
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmdbService, err := fakes.LoadFakeTmdbService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		tmdbid      int
+		groupId     string
+		season      int
+		episode     int
+		wantSeason  int
+		wantEpisode int
+		wantErr     bool
+	}{
+		{tmdbid: 1, groupId: "group", season: 1, episode: 2, wantSeason: 1, wantEpisode: 2},
+		{tmdbid: 1, groupId: "group", season: 2, episode: 1, wantSeason: 1, wantEpisode: 3},
+		{tmdbid: 1, groupId: "group", season: 2, episode: 2, wantSeason: 2, wantEpisode: 1},
+		{tmdbid: 1, groupId: "group", season: 2, episode: 3, wantErr: true},
+		{tmdbid: 1, groupId: "group", season: 3, episode: 1, wantErr: true},
+		{tmdbid: 2, groupId: "group", season: 1, episode: 1, wantErr: true},
+		{tmdbid: 1, groupId: "unknown", season: 1, episode: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		season, episode, err := MapEpisodeGroup(tmdbService, tt.tmdbid, tt.groupId, tt.season, tt.episode)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("MapEpisodeGroup() %s S%dE%d, error = %v, wantErr = %v", tt.groupId, tt.season, tt.episode, err, tt.wantErr)
+		}
+		if err == nil && (season != tt.wantSeason || episode != tt.wantEpisode) {
+			t.Errorf("MapEpisodeGroup() %s S%dE%d, got = S%dE%d, want = S%dE%d", tt.groupId, tt.season, tt.episode, season, episode, tt.wantSeason, tt.wantEpisode)
+		}
+	}
+}
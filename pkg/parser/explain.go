@@ -0,0 +1,302 @@
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	tmdb "github.com/cyruzin/golang-tmdb"
+
+	"asmediamgr/pkg/dirinfo"
+	"asmediamgr/pkg/disk"
+)
+
+// Trace records how a parser handles an entry, patterns tried, groups extracted and tmdb queries
+// all methods do nothing on a nil Trace, so parsers call them unconditionally
+// Note: this struct is concurrent safe
+type Trace struct {
+	mu     sync.Mutex
+	lines  []string
+	groups map[string]string
+}
+
+// Logf records a line
+func (t *Trace) Logf(format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines = append(t.lines, fmt.Sprintf(format, args...))
+}
+
+// Match records the result of matching re against str, groups is the result of re.FindStringSubmatch(str)
+func (t *Trace) Match(what string, re *regexp.Regexp, str string, groups []string) {
+	if t == nil {
+		return
+	}
+	if len(groups) == 0 {
+		t.Logf("%s %q on %q: no match", what, re, str)
+		return
+	}
+	var named []string
+	t.mu.Lock()
+	if t.groups == nil {
+		t.groups = make(map[string]string)
+	}
+	for i, name := range re.SubexpNames() {
+		if i == 0 || name == "" {
+			continue
+		}
+		named = append(named, fmt.Sprintf("%s=%q", name, groups[i]))
+		t.groups[name] = groups[i]
+	}
+	t.mu.Unlock()
+	t.Logf("%s %q on %q: matched %s", what, re, str, strings.Join(named, " "))
+}
+
+// Groups returns the named groups of all matches recorded, a group matched more than once keeps the last value
+func (t *Trace) Groups() map[string]string {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ret := make(map[string]string, len(t.groups))
+	for name, value := range t.groups {
+		ret[name] = value
+	}
+	return ret
+}
+
+// Lines returns the recorded lines in order
+func (t *Trace) Lines() []string {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.lines...)
+}
+
+// TmdbService returns s with every query and its results recorded, s itself if t is nil
+func (t *Trace) TmdbService(s TmdbService) TmdbService {
+	if t == nil {
+		return s
+	}
+	return &tracedTmdbService{TmdbService: s, trace: t}
+}
+
+const (
+	traceTmdbTopN = 5 // search results recorded per query
+)
+
+type tracedTmdbService struct {
+	TmdbService
+	trace *Trace
+}
+
+func (s *tracedTmdbService) GetSearchMovies(query string, urlOptions map[string]string) (*tmdb.SearchMovies, error) {
+	results, err := s.TmdbService.GetSearchMovies(query, urlOptions)
+	if err != nil {
+		s.trace.Logf("tmdb search movie %q %v: error = %v", query, urlOptions, err)
+		return results, err
+	}
+	total := 0
+	if results.SearchMoviesResults != nil {
+		total = len(results.Results)
+	}
+	s.trace.Logf("tmdb search movie %q %v: %d results", query, urlOptions, total)
+	for i := 0; i < total && i < traceTmdbTopN; i++ {
+		result := results.Results[i]
+		s.trace.Logf("  %d %q original %q released %s popularity %.1f", result.ID, result.Title, result.OriginalTitle, result.ReleaseDate, result.Popularity)
+	}
+	return results, nil
+}
+
+func (s *tracedTmdbService) GetMovieDetails(id int, urlOptions map[string]string) (*tmdb.MovieDetails, error) {
+	detail, err := s.TmdbService.GetMovieDetails(id, urlOptions)
+	if err != nil {
+		s.trace.Logf("tmdb movie %d: error = %v", id, err)
+		return detail, err
+	}
+	s.trace.Logf("tmdb movie %d: %q original %q released %s", id, detail.Title, detail.OriginalTitle, detail.ReleaseDate)
+	return detail, nil
+}
+
+func (s *tracedTmdbService) GetSearchTVShow(query string, urlOptions map[string]string) (*tmdb.SearchTVShows, error) {
+	results, err := s.TmdbService.GetSearchTVShow(query, urlOptions)
+	if err != nil {
+		s.trace.Logf("tmdb search tv %q %v: error = %v", query, urlOptions, err)
+		return results, err
+	}
+	total := 0
+	if results.SearchTVShowsResults != nil {
+		total = len(results.Results)
+	}
+	s.trace.Logf("tmdb search tv %q %v: %d results", query, urlOptions, total)
+	for i := 0; i < total && i < traceTmdbTopN; i++ {
+		result := results.Results[i]
+		s.trace.Logf("  %d %q original %q first aired %s popularity %.1f", result.ID, result.Name, result.OriginalName, result.FirstAirDate, result.Popularity)
+	}
+	return results, nil
+}
+
+func (s *tracedTmdbService) GetTVDetails(id int, urlOptions map[string]string) (*tmdb.TVDetails, error) {
+	detail, err := s.TmdbService.GetTVDetails(id, urlOptions)
+	if err != nil {
+		s.trace.Logf("tmdb tv %d: error = %v", id, err)
+		return detail, err
+	}
+	s.trace.Logf("tmdb tv %d: %q original %q first aired %s", id, detail.Name, detail.OriginalName, detail.FirstAirDate)
+	return detail, nil
+}
+
+func (s *tracedTmdbService) GetTVSeasonDetails(id, seasonNumber int, urlOptions map[string]string) (*tmdb.TVSeasonDetails, error) {
+	detail, err := s.TmdbService.GetTVSeasonDetails(id, seasonNumber, urlOptions)
+	if err != nil {
+		s.trace.Logf("tmdb tv %d season %d: error = %v", id, seasonNumber, err)
+		return detail, err
+	}
+	s.trace.Logf("tmdb tv %d season %d: %d episodes", id, seasonNumber, len(detail.Episodes))
+	return detail, nil
+}
+
+func (s *tracedTmdbService) GetTVEpisodeGroupsDetails(id string, urlOptions map[string]string) (*tmdb.TVEpisodeGroupsDetails, error) {
+	detail, err := s.TmdbService.GetTVEpisodeGroupsDetails(id, urlOptions)
+	if err != nil {
+		s.trace.Logf("tmdb episode group %s: error = %v", id, err)
+		return detail, err
+	}
+	s.trace.Logf("tmdb episode group %s: %q, %d groups", id, detail.Name, len(detail.Groups))
+	return detail, nil
+}
+
+func (s *tracedTmdbService) GetSearchMulti(query string, urlOptions map[string]string) (*tmdb.SearchMulti, error) {
+	results, err := s.TmdbService.GetSearchMulti(query, urlOptions)
+	if err != nil {
+		s.trace.Logf("tmdb search multi %q %v: error = %v", query, urlOptions, err)
+		return results, err
+	}
+	total := 0
+	if results.SearchMultiResults != nil {
+		total = len(results.Results)
+	}
+	s.trace.Logf("tmdb search multi %q %v: %d results", query, urlOptions, total)
+	for i := 0; i < total && i < traceTmdbTopN; i++ {
+		result := results.Results[i]
+		s.trace.Logf("  %s %d %q original %q released %s%s popularity %.1f", result.MediaType, result.ID, result.Title+result.Name,
+			result.OriginalTitle+result.OriginalName, result.ReleaseDate, result.FirstAirDate, result.Popularity)
+	}
+	return results, nil
+}
+
+// ParserExplanation is how a single parser handled the entry
+type ParserExplanation struct {
+	Parser string
+	Trace  []string   // lines recorded by the parser
+	Plan   *disk.Plan // nil if not matched
+	Err    error
+}
+
+// Explanation is how every enabled parser handles an entry, nothing is run
+type Explanation struct {
+	ScanDir  string
+	Entry    *dirinfo.Entry
+	Override *Override // manual match of the entry, nil if none
+	Parsers  []*ParserExplanation
+	Chosen   string // parser whose plan would be run, empty if none
+}
+
+func (e *Explanation) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("entry: %s\n", filepath.Join(e.ScanDir, e.Entry.Name())))
+	typ := "file"
+	if e.Entry.Type == dirinfo.DirEntry {
+		typ = "dir"
+	}
+	sb.WriteString(fmt.Sprintf("type: %s, %d files\n", typ, len(e.Entry.FileList)))
+	for _, file := range e.Entry.FileList {
+		sb.WriteString(fmt.Sprintf("  %s (%d bytes)\n", file.RelPathToMother, file.BytesNum))
+	}
+	if e.Override != nil {
+		sb.WriteString(fmt.Sprintf("override: %s, tmdbid %d\n", e.Override, e.Override.Tmdbid))
+	}
+	for _, pe := range e.Parsers {
+		result := "no match"
+		switch {
+		case pe.Err != nil:
+			result = fmt.Sprintf("error = %v", pe.Err)
+		case pe.Plan != nil:
+			result = "matched"
+		}
+		if pe.Parser == e.Chosen {
+			result += ", chosen"
+		}
+		sb.WriteString(fmt.Sprintf("\nparser %s: %s\n", pe.Parser, result))
+		for _, line := range pe.Trace {
+			sb.WriteString("  " + line + "\n")
+		}
+		if pe.Plan != nil {
+			sb.WriteString("  plan:\n")
+			for _, op := range pe.Plan.Ops {
+				sb.WriteString("    " + op.String() + "\n")
+			}
+		}
+	}
+	if e.Chosen == "" {
+		sb.WriteString("\nno parser would run the entry\n")
+	}
+	return sb.String()
+}
+
+// Explain runs every enabled parser of the scan dir of path on the entry at path, in priority order,
+// and records how each one handles it, plans are validated but never run
+// path must be an entry of a configured scan dir, so the explanation is what the daemon would do
+// parsers after the first match are still run, so a lower priority match shows up too
+func (pm *ParserMgr) Explain(opts *ParserMgrRunOpts, path string) (*Explanation, error) {
+	scanDir, ok := findScanDir(opts.ScanDirs, filepath.Dir(path))
+	if !ok {
+		return nil, errNotInScanDirs(path, opts.ScanDirs)
+	}
+	opts = opts.forScanDir(scanDir)
+	entry, err := dirinfo.ScanEntry(scanDir, filepath.Base(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan entry: %v", err)
+	}
+	explanation := &Explanation{
+		ScanDir:  scanDir,
+		Entry:    entry,
+		Override: pm.entryOverride(entry),
+	}
+	opts.Override = explanation.Override
+	opts.Absolute = pm.absoluteEpisodes()
+	stopped := false // runEntry stops at the first match or error
+	for _, parserInfo := range pm.parsersFor(opts) {
+		parserOpts := *opts
+		parserOpts.Trace = &Trace{}
+		plan, err := pm.parseEntry(entry, parserInfo, &parserOpts)
+		if err == nil && plan != nil {
+			err = disk.ValidatePlan(plan)
+			if err != nil {
+				err = fmt.Errorf("invalid plan: %v", err)
+			}
+		}
+		if err != nil {
+			plan = nil
+		}
+		explanation.Parsers = append(explanation.Parsers, &ParserExplanation{
+			Parser: parserInfo.name,
+			Trace:  parserOpts.Trace.Lines(),
+			Plan:   plan,
+			Err:    err,
+		})
+		if !stopped && plan != nil {
+			explanation.Chosen = parserInfo.name
+		}
+		stopped = stopped || plan != nil || err != nil
+	}
+	return explanation, nil
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	tmdb "github.com/cyruzin/golang-tmdb"
+	"github.com/go-kit/log"
+
+	"asmediamgr/pkg/dirinfo"
+	"asmediamgr/pkg/disk"
+	"asmediamgr/pkg/parser/fakes"
+)
+
+// traceParser matches dirs named like "Name.2020" and looks up tmdbid 1, moving the dir to trash
+type traceParser struct {
+	trashDir string
+	tmdb     TmdbService
+}
+
+var traceParserPattern = regexp.MustCompile(`^(?P<name>.+)\.(?P<year>\d{4})$`)
+
+func (p *traceParser) IsDefaultEnable() bool {
+	return true
+}
+
+func (p *traceParser) Init(cfgPath string, logger log.Logger) (priority float32, err error) {
+	return 0, nil
+}
+
+func (p *traceParser) Parse(entry *dirinfo.Entry, opts *ParserMgrRunOpts) (plan *disk.Plan, err error) {
+	groups := traceParserPattern.FindStringSubmatch(entry.Name())
+	opts.Trace.Match("pattern", traceParserPattern, entry.Name(), groups)
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	_, err = opts.Trace.TmdbService(p.tmdb).GetMovieDetails(1, nil)
+	if err != nil {
+		return nil, err
+	}
+	plan = &disk.Plan{}
+	plan.AddMoveToTrash(&disk.MoveToTrashTask{Path: filepath.Join(entry.MotherPath, entry.Name()), TrashDir: p.trashDir})
+	return plan, nil
+}
+
+func TestExplain(t *testing.T) {
+	scanDir, trashDir := t.TempDir(), t.TempDir()
+	for _, name := range []string{"a", "Movie.2020"} {
+		err := os.Mkdir(filepath.Join(scanDir, name), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	review, err := newReviewQueue("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmdbService := fakes.NewFakeTmdbService(fakes.WithMovieIdMapping(1, &tmdb.MovieDetails{
+		Title:         "Movie",
+		OriginalTitle: "Original Movie",
+		ReleaseDate:   "2020-01-02",
+	}))
+	pm := &ParserMgr{
+		logger: log.NewNopLogger(),
+		parsers: []parserInfo{
+			{name: "trace", parser: &traceParser{trashDir: trashDir, tmdb: tmdbService}},
+			{name: "trash", parser: &trashParser{trashDir: trashDir}},
+		},
+		review: review,
+	}
+	opts := &ParserMgrRunOpts{ScanDirs: []string{scanDir}}
+
+	explanation, err := pm.Explain(opts, filepath.Join(scanDir, "Movie.2020"))
+	if err != nil {
+		t.Fatalf("Explain() error = %v", err)
+	}
+	if explanation.Chosen != "trace" || len(explanation.Parsers) != 2 {
+		t.Fatalf("Explain() got = %s", explanation)
+	}
+	traced := explanation.Parsers[0]
+	if traced.Plan == nil || len(traced.Trace) != 2 {
+		t.Fatalf("Explain() trace parser got = %s", explanation)
+	}
+	if !strings.Contains(traced.Trace[0], `name="Movie" year="2020"`) || !strings.Contains(traced.Trace[1], `"Original Movie"`) {
+		t.Errorf("Explain() trace got = %v", traced.Trace)
+	}
+	if explanation.Parsers[1].Plan != nil {
+		t.Errorf("Explain() trash parser should not match, got = %s", explanation)
+	}
+	if !strings.Contains(explanation.String(), filepath.Join(trashDir, "Movie.2020")) {
+		t.Errorf("Explain() should print target paths, got = %s", explanation)
+	}
+	if _, err := os.Stat(filepath.Join(scanDir, "Movie.2020")); err != nil {
+		t.Errorf("Explain() should not run the plan, err = %v", err)
+	}
+
+	explanation, err = pm.Explain(opts, filepath.Join(scanDir, "a"))
+	if err != nil {
+		t.Fatalf("Explain() error = %v", err)
+	}
+	if explanation.Chosen != "trash" || !strings.Contains(explanation.Parsers[0].Trace[0], "no match") {
+		t.Errorf("Explain() got = %s", explanation)
+	}
+
+	if _, err := pm.Explain(opts, filepath.Join(scanDir, "c")); err == nil {
+		t.Errorf("Explain() missing entry should fail")
+	}
+	if _, err := pm.Explain(opts, filepath.Join(t.TempDir(), "a")); !errors.Is(err, ErrScanDirNotFound) {
+		t.Errorf("Explain() entry of an unconfigured dir error = %v", err)
+	}
+}
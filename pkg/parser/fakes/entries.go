@@ -0,0 +1,39 @@
+package fakes
+
+import (
+	"path/filepath"
+
+	"asmediamgr/pkg/common"
+	"asmediamgr/pkg/dirinfo"
+)
+
+// FileEntry returns a file entry of name in scan dir "scan"
+func FileEntry(name string) *dirinfo.Entry {
+	return &dirinfo.Entry{
+		Type:       dirinfo.FileEntry,
+		MotherPath: "scan",
+		FileList:   []*dirinfo.File{{RelPathToMother: name, Name: name, Ext: filepath.Ext(name)}},
+	}
+}
+
+// DirEntry returns a dir entry of name in scan dir "scan", files are relative to the dir
+func DirEntry(name string, files ...string) *dirinfo.Entry {
+	entry := &dirinfo.Entry{Type: dirinfo.DirEntry, MyDirPath: name, MotherPath: "scan"}
+	for _, file := range files {
+		entry.FileList = append(entry.FileList, &dirinfo.File{
+			RelPathToMother: filepath.Join(name, file),
+			Name:            filepath.Base(file),
+			Ext:             filepath.Ext(file),
+		})
+	}
+	return entry
+}
+
+// MediaTypeDirs returns target dirs of every media type, for run opts of parser tests
+func MediaTypeDirs() map[common.MediaType]string {
+	return map[common.MediaType]string{
+		common.MediaTypeMovie: "movies",
+		common.MediaTypeTv:    "tv",
+		common.MediaTypeTrash: "trash",
+	}
+}
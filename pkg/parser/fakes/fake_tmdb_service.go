@@ -1,24 +1,52 @@
 package fakes
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 
 	tmdb "github.com/cyruzin/golang-tmdb"
 )
 
+// FakeTmdbService answers tmdb requests from its mappings, it is also loaded from a fixture file by LoadFakeTmdbService,
+// values in a fixture file are tmdb api responses as is
 type FakeTmdbService struct {
-	TvQueryMapping    map[string]*tmdb.SearchTVShows
-	TvIdMapping       map[int]*tmdb.TVDetails
-	MovieQueryMapping map[string]*tmdb.SearchMovies
-	MovieIdMapping    map[int]*tmdb.MovieDetails
+	TvQueryMapping        map[string]*tmdb.SearchTVShows          `json:"tv_search"`
+	TvIdMapping           map[int]*tmdb.TVDetails                 `json:"tv"`
+	MovieQueryMapping     map[string]*tmdb.SearchMovies           `json:"movie_search"`
+	MovieIdMapping        map[int]*tmdb.MovieDetails              `json:"movie"`
+	MovieAltTitlesMapping map[int]*tmdb.MovieAlternativeTitles    `json:"movie_alt_titles"`
+	TvAltTitlesMapping    map[int]*tmdb.TVAlternativeTitles       `json:"tv_alt_titles"`
+	MultiQueryMapping     map[string]*tmdb.SearchMulti            `json:"multi_search"`
+	TvSeasonMapping       map[int]map[int]*tmdb.TVSeasonDetails   `json:"tv_season"` // tmdbid to season number
+	TvEpisodeGroupMapping map[string]*tmdb.TVEpisodeGroupsDetails `json:"tv_episode_group"`
+}
+
+// LoadFakeTmdbService loads a fake tmdb service from a JSON fixture file, missing mappings are empty
+func LoadFakeTmdbService(path string) (*FakeTmdbService, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile() error = %v", err)
+	}
+	ret := NewFakeTmdbService()
+	err = json.Unmarshal(content, ret)
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshal() tmdb fixture %s error = %v", path, err)
+	}
+	return ret, nil
 }
 
 func NewFakeTmdbService(opts ...FakeTmdbOption) *FakeTmdbService {
 	ret := &FakeTmdbService{
-		TvQueryMapping:    make(map[string]*tmdb.SearchTVShows),
-		TvIdMapping:       make(map[int]*tmdb.TVDetails),
-		MovieQueryMapping: make(map[string]*tmdb.SearchMovies),
-		MovieIdMapping:    make(map[int]*tmdb.MovieDetails),
+		TvQueryMapping:        make(map[string]*tmdb.SearchTVShows),
+		TvIdMapping:           make(map[int]*tmdb.TVDetails),
+		MovieQueryMapping:     make(map[string]*tmdb.SearchMovies),
+		MovieIdMapping:        make(map[int]*tmdb.MovieDetails),
+		MovieAltTitlesMapping: make(map[int]*tmdb.MovieAlternativeTitles),
+		TvAltTitlesMapping:    make(map[int]*tmdb.TVAlternativeTitles),
+		MultiQueryMapping:     make(map[string]*tmdb.SearchMulti),
+		TvSeasonMapping:       make(map[int]map[int]*tmdb.TVSeasonDetails),
+		TvEpisodeGroupMapping: make(map[string]*tmdb.TVEpisodeGroupsDetails),
 	}
 	for _, opt := range opts {
 		opt(ret)
@@ -52,6 +80,39 @@ func WithMovieIdMapping(id int, movieDetails *tmdb.MovieDetails) FakeTmdbOption
 	}
 }
 
+func WithMovieAltTitlesMapping(id int, titles *tmdb.MovieAlternativeTitles) FakeTmdbOption {
+	return func(s *FakeTmdbService) {
+		s.MovieAltTitlesMapping[id] = titles
+	}
+}
+
+func WithTvAltTitlesMapping(id int, titles *tmdb.TVAlternativeTitles) FakeTmdbOption {
+	return func(s *FakeTmdbService) {
+		s.TvAltTitlesMapping[id] = titles
+	}
+}
+
+func WithMultiQueryMapping(query string, searchMulti *tmdb.SearchMulti) FakeTmdbOption {
+	return func(s *FakeTmdbService) {
+		s.MultiQueryMapping[query] = searchMulti
+	}
+}
+
+func WithTvSeasonMapping(id, seasonNumber int, seasonDetails *tmdb.TVSeasonDetails) FakeTmdbOption {
+	return func(s *FakeTmdbService) {
+		if s.TvSeasonMapping[id] == nil {
+			s.TvSeasonMapping[id] = make(map[int]*tmdb.TVSeasonDetails)
+		}
+		s.TvSeasonMapping[id][seasonNumber] = seasonDetails
+	}
+}
+
+func WithTvEpisodeGroupMapping(id string, details *tmdb.TVEpisodeGroupsDetails) FakeTmdbOption {
+	return func(s *FakeTmdbService) {
+		s.TvEpisodeGroupMapping[id] = details
+	}
+}
+
 func (ts *FakeTmdbService) GetSearchTVShow(query string, urlOptions map[string]string) (*tmdb.SearchTVShows, error) {
 	if ret, ok := ts.TvQueryMapping[query]; ok {
 		return ret, nil
@@ -79,3 +140,38 @@ func (ts *FakeTmdbService) GetSearchMovies(query string, urlOptions map[string]s
 	}
 	return nil, fmt.Errorf("no matching for GetSearchMovies")
 }
+
+func (ts *FakeTmdbService) GetMovieAlternativeTitles(id int, urlOptions map[string]string) (*tmdb.MovieAlternativeTitles, error) {
+	if ret, ok := ts.MovieAltTitlesMapping[id]; ok {
+		return ret, nil
+	}
+	return nil, fmt.Errorf("no matching for GetMovieAlternativeTitles")
+}
+
+func (ts *FakeTmdbService) GetTVAlternativeTitles(id int, urlOptions map[string]string) (*tmdb.TVAlternativeTitles, error) {
+	if ret, ok := ts.TvAltTitlesMapping[id]; ok {
+		return ret, nil
+	}
+	return nil, fmt.Errorf("no matching for GetTVAlternativeTitles")
+}
+
+func (ts *FakeTmdbService) GetSearchMulti(query string, urlOptions map[string]string) (*tmdb.SearchMulti, error) {
+	if ret, ok := ts.MultiQueryMapping[query]; ok {
+		return ret, nil
+	}
+	return nil, fmt.Errorf("no matching for GetSearchMulti")
+}
+
+func (ts *FakeTmdbService) GetTVSeasonDetails(id, seasonNumber int, urlOptions map[string]string) (*tmdb.TVSeasonDetails, error) {
+	if ret, ok := ts.TvSeasonMapping[id][seasonNumber]; ok {
+		return ret, nil
+	}
+	return nil, fmt.Errorf("no matching for GetTVSeasonDetails")
+}
+
+func (ts *FakeTmdbService) GetTVEpisodeGroupsDetails(id string, urlOptions map[string]string) (*tmdb.TVEpisodeGroupsDetails, error) {
+	if ret, ok := ts.TvEpisodeGroupMapping[id]; ok {
+		return ret, nil
+	}
+	return nil, fmt.Errorf("no matching for GetTVEpisodeGroupsDetails")
+}
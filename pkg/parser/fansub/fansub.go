@@ -0,0 +1,348 @@
+// Package fansub is a parser of Chinese fansub release names, such as [字幕组][作品名][01][1080P][简繁内封]
+// and 【字幕组】作品名 第二季 - 05 [GB]. The group tag is dropped, the title is searched as a tmdb tv show,
+// seasons such as 第二季 are read and subtitle languages come from tags such as 简繁 or suffixes such as .tc.ass.
+// Names without an episode or with a low confidence tmdb match are skipped, so the next parser gets them.
+package fansub
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"asmediamgr/pkg/common"
+	"asmediamgr/pkg/dirinfo"
+	"asmediamgr/pkg/disk"
+	"asmediamgr/pkg/identify"
+	"asmediamgr/pkg/parser"
+	"asmediamgr/pkg/utils"
+)
+
+const (
+	name            = "fansub"
+	defaultPriority = -2 // before scene, a bracketed fansub name is never a scene name
+	defaultSeason   = 1  // fansub releases name the season only from the second one
+)
+
+func init() {
+	parser.RegisterParser(name, &Fansub{})
+}
+
+// Config is the optional config of the parser
+type Config struct {
+	Priority *float32 `toml:"priority"`
+}
+
+type Fansub struct {
+	logger log.Logger
+}
+
+func (p *Fansub) IsDefaultEnable() bool {
+	return true
+}
+
+func (p *Fansub) Init(cfgPath string, logger log.Logger) (priority float32, err error) {
+	p.logger = logger
+	cfg := &Config{}
+	_, err = toml.DecodeFile(cfgPath, cfg)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("DecodeFile() error = %v", err)
+	}
+	if cfg.Priority != nil {
+		return *cfg.Priority, nil
+	}
+	return defaultPriority, nil
+}
+
+// episodeFile is a media or subtitle file of the entry with its season and episode
+type episodeFile struct {
+	file       *dirinfo.File
+	season     int
+	episode    int
+	episodeEnd int    // last episode of a multi-episode file, 0 if single
+	language   string // subtitles only
+}
+
+type fansubInfo struct {
+	name         *Name
+	mediaFiles   []*episodeFile
+	subtitles    []*episodeFile
+	originalName string
+	year         int
+	tmdbid       int
+}
+
+func (p *Fansub) Parse(entry *dirinfo.Entry, opts *parser.ParserMgrRunOpts) (plan *disk.Plan, err error) {
+	if opts.Override.Skip(common.MediaTypeTv) {
+		return nil, nil
+	}
+	info, err := p.parse(entry, opts.Override, opts.Trace)
+	if err != nil || info == nil {
+		return nil, err
+	}
+	tvTargetDir, ok := opts.MediaTypeDirs[common.MediaTypeTv]
+	if !ok {
+		return nil, fmt.Errorf("no tv target dir")
+	}
+	level.Info(p.logger).Log("msg", "matched", "entry", entry.Name(), "name", info.name, "originalName", info.originalName,
+		"year", info.year, "tmdbid", info.tmdbid, "files", len(info.mediaFiles), "subs", len(info.subtitles))
+	plan = &disk.Plan{}
+	for _, media := range info.mediaFiles {
+		plan.AddTvEpisode(&disk.TvEpisodeRenameTask{
+			OldPath:      filepath.Join(entry.MotherPath, media.file.RelPathToMother),
+			NewMotherDir: tvTargetDir,
+			OriginalName: info.originalName,
+			Year:         info.year,
+			Tmdbid:       info.tmdbid,
+			Season:       media.season,
+			Episode:      media.episode,
+			EpisodeEnd:   media.episodeEnd,
+		})
+	}
+	for _, sub := range info.subtitles {
+		plan.AddTvSubtitle(&disk.TvSubtitleRenameTask{
+			OldPath:      filepath.Join(entry.MotherPath, sub.file.RelPathToMother),
+			NewMotherDir: tvTargetDir,
+			OriginalName: info.originalName,
+			Year:         info.year,
+			Tmdbid:       info.tmdbid,
+			Season:       sub.season,
+			Episode:      sub.episode,
+			EpisodeEnd:   sub.episodeEnd,
+			Language:     sub.language,
+		})
+	}
+	if entry.Type == dirinfo.DirEntry {
+		trashDir, ok := opts.MediaTypeDirs[common.MediaTypeTrash]
+		if !ok {
+			return nil, fmt.Errorf("no trash dir")
+		}
+		plan.AddMoveToTrash(&disk.MoveToTrashTask{
+			Path:     filepath.Join(entry.MotherPath, entry.Name()),
+			TrashDir: trashDir,
+		}).Optional = true
+	}
+	return plan, nil
+}
+
+// parse returns nil info without error if the entry is not a fansub release or the match is not confident
+func (p *Fansub) parse(entry *dirinfo.Entry, override *parser.Override, trace *parser.Trace) (*fansubInfo, error) {
+	info := &fansubInfo{}
+	var ok bool
+	switch entry.Type {
+	case dirinfo.FileEntry:
+		ok = p.parseFile(entry.FileList[0], info, override, trace)
+	case dirinfo.DirEntry:
+		ok = p.parseDir(entry, info, override, trace)
+	}
+	if !ok {
+		return nil, nil
+	}
+	err := p.identify(info, override, trace)
+	var ambiguousErr *identify.AmbiguousError
+	if errors.Is(err, identify.ErrNoCandidate) || errors.As(err, &ambiguousErr) {
+		trace.Logf("low confidence of search: %v", err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// parseFile parses a single media or subtitle file entry
+func (p *Fansub) parseFile(file *dirinfo.File, info *fansubInfo, override *parser.Override, trace *parser.Trace) bool {
+	isSubtitle := utils.IsSubtitleExt(file.Ext)
+	if !isSubtitle && !utils.IsMediaExt(file.Ext) {
+		trace.Logf("not a media or subtitle file")
+		return false
+	}
+	base, suffixLang := cutLanguageSuffix(strings.TrimSuffix(file.Name, file.Ext), isSubtitle)
+	info.name = ParseName(base)
+	trace.Logf("name %s", info.name)
+	if !isFansub(info.name) {
+		trace.Logf("not a fansub release name")
+		return false
+	}
+	if info.name.Extra || info.name.Episode < 0 {
+		trace.Logf("not an episode")
+		return false
+	}
+	ep := newEpisodeFile(file, info.name, info.name, override)
+	if !isSubtitle {
+		info.mediaFiles = []*episodeFile{ep}
+		return true
+	}
+	ep.language = firstNonEmpty(suffixLang, info.name.Language)
+	info.subtitles = []*episodeFile{ep}
+	return true
+}
+
+// parseDir parses the dir name for the title and season, and every file for its episode
+func (p *Fansub) parseDir(entry *dirinfo.Entry, info *fansubInfo, override *parser.Override, trace *parser.Trace) bool {
+	info.name = ParseName(entry.Name())
+	trace.Logf("name %s", info.name)
+	if !isFansub(info.name) {
+		trace.Logf("not a fansub release name")
+		return false
+	}
+	episodes := make(map[[2]int]bool)
+	for _, file := range entry.FileList {
+		if !utils.IsMediaExt(file.Ext) || isExtraPath(file) {
+			continue
+		}
+		fileName := ParseName(strings.TrimSuffix(file.Name, file.Ext))
+		if fileName.Extra {
+			continue
+		}
+		if fileName.Episode < 0 {
+			trace.Logf("no episode in %s", file.Name)
+			return false
+		}
+		ep := newEpisodeFile(file, info.name, fileName, override)
+		for episode := ep.episode; episode == ep.episode || episode <= ep.episodeEnd; episode++ {
+			key := [2]int{ep.season, episode}
+			if episodes[key] {
+				trace.Logf("duplicate season %d episode %d, %s", ep.season, episode, file.Name)
+				return false
+			}
+			episodes[key] = true
+		}
+		info.mediaFiles = append(info.mediaFiles, ep)
+	}
+	if len(info.mediaFiles) == 0 {
+		trace.Logf("no episode in dir")
+		return false
+	}
+	subtitles := make(map[string]bool)
+	for _, file := range entry.FileList {
+		if !utils.IsSubtitleExt(file.Ext) || isExtraPath(file) {
+			continue
+		}
+		base, suffixLang := cutLanguageSuffix(strings.TrimSuffix(file.Name, file.Ext), true)
+		fileName := ParseName(base)
+		if fileName.Extra || fileName.Episode < 0 {
+			continue
+		}
+		ep := newEpisodeFile(file, info.name, fileName, override)
+		ep.language = firstNonEmpty(suffixLang, fileName.Language)
+		if !episodes[[2]int{ep.season, ep.episode}] {
+			trace.Logf("no episode for subtitle %s", file.Name)
+			continue
+		}
+		key := fmt.Sprintf("%d-%d-%s", ep.season, ep.episode, ep.language)
+		if subtitles[key] {
+			level.Warn(p.logger).Log("msg", "multiple subtitle files found", "language", ep.language, "file", file.Name)
+			continue
+		}
+		subtitles[key] = true
+		info.subtitles = append(info.subtitles, ep)
+	}
+	sortEpisodeFiles(info.mediaFiles)
+	sortEpisodeFiles(info.subtitles)
+	return true
+}
+
+// identify searches tmdb for the titles in order if tmdbid is unknown, and loads the details
+func (p *Fansub) identify(info *fansubInfo, override *parser.Override, trace *parser.Trace) (err error) {
+	tmdbService := trace.TmdbService(parser.GetDefaultTmdbService())
+	if override != nil {
+		info.tmdbid = override.Tmdbid
+	}
+	if info.tmdbid <= 0 {
+		for _, title := range info.name.Titles {
+			info.tmdbid, err = identify.SearchTv(tmdbService, title, info.name.Year, p.logger)
+			if err == nil {
+				break
+			}
+			trace.Logf("search %q: %v", title, err)
+		}
+		if err != nil {
+			return fmt.Errorf("search tv, error = %w", err)
+		}
+	}
+	detail, err := tmdbService.GetTVDetails(info.tmdbid, common.DefaultTmdbSearchOpts)
+	if err != nil {
+		return fmt.Errorf("get tv detail of tmdbid = %d, error = %v", info.tmdbid, err)
+	}
+	dt, err := common.ParseTmdbDateStr(detail.FirstAirDate)
+	if err != nil {
+		return fmt.Errorf("tmdbid = %d, invalid first air date = %s", info.tmdbid, detail.FirstAirDate)
+	}
+	info.originalName, info.year = detail.OriginalName, dt.Year
+	trace.Logf("identified %q of %d, tmdbid = %d", info.originalName, info.year, info.tmdbid)
+	return nil
+}
+
+// isFansub returns true for a name led by a bracketed group with a title
+func isFansub(n *Name) bool {
+	return n.Group != "" && len(n.Titles) > 0
+}
+
+// newEpisodeFile takes the season of the file name, then of the entry name, the first season if neither has one
+func newEpisodeFile(file *dirinfo.File, entryName, fileName *Name, override *parser.Override) *episodeFile {
+	season := fileName.Season
+	if season < 0 {
+		season = entryName.Season
+	}
+	if season < 0 {
+		season = defaultSeason
+	}
+	season, episode := override.ApplyTv(season, fileName.Episode)
+	ep := &episodeFile{file: file, season: season, episode: episode}
+	if fileName.EpisodeEnd > fileName.Episode {
+		ep.episodeEnd = fileName.EpisodeEnd + episode - fileName.Episode
+	}
+	return ep
+}
+
+// cutLanguageSuffix cuts a language suffix of subtitles, such as .sc in [Group][Show][01].sc.ass
+func cutLanguageSuffix(base string, isSubtitle bool) (string, string) {
+	i := strings.LastIndex(base, ".")
+	if !isSubtitle || i < 0 {
+		return base, ""
+	}
+	langs, ok := languageTag(base[i+1:])
+	if !ok {
+		return base, ""
+	}
+	return base[:i], joinLanguages(langs)
+}
+
+// isExtraPath returns true for files in extra dirs, such as SPs/ or CDs/
+func isExtraPath(file *dirinfo.File) bool {
+	parts := strings.Split(filepath.ToSlash(file.RelPathToMother), "/")
+	for _, part := range parts[:len(parts)-1] {
+		if extraTags[strings.ToLower(part)] {
+			return true
+		}
+	}
+	return false
+}
+
+func sortEpisodeFiles(files []*episodeFile) {
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].season != files[j].season {
+			return files[i].season < files[j].season
+		}
+		if files[i].episode != files[j].episode {
+			return files[i].episode < files[j].episode
+		}
+		return files[i].language < files[j].language
+	})
+}
+
+func firstNonEmpty(strs ...string) string {
+	for _, str := range strs {
+		if str != "" {
+			return str
+		}
+	}
+	return ""
+}
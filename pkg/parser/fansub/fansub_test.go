@@ -0,0 +1,133 @@
+package fansub
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	tmdb "github.com/cyruzin/golang-tmdb"
+	"github.com/go-kit/log"
+
+	"asmediamgr/pkg/common"
+	"asmediamgr/pkg/dirinfo"
+	"asmediamgr/pkg/disk"
+	"asmediamgr/pkg/parser"
+	"asmediamgr/pkg/parser/fakes"
+)
+
+func searchTv(t *testing.T, content string) *tmdb.SearchTVShows {
+	t.Helper()
+	ret := &tmdb.SearchTVShows{}
+	if err := json.Unmarshal([]byte(content), ret); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	return ret
+}
+
+func TestParse(t *testing.T) {
+	parser.RegisterTmdbService(fakes.NewFakeTmdbService(
+		fakes.WithTvQueryMapping("作品名", searchTv(t, `{"results":[{"id":100,"name":"作品名","original_name":"Sakuhin","first_air_date":"2020-04-01"}]}`)),
+		fakes.WithTvQueryMapping("未知", searchTv(t, `{"results":[]}`)),
+		fakes.WithTvQueryMapping("Known Name", searchTv(t, `{"results":[{"id":100,"name":"Known Name","first_air_date":"2020-04-01"}]}`)),
+		fakes.WithTvIdMapping(100, &tmdb.TVDetails{ID: 100, OriginalName: "Sakuhin", FirstAirDate: "2020-04-01"}),
+	))
+	p := &Fansub{logger: log.NewNopLogger()}
+	opts := &parser.ParserMgrRunOpts{MediaTypeDirs: fakes.MediaTypeDirs()}
+
+	plan, err := p.Parse(fakes.FileEntry("【字幕组】作品名 第二季 - 05 [GB].mp4"), opts)
+	if err != nil || plan == nil || len(plan.Ops) != 1 {
+		t.Fatalf("Parse() file got plan = %v, error = %v", plan, err)
+	}
+	if got := plan.Ops[0].TvEpisode; plan.Ops[0].Type != disk.OpRenameTvEpisode || got.Tmdbid != 100 || got.Year != 2020 ||
+		got.OriginalName != "Sakuhin" || got.Season != 2 || got.Episode != 5 {
+		t.Errorf("Parse() file got = %+v", got)
+	}
+
+	plan, err = p.Parse(fakes.FileEntry("[字幕组][作品名][03][1080P].tc.ass"), opts)
+	if err != nil || plan == nil || len(plan.Ops) != 1 {
+		t.Fatalf("Parse() subtitle file got plan = %v, error = %v", plan, err)
+	}
+	if got := plan.Ops[0].TvSubtitle; plan.Ops[0].Type != disk.OpRenameTvSubtitle || got.Language != "cht" || got.Season != 1 || got.Episode != 3 {
+		t.Errorf("Parse() subtitle file got = %+v", got)
+	}
+
+	plan, err = p.Parse(fakes.FileEntry("[字幕组][作品名][01-02][1080P].mkv"), opts)
+	if err != nil || plan == nil || len(plan.Ops) != 1 {
+		t.Fatalf("Parse() multi-episode file got plan = %v, error = %v", plan, err)
+	}
+	if got := plan.Ops[0].TvEpisode; got.Season != 1 || got.Episode != 1 || got.EpisodeEnd != 2 {
+		t.Errorf("Parse() multi-episode file got = %+v", got)
+	}
+
+	entry := fakes.DirEntry("[字幕组] 作品名 / Known Name [01-02][1080P][简繁外挂]",
+		"[字幕组][作品名][02][1080P].mkv",
+		"[字幕组][作品名][01][1080P].mkv",
+		"[字幕组][作品名][01][1080P].sc.ass",
+		"[字幕组][作品名][01][1080P][繁体].ass",
+		"[字幕组][作品名][03][1080P].sc.ass",
+		filepath.Join("SPs", "[字幕组][作品名][PV01][1080P].mkv"),
+		"[字幕组][作品名][NCOP][1080P].mkv",
+	)
+	plan, err = p.Parse(entry, opts)
+	if err != nil || plan == nil || len(plan.Ops) != 5 {
+		t.Fatalf("Parse() dir got plan = %v, error = %v", plan, err)
+	}
+	for i, want := range []struct {
+		opType  disk.OpType
+		episode int
+		lang    string
+	}{
+		{disk.OpRenameTvEpisode, 1, ""},
+		{disk.OpRenameTvEpisode, 2, ""},
+		{disk.OpRenameTvSubtitle, 1, "chs"},
+		{disk.OpRenameTvSubtitle, 1, "cht"},
+		{disk.OpMoveToTrash, 0, ""},
+	} {
+		op := plan.Ops[i]
+		if op.Type != want.opType {
+			t.Errorf("Parse() dir op %d got type = %v, want = %v", i, op.Type, want.opType)
+			continue
+		}
+		switch op.Type {
+		case disk.OpRenameTvEpisode:
+			if op.TvEpisode.Season != 1 || op.TvEpisode.Episode != want.episode {
+				t.Errorf("Parse() dir op %d got = %+v", i, op.TvEpisode)
+			}
+		case disk.OpRenameTvSubtitle:
+			if op.TvSubtitle.Episode != want.episode || op.TvSubtitle.Language != want.lang {
+				t.Errorf("Parse() dir op %d got = %+v", i, op.TvSubtitle)
+			}
+		}
+	}
+
+	plan, err = p.Parse(fakes.DirEntry("[字幕组] 未知 / Known Name 第二季 [1080P]", "01.mkv"), opts)
+	if err != nil || plan == nil || plan.Ops[0].TvEpisode.Season != 2 || plan.Ops[0].TvEpisode.Episode != 1 {
+		t.Errorf("Parse() second title got plan = %v, error = %v", plan, err)
+	}
+
+	for _, entry := range []*dirinfo.Entry{
+		fakes.FileEntry("[字幕组][未知][01][1080P].mkv"),                              // not found
+		fakes.FileEntry("[字幕组][作品名][NCOP][1080P].mkv"),                           // not an episode
+		fakes.FileEntry("Show.Name.S01E02.1080p.WEB-DL.mkv"),                     // not a fansub release name
+		fakes.FileEntry("[字幕组][作品名][01][1080P].txt"),                             // not a media file
+		fakes.DirEntry("[字幕组][作品名][BDRip]", "[字幕组][作品名][Menu].mkv", "Bonus.mkv"), // no episode
+		fakes.DirEntry("[字幕组][作品名][BDRip]", "01.mkv", "01v2.mkv"),                // duplicate episodes
+		fakes.DirEntry("[字幕组][作品名][BDRip]", "[01-02].mkv", "02.mkv"),             // episode in a range
+	} {
+		plan, err = p.Parse(entry, opts)
+		if err != nil || plan != nil {
+			t.Errorf("Parse(%s) got plan = %v, error = %v, want no match", entry.Name(), plan, err)
+		}
+	}
+
+	season := 3
+	opts.Override = &parser.Override{MediaType: common.MediaTypeTv, Tmdbid: 100, Season: &season}
+	plan, err = p.Parse(fakes.FileEntry("[字幕组][未知][04][1080P].mkv"), opts)
+	if err != nil || plan == nil || plan.Ops[0].TvEpisode.Season != 3 || plan.Ops[0].TvEpisode.Tmdbid != 100 {
+		t.Errorf("Parse() with override got plan = %v, error = %v", plan, err)
+	}
+	opts.Override = &parser.Override{MediaType: common.MediaTypeMovie, Tmdbid: 1}
+	if plan, err = p.Parse(fakes.FileEntry("[字幕组][作品名][04][1080P].mkv"), opts); err != nil || plan != nil {
+		t.Errorf("Parse() with movie override got plan = %v, error = %v", plan, err)
+	}
+}
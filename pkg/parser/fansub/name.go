@@ -0,0 +1,240 @@
+package fansub
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"asmediamgr/pkg/common"
+)
+
+// Name is what is extracted from a fansub release name, such as [字幕组][作品名][01][1080P][简繁内封]
+// or 【字幕组】作品名 第二季 - 05 [GB]
+type Name struct {
+	Group      string
+	Titles     []string // alternative titles, such as [中文名 / English Name]
+	Year       int      // 0 if unknown
+	Season     int      // -1 if unknown
+	Episode    int      // -1 if unknown
+	EpisodeEnd int      // last episode of a range such as [01-02], 0 if single
+	Resolution string
+	Language   string // subtitle language, such as chs, cht or chs&cht, empty if unknown
+	Extra      bool   // NCOP, SP, PV and the like, not an episode
+}
+
+func (n *Name) String() string {
+	return fmt.Sprintf("group = %s, titles = %q, year = %d, season = %d, episode = %d, episodeEnd = %d, resolution = %s, language = %s, extra = %v",
+		n.Group, n.Titles, n.Year, n.Season, n.Episode, n.EpisodeEnd, n.Resolution, n.Language, n.Extra)
+}
+
+// Title returns the first title, empty if none
+func (n *Name) Title() string {
+	if len(n.Titles) == 0 {
+		return ""
+	}
+	return n.Titles[0]
+}
+
+var (
+	// segmentRe splits a name into bracketed and plain segments
+	segmentRe = regexp.MustCompile(`\[([^\]]*)\]|【([^】]*)】|([^\[【]+)`)
+	tokenRe   = regexp.MustCompile(`[\s_+&.]+`)
+
+	episodeRe   = regexp.MustCompile(`(?i)^(\d{1,4})(?:v\d)?(?:\s*(?:end|fin|完))?$`)
+	chEpisodeRe = regexp.MustCompile(`第\s*([0-9０-９零〇一二两三四五六七八九十百千]+)\s*[话話集]`)
+	epEpisodeRe = regexp.MustCompile(`(?i)\b(?:ep?|episode\s*)(\d{1,4})(?:v\d)?\b`)
+	// dashEpisodeRe is the episode after a dash in plain text, such as 作品名 - 05
+	dashEpisodeRe = regexp.MustCompile(`(?i)\s-\s*(\d{1,4})(?:v\d)?(?:\s*(?:end|fin))?\s*$`)
+	chSeasonRe    = regexp.MustCompile(`第\s*([0-9０-９零〇一二两三四五六七八九十百千]+)\s*[季期]`)
+	seasonRe      = regexp.MustCompile(`(?i)(?:^|\s)(?:s|season\s*)(\d{1,2})(?:\s|$)`)
+	nthSeasonRe   = regexp.MustCompile(`(?i)(?:^|\s)(\d{1,2})(?:st|nd|rd|th)\s+season(?:\s|$)`)
+	yearRe        = regexp.MustCompile(`^(19|20)\d{2}$`)
+	resolutionRe  = regexp.MustCompile(`(?i)^(\d{3,4}[pi]|4k|\d{3,4}x\d{3,4})$`)
+	// rangeRe is an episode range, such as [01-02] of a multi-episode file or [01-12] of a batch release
+	rangeRe = regexp.MustCompile(`(?i)^(\d{1,4})\s*[-~]\s*(\d{1,4})(?:\s*(?:fin|end|全集))?$`)
+	// languageRe is a tag made of language words only, such as 简繁内封 or 简日双语, so titles with 简 are not tags
+	languageRe = regexp.MustCompile(`^[简簡繁体體中日英文双雙语語内內封嵌外挂掛字幕]+$`)
+
+	techTags = map[string]bool{
+		"mp4": true, "mkv": true, "avc": true, "hevc": true, "x264": true, "x265": true, "h264": true, "h265": true,
+		"aac": true, "flac": true, "opus": true, "ac3": true, "10bit": true, "8bit": true, "ma10p": true, "hi10p": true,
+		"webrip": true, "web-dl": true, "webdl": true, "web": true, "bdrip": true, "bd": true, "dvdrip": true, "tvrip": true,
+		"hdr": true, "uhd": true, "baha": true, "b-global": true, "cr": true, "abema": true, "netflix": true, "v2": true,
+	}
+	extraTags = map[string]bool{
+		"ncop": true, "nced": true, "op": true, "ed": true, "sp": true, "sps": true, "ova": true, "oad": true, "pv": true,
+		"cm": true, "menu": true, "preview": true, "trailer": true, "特典": true, "映像特典": true, "cds": true, "scans": true,
+	}
+)
+
+// ParseName parses a fansub release name without ext
+func ParseName(name string) *Name {
+	n := &Name{Season: -1, Episode: -1}
+	segments := segmentRe.FindAllStringSubmatch(name, -1)
+	for i, groups := range segments {
+		bracketed := groups[3] == ""
+		text := strings.TrimSpace(groups[1] + groups[2] + groups[3])
+		if text == "" {
+			continue
+		}
+		if i == 0 && bracketed && len(segments) > 1 {
+			n.Group = text
+			continue
+		}
+		if bracketed && n.tagSegment(text) {
+			continue
+		}
+		n.titleSegment(text, bracketed)
+	}
+	return n
+}
+
+// tagSegment records a bracketed segment of tags, such as [01], [1080P] or [简繁内封], false if it is not all tags
+func (n *Name) tagSegment(text string) bool {
+	if groups := episodeRe.FindStringSubmatch(text); groups != nil {
+		if yearRe.MatchString(groups[1]) && len(groups[0]) == 4 {
+			n.Year, _ = strconv.Atoi(groups[1])
+		} else {
+			n.Episode, _ = strconv.Atoi(groups[1])
+		}
+		return true
+	}
+	if groups := rangeRe.FindStringSubmatch(text); groups != nil {
+		start, _ := strconv.Atoi(groups[1])
+		end, _ := strconv.Atoi(groups[2])
+		if end > start {
+			n.Episode, n.EpisodeEnd = start, end
+		}
+		return true
+	}
+	if groups := chEpisodeRe.FindStringSubmatch(text); groups != nil && groups[0] == text {
+		if episode, ok := common.ChineseToNum(groups[1]); ok {
+			n.Episode = episode
+			return true
+		}
+	}
+	tokens := tokenRe.Split(text, -1)
+	var langs []string
+	for _, token := range tokens {
+		lower := strings.ToLower(token)
+		switch {
+		case token == "":
+		case resolutionRe.MatchString(token):
+			n.Resolution = lower
+		case techTags[lower]:
+		case extraTags[lower]:
+			n.Extra = true
+		default:
+			lang, ok := languageTag(token)
+			if !ok {
+				return false
+			}
+			langs = append(langs, lang...)
+		}
+	}
+	if lang := joinLanguages(langs); lang != "" {
+		n.Language = lang
+	}
+	return true
+}
+
+// titleSegment extracts season and episode from a segment, the rest is the title if no title is found yet
+func (n *Name) titleSegment(text string, bracketed bool) {
+	if !bracketed {
+		if groups := episodeRe.FindStringSubmatch(text); groups != nil { // files of a dir, such as 05.mkv
+			n.Episode, _ = strconv.Atoi(groups[1])
+			return
+		}
+		if groups := dashEpisodeRe.FindStringSubmatchIndex(text); groups != nil {
+			n.Episode, _ = strconv.Atoi(text[groups[2]:groups[3]])
+			text = text[:groups[0]]
+		}
+	}
+	if groups := chEpisodeRe.FindStringSubmatchIndex(text); groups != nil {
+		if episode, ok := common.ChineseToNum(text[groups[2]:groups[3]]); ok {
+			n.Episode = episode
+			text = text[:groups[0]] + " " + text[groups[1]:]
+		}
+	}
+	if groups := epEpisodeRe.FindStringSubmatchIndex(text); groups != nil {
+		n.Episode, _ = strconv.Atoi(text[groups[2]:groups[3]])
+		text = text[:groups[0]] + " " + text[groups[1]:]
+	}
+	text = n.cutSeason(text)
+	if len(n.Titles) > 0 {
+		return
+	}
+	for _, title := range strings.Split(text, "/") {
+		title = strings.Trim(strings.TrimSpace(title), "-_ ")
+		if title == "" {
+			continue
+		}
+		if extraTags[strings.ToLower(title)] {
+			n.Extra = true
+			continue
+		}
+		n.Titles = append(n.Titles, title)
+	}
+}
+
+// cutSeason records the season of text, such as 第二季, S2 or 2nd Season, and returns text without it
+func (n *Name) cutSeason(text string) string {
+	if groups := chSeasonRe.FindStringSubmatchIndex(text); groups != nil {
+		if season, ok := common.ChineseToNum(text[groups[2]:groups[3]]); ok {
+			n.Season = season
+			return text[:groups[0]] + " " + text[groups[1]:]
+		}
+	}
+	for _, re := range []*regexp.Regexp{seasonRe, nthSeasonRe} {
+		if groups := re.FindStringSubmatchIndex(text); groups != nil {
+			n.Season, _ = strconv.Atoi(text[groups[2]:groups[3]])
+			return text[:groups[0]] + " " + text[groups[1]:]
+		}
+	}
+	return text
+}
+
+// languageTag returns subtitle languages of a tag, such as 简繁内封, GB or BIG5, false if it is not a language tag
+func languageTag(token string) ([]string, bool) {
+	switch strings.ToLower(token) {
+	case "gb", "chs", "sc", "gb2312", "zh-hans":
+		return []string{langChs}, true
+	case "big5", "cht", "tc", "zh-hant":
+		return []string{langCht}, true
+	}
+	if !languageRe.MatchString(token) {
+		return nil, false
+	}
+	var langs []string
+	if strings.ContainsAny(token, "简簡") {
+		langs = append(langs, langChs)
+	}
+	if strings.ContainsAny(token, "繁") {
+		langs = append(langs, langCht)
+	}
+	if strings.Contains(token, "日") {
+		langs = append(langs, langJpn)
+	}
+	return langs, true
+}
+
+const (
+	langChs = "chs"
+	langCht = "cht"
+	langJpn = "jpn"
+)
+
+// joinLanguages joins languages in a fixed order without duplicates, such as chs&cht
+func joinLanguages(langs []string) string {
+	var ret []string
+	for _, lang := range []string{langChs, langCht, langJpn} {
+		for _, l := range langs {
+			if l == lang {
+				ret = append(ret, lang)
+				break
+			}
+		}
+	}
+	return strings.Join(ret, "&")
+}
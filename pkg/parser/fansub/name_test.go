@@ -0,0 +1,34 @@
+package fansub
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		name string
+		want Name
+	}{
+		{"[字幕组][作品名][01][1080P][简繁内封]", Name{Group: "字幕组", Titles: []string{"作品名"}, Season: -1, Episode: 1, Resolution: "1080p", Language: "chs&cht"}},
+		{"【字幕组】作品名 第二季 - 05 [GB]", Name{Group: "字幕组", Titles: []string{"作品名"}, Season: 2, Episode: 5, Language: "chs"}},
+		{"[Group] Show Name S2 - 12v2 [1080p][BIG5_MP4]", Name{Group: "Group", Titles: []string{"Show Name"}, Season: 2, Episode: 12, Resolution: "1080p", Language: "cht"}},
+		{"[字幕组][作品名 / English Name][第03话][简日双语][WebRip]", Name{Group: "字幕组", Titles: []string{"作品名", "English Name"}, Season: -1, Episode: 3, Language: "chs&jpn"}},
+		{"[字幕组] 作品名 第3季 EP07 [CHS&CHT]", Name{Group: "字幕组", Titles: []string{"作品名"}, Season: 3, Episode: 7, Language: "chs&cht"}},
+		{"[字幕组] Show Name 2nd Season [01-12][2023][1080p]", Name{Group: "字幕组", Titles: []string{"Show Name"}, Year: 2023, Season: 2, Episode: 1, EpisodeEnd: 12, Resolution: "1080p"}},
+		{"[字幕组][作品名][01-02][1080P]", Name{Group: "字幕组", Titles: []string{"作品名"}, Season: -1, Episode: 1, EpisodeEnd: 2, Resolution: "1080p"}},
+		{"[字幕组][作品名][NCOP][1080P]", Name{Group: "字幕组", Titles: []string{"作品名"}, Season: -1, Episode: -1, Resolution: "1080p", Extra: true}},
+		{"[字幕组][简单生活][02]", Name{Group: "字幕组", Titles: []string{"简单生活"}, Season: -1, Episode: 2}},
+		{"[字幕组] 作品名 第十二季 第二十三话 [1080P]", Name{Group: "字幕组", Titles: []string{"作品名"}, Season: 12, Episode: 23, Resolution: "1080p"}},
+		{"[字幕组][作品名][第１２集]", Name{Group: "字幕组", Titles: []string{"作品名"}, Season: -1, Episode: 12}},
+		{"05", Name{Season: -1, Episode: 5}},
+		{"Show.Name.S01E02.1080p", Name{Titles: []string{"Show.Name.S01E02.1080p"}, Season: -1, Episode: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseName(tt.name); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("ParseName() got = %s, want = %s", got, &tt.want)
+			}
+		})
+	}
+}
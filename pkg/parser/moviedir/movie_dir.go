@@ -5,7 +5,9 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
+	"sync"
 
 	"github.com/BurntSushi/toml"
 	"github.com/go-kit/log"
@@ -14,6 +16,7 @@ import (
 	"asmediamgr/pkg/common"
 	"asmediamgr/pkg/dirinfo"
 	"asmediamgr/pkg/disk"
+	"asmediamgr/pkg/identify"
 	"asmediamgr/pkg/parser"
 	"asmediamgr/pkg/utils"
 )
@@ -48,112 +51,134 @@ type SubtitlePattern struct {
 
 type MovieDir struct {
 	logger   log.Logger
+	mu       sync.RWMutex // guards patterns, swapped on reload
 	patterns []*Pattern
 }
 
 func (p *MovieDir) Init(cfgPath string, logger log.Logger) (priority float32, err error) {
 	p.logger = logger
-	cfg := &Config{}
-	_, err = toml.DecodeFile(cfgPath, cfg)
+	patterns, err := loadPatterns(cfgPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return 0, nil
 		}
 		return 0, err
 	}
+	p.patterns = patterns
+	return 0, nil
+}
+
+// Reload loads and compiles cfgPath, patterns are swapped only if the whole config is valid,
+// a missing cfgPath means no patterns as in Init
+func (p *MovieDir) Reload(cfgPath string) error {
+	patterns, err := loadPatterns(cfgPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.patterns = patterns
+	return nil
+}
+
+func (p *MovieDir) getPatterns() []*Pattern {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.patterns
+}
+
+func loadPatterns(cfgPath string) ([]*Pattern, error) {
+	cfg := &Config{}
+	_, err := toml.DecodeFile(cfgPath, cfg)
+	if err != nil {
+		return nil, err
+	}
 	for _, pattern := range cfg.Patterns {
 		pattern.DirPattern, err = regexp.Compile(pattern.DirPatternStr)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
 		pattern.MediaPattern, err = regexp.Compile(pattern.MediaPatternStr)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
 		pattern.MediaFileAtLeastBytes, err = utils.SizeStringToBytesNum(pattern.MediaFileAtLeast)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
 		for _, subtitlePattern := range pattern.SubtitlePattern {
 			subtitlePattern.Pattern, err = regexp.Compile(subtitlePattern.PatternStr)
 			if err != nil {
-				return
+				return nil, err
 			}
 		}
 	}
-	p.patterns = cfg.Patterns
-	return 0, nil
+	return cfg.Patterns, nil
 }
 
 func (p *MovieDir) IsDefaultEnable() bool {
 	return true
 }
 
-func (p *MovieDir) Parse(entry *dirinfo.Entry, opts *parser.ParserMgrRunOpts) (ok bool, err error) {
+func (p *MovieDir) Parse(entry *dirinfo.Entry, opts *parser.ParserMgrRunOpts) (plan *disk.Plan, err error) {
 	if entry.Type != dirinfo.DirEntry {
-		return false, nil
+		opts.Trace.Logf("not a dir entry")
+		return nil, nil
+	}
+	if opts.Override.Skip(common.MediaTypeMovie) {
+		opts.Trace.Logf("skipped, override is not movie")
+		return nil, nil
 	}
 	if len(entry.FileList) <= 0 {
-		return false, fmt.Errorf("no files in dir, entry: %s", entry.Name())
+		return nil, fmt.Errorf("no files in dir, entry: %s", entry.Name())
 	}
 	movieTargetDir, ok := opts.MediaTypeDirs[common.MediaTypeMovie]
 	if !ok {
-		return false, fmt.Errorf("movie target dir not found, entry: %s", entry.Name())
+		return nil, fmt.Errorf("movie target dir not found, entry: %s", entry.Name())
 	}
 	trashDir, ok := opts.MediaTypeDirs[common.MediaTypeTrash]
 	if !ok {
-		return false, fmt.Errorf("trash dir not found, entry: %s", entry.Name())
+		return nil, fmt.Errorf("trash dir not found, entry: %s", entry.Name())
 	}
-	info, err := p.parse(entry)
+	info, err := p.parse(entry, opts.Override, opts.Trace)
 	if err != nil {
-		return false, fmt.Errorf("failed to parse: %w, entry: %s", err, entry.Name())
+		return nil, fmt.Errorf("failed to parse: %w, entry: %s", err, entry.Name())
 	}
 	if info == nil {
-		return false, nil
+		return nil, nil
 	}
 	level.Info(p.logger).Log("msg", "matched", "dir", entry.Name(), "name", info.name, "originalName", info.originalName, "year", info.year, "tmdbid", info.tmdbid, "subs", len(info.subtitleFiles))
-	diskService := parser.GetDefaultDiskService()
+	plan = &disk.Plan{}
 	if info.mediaFile != nil {
-		err = diskService.RenameMovie(&disk.MovieRenameTask{
+		plan.AddMovie(&disk.MovieRenameTask{
 			OldPath:      filepath.Join(entry.MotherPath, info.mediaFile.RelPathToMother),
 			NewMotherDir: movieTargetDir,
 			OriginalName: info.originalName,
 			Year:         info.year,
 			Tmdbid:       info.tmdbid,
-		})
-		if err != nil {
-			if os.IsExist(err) {
-				level.Warn(p.logger).Log("msg", "movie already existed", "entry", entry.Name(), "err", err)
-			} else {
-				return false, err
-			}
-		}
+		}).SkipExisting = true
+	}
+	langs := make([]string, 0, len(info.subtitleFiles))
+	for lang := range info.subtitleFiles {
+		langs = append(langs, lang)
 	}
-	for lang, subtitleFile := range info.subtitleFiles {
-		err = diskService.RenameMovieSubtitle(&disk.MovieSubtitleRenameTask{
+	sort.Strings(langs)
+	for _, lang := range langs {
+		subtitleFile := info.subtitleFiles[lang]
+		plan.AddMovieSubtitle(&disk.MovieSubtitleRenameTask{
 			OldPath:      filepath.Join(entry.MotherPath, subtitleFile.RelPathToMother),
 			NewMotherDir: movieTargetDir,
 			OriginalName: info.originalName,
 			Year:         info.year,
 			Tmdbid:       info.tmdbid,
 			Language:     lang,
-		})
-		if err != nil {
-			if os.IsExist(err) {
-				level.Warn(p.logger).Log("msg", "subtitle already existed", "lang", lang, "err", err, "entry", entry.Name())
-			} else {
-				return false, err
-			}
-		}
+		}).SkipExisting = true
 	}
-	err = diskService.MoveToTrash(&disk.MoveToTrashTask{
+	plan.AddMoveToTrash(&disk.MoveToTrashTask{
 		Path:     filepath.Join(entry.MotherPath, entry.Name()),
 		TrashDir: trashDir,
-	})
-	if err != nil {
-		level.Warn(p.logger).Log("msg", "failed to move to trash", "err", err, "entry", entry.Name())
-	}
-	return true, nil
+	}).Optional = true
+	return plan, nil
 }
 
 type movieInfo struct {
@@ -165,9 +190,13 @@ type movieInfo struct {
 	subtitleFiles map[string]*dirinfo.File
 }
 
-func (p *MovieDir) parse(entry *dirinfo.Entry) (*movieInfo, error) {
-	for _, pattern := range p.patterns {
-		info, err := p.matchPattern(entry, pattern)
+func (p *MovieDir) parse(entry *dirinfo.Entry, override *parser.Override, trace *parser.Trace) (*movieInfo, error) {
+	patterns := p.getPatterns()
+	if len(patterns) == 0 {
+		trace.Logf("no patterns configured")
+	}
+	for _, pattern := range patterns {
+		info, err := p.matchPattern(entry, pattern, override, trace)
 		if err != nil {
 			return nil, err
 		}
@@ -178,8 +207,9 @@ func (p *MovieDir) parse(entry *dirinfo.Entry) (*movieInfo, error) {
 	return nil, nil
 }
 
-func (p *MovieDir) matchPattern(entry *dirinfo.Entry, pattern *Pattern) (info *movieInfo, err error) {
+func (p *MovieDir) matchPattern(entry *dirinfo.Entry, pattern *Pattern, override *parser.Override, trace *parser.Trace) (info *movieInfo, err error) {
 	groups := pattern.DirPattern.FindStringSubmatch(entry.Name())
+	trace.Match("dir pattern", pattern.DirPattern, entry.Name(), groups)
 	if len(groups) <= 0 {
 		return nil, nil
 	}
@@ -207,6 +237,7 @@ func (p *MovieDir) matchPattern(entry *dirinfo.Entry, pattern *Pattern) (info *m
 	for _, file := range entry.FileList {
 		if utils.IsMediaExt(file.Ext) && utils.FileAtLeast(file, pattern.MediaFileAtLeastBytes) {
 			mediaGroups := pattern.MediaPattern.FindStringSubmatch(file.RelPathToMother)
+			trace.Match("media pattern", pattern.MediaPattern, file.RelPathToMother, mediaGroups)
 			if len(mediaGroups) > 0 {
 				mediaFiles = append(mediaFiles, file)
 				continue
@@ -260,29 +291,19 @@ func (p *MovieDir) matchPattern(entry *dirinfo.Entry, pattern *Pattern) (info *m
 	}
 	info.subtitleFiles = subtitleFilsMapping
 	if info.mediaFile == nil && len(info.subtitleFiles) <= 0 {
+		trace.Logf("no media file at least %s matched media pattern, no subtitle file found", pattern.MediaFileAtLeast)
 		return info, nil
 	}
-	tmdbService := parser.GetDefaultTmdbService()
+	trace.Logf("extracted name = %q, year = %d, tmdbid = %d, %d subtitles", info.name, info.year, info.tmdbid, len(info.subtitleFiles))
+	if override != nil {
+		info.tmdbid = override.Tmdbid
+	}
+	tmdbService := trace.TmdbService(parser.GetDefaultTmdbService())
 	if info.tmdbid <= 0 {
-		searchOpts := common.DefaultTmdbSearchOpts
-		if info.year > 0 {
-			searchOpts["year"] = strconv.Itoa(info.year)
-		}
-		results, err := tmdbService.GetSearchMovies(info.name, searchOpts)
+		info.tmdbid, err = identify.SearchMovie(tmdbService, info.name, info.year, p.logger)
 		if err != nil {
 			return nil, err
 		}
-		if results.TotalResults == 0 {
-			return nil, fmt.Errorf("no movie found, name: %s, year: %d", info.name, info.year)
-		}
-		if results.TotalResults > 1 {
-			var hits []string
-			for i := 0; i < 3 && i < len(results.Results); i++ {
-				hits = append(hits, fmt.Sprintf("%s-%d", results.Results[i].Title, results.Results[i].ID))
-			}
-			return nil, fmt.Errorf("multiple movies found: %v", hits)
-		}
-		info.tmdbid = int(results.Results[0].ID)
 	}
 	detail, err := tmdbService.GetMovieDetails(info.tmdbid, common.DefaultTmdbSearchOpts)
 	if err != nil {
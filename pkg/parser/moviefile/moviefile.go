@@ -1,11 +1,14 @@
 package moviefile
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/BurntSushi/toml"
 	"github.com/go-kit/log"
@@ -14,6 +17,7 @@ import (
 	"asmediamgr/pkg/common"
 	"asmediamgr/pkg/dirinfo"
 	"asmediamgr/pkg/disk"
+	"asmediamgr/pkg/identify"
 	"asmediamgr/pkg/parser"
 )
 
@@ -32,6 +36,7 @@ type PatternConfig struct {
 
 type MovieFile struct {
 	logger   log.Logger
+	mu       sync.RWMutex // guards patterns, swapped on reload
 	patterns []*PatternConfig
 }
 
@@ -54,48 +59,84 @@ func (p *MovieFile) Init(cfgPath string, logger log.Logger) (priority float32, e
 		p.patterns = cfg.Patterns
 	}
 	p.logger = logger
-	for _, pattern := range p.patterns {
+	err = compilePatterns(p.patterns)
+	if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// Reload loads and compiles cfgPath, patterns are swapped only if the whole config is valid,
+// a missing cfgPath means no patterns as in Init
+func (p *MovieFile) Reload(cfgPath string) error {
+	cfg, err := loadConfigFile(cfgPath)
+	if errors.Is(err, os.ErrNotExist) {
+		cfg, err = &Config{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	err = compilePatterns(cfg.Patterns)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.patterns = cfg.Patterns
+	return nil
+}
+
+func (p *MovieFile) getPatterns() []*PatternConfig {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.patterns
+}
+
+func compilePatterns(patterns []*PatternConfig) (err error) {
+	for _, pattern := range patterns {
 		pattern.Pattern, err = regexp.Compile(pattern.PatternStr)
 		if err != nil {
-			return 0, fmt.Errorf("failed to compile pattern: %w", err)
+			return fmt.Errorf("failed to compile pattern: %w", err)
 		}
 	}
-	return 0, nil
+	return nil
 }
 
 func (p *MovieFile) IsDefaultEnable() bool {
 	return true
 }
 
-func (p *MovieFile) Parse(entry *dirinfo.Entry, opts *parser.ParserMgrRunOpts) (ok bool, err error) {
+func (p *MovieFile) Parse(entry *dirinfo.Entry, opts *parser.ParserMgrRunOpts) (plan *disk.Plan, err error) {
 	if entry.Type != dirinfo.FileEntry || len(entry.FileList) != 1 {
-		return false, nil
+		opts.Trace.Logf("not a single file entry")
+		return nil, nil
+	}
+	if opts.Override.Skip(common.MediaTypeMovie) {
+		opts.Trace.Logf("skipped, override is not movie")
+		return nil, nil
 	}
 	file := entry.FileList[0]
 	movieTargetDir, ok := opts.MediaTypeDirs[common.MediaTypeMovie]
 	if !ok {
-		return false, fmt.Errorf("movie target dir not found")
+		return nil, fmt.Errorf("movie target dir not found")
 	}
-	info, err := p.parse(entry)
+	info, err := p.parse(entry, opts.Override, opts.Trace)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	if info == nil {
-		return false, nil
+		return nil, nil
 	}
 	level.Info(p.logger).Log("msg", "matched", "file", entry.Name(), "name", info.name, "originalName", info.originalName, "year", info.year, "tmdbid", info.tmdbid)
-	diskService := parser.GetDefaultDiskService()
-	err = diskService.RenameMovie(&disk.MovieRenameTask{
+	plan = &disk.Plan{}
+	plan.AddMovie(&disk.MovieRenameTask{
 		OldPath:      filepath.Join(entry.MotherPath, file.RelPathToMother),
 		NewMotherDir: movieTargetDir,
 		OriginalName: info.originalName,
 		Year:         info.year,
 		Tmdbid:       info.tmdbid,
 	})
-	if err != nil {
-		return false, fmt.Errorf("failed to rename movie: %w", err)
-	}
-	return true, nil
+	return plan, nil
 }
 
 type movieInfo struct {
@@ -105,9 +146,13 @@ type movieInfo struct {
 	tmdbid       int
 }
 
-func (p *MovieFile) parse(entry *dirinfo.Entry) (*movieInfo, error) {
-	for _, pattern := range p.patterns {
-		info, err := p.patternMatch(entry, pattern)
+func (p *MovieFile) parse(entry *dirinfo.Entry, override *parser.Override, trace *parser.Trace) (*movieInfo, error) {
+	patterns := p.getPatterns()
+	if len(patterns) == 0 {
+		trace.Logf("no patterns configured")
+	}
+	for _, pattern := range patterns {
+		info, err := p.patternMatch(entry, pattern, override, trace)
 		if err != nil {
 			return nil, err
 		}
@@ -124,10 +169,11 @@ var (
 	}
 )
 
-func (p *MovieFile) patternMatch(entry *dirinfo.Entry, pattern *PatternConfig) (*movieInfo, error) {
+func (p *MovieFile) patternMatch(entry *dirinfo.Entry, pattern *PatternConfig, override *parser.Override, trace *parser.Trace) (*movieInfo, error) {
 	file := entry.FileList[0]
 	entryNameWithoutExt, _ := strings.CutSuffix(file.Name, file.Ext)
 	groups := pattern.Pattern.FindStringSubmatch(entryNameWithoutExt)
+	trace.Match("pattern", pattern.Pattern, entryNameWithoutExt, groups)
 	if len(groups) == 0 {
 		return nil, nil
 	}
@@ -160,27 +206,17 @@ func (p *MovieFile) patternMatch(entry *dirinfo.Entry, pattern *PatternConfig) (
 			return nil, fmt.Errorf("unknown group: %s", group)
 		}
 	}
-	tmdbService := parser.GetDefaultTmdbService()
+	trace.Logf("extracted name = %q, year = %d, tmdbid = %d", info.name, info.year, info.tmdbid)
+	if override != nil {
+		info.tmdbid = override.Tmdbid
+	}
+	tmdbService := trace.TmdbService(parser.GetDefaultTmdbService())
 	if info.tmdbid <= 0 {
-		searchOpts := defaultTmdbUrlOptions
-		if info.year > common.ValidStartYear {
-			searchOpts["year"] = strconv.Itoa(info.year)
-		}
-		results, err := tmdbService.GetSearchMovies(info.name, searchOpts)
+		tmdbid, err := identify.SearchMovie(tmdbService, info.name, info.year, p.logger)
 		if err != nil {
 			return nil, err
 		}
-		if results.TotalResults <= 0 {
-			return nil, fmt.Errorf("no movie found")
-		}
-		if results.TotalResults > 1 {
-			var hits []string
-			for i := 0; i < 3 && i < len(results.Results); i++ {
-				hits = append(hits, fmt.Sprintf("%s-%d", results.Results[i].Title, results.Results[i].ID))
-			}
-			return nil, fmt.Errorf("multiple movies found, first 3 hits: %v", hits)
-		}
-		info.tmdbid = int(results.Results[0].ID)
+		info.tmdbid = tmdbid
 	}
 	detail, err := tmdbService.GetMovieDetails(info.tmdbid, defaultTmdbUrlOptions)
 	if err != nil {
@@ -0,0 +1,184 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"asmediamgr/pkg/dirinfo"
+)
+
+// EntryStatus is the result status of an entry in a scan pass
+type EntryStatus int
+
+const (
+	EntryMatched EntryStatus = iota
+	EntryFailed
+	EntrySkipped
+)
+
+func (s EntryStatus) String() string {
+	switch s {
+	case EntryMatched:
+		return "matched"
+	case EntryFailed:
+		return "failed"
+	case EntrySkipped:
+		return "skipped"
+	default:
+		return "unknown"
+	}
+}
+
+// EntryResult is the result of an entry in a scan pass
+type EntryResult struct {
+	ScanDir string
+	Entry   string
+	Status  EntryStatus
+	Parser  string // parser matched the entry, empty if not matched
+	Reason  string // why the entry failed or was skipped
+}
+
+// RunSummary is the results of all entries of a scan pass
+type RunSummary struct {
+	Results []*EntryResult
+}
+
+// Count returns the number of entries of status
+func (s *RunSummary) Count(status EntryStatus) int {
+	cnt := 0
+	for _, result := range s.Results {
+		if result.Status == status {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// String returns the counts and a line per entry, sorted by status, scan dir and entry
+func (s *RunSummary) String() string {
+	results := append([]*EntryResult(nil), s.Results...)
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Status != results[j].Status {
+			return results[i].Status < results[j].Status
+		}
+		if results[i].ScanDir != results[j].ScanDir {
+			return results[i].ScanDir < results[j].ScanDir
+		}
+		return results[i].Entry < results[j].Entry
+	})
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("matched %d, failed %d, skipped %d\n", s.Count(EntryMatched), s.Count(EntryFailed), s.Count(EntrySkipped)))
+	for _, result := range results {
+		detail := result.Reason
+		if result.Status == EntryMatched {
+			detail = "by " + result.Parser
+		}
+		sb.WriteString(fmt.Sprintf("  %-7s %s: %s\n", result.Status, filepath.Join(result.ScanDir, result.Entry), detail))
+	}
+	return sb.String()
+}
+
+// RunOnce runs a single scan pass and returns the results, for cron and download client hooks
+// if path is empty, all opts.ScanDirs are scanned, entries in backoff are skipped,
+// if path is a scan dir, only that scan dir is scanned,
+// otherwise path is a single entry of a scan dir, it is run regardless of its backoff and settle durations,
+// any other path is an error, its state would not be the one of the daemon
+// settling across two scans is never used, there is only one scan
+// it fails with ErrDataDirLocked while the daemon runs on the same data dir, so their journals and state do not race
+func (pm *ParserMgr) RunOnce(ctx context.Context, opts *ParserMgrRunOpts, path string) (*RunSummary, error) {
+	pm.sleepDurParse = opts.SleepDurParse
+	onceOpts := *opts
+	onceOpts.Settle.TwoScans = false
+	opts = &onceOpts
+	scanDirs := opts.ScanDirs
+	entryName := ""
+	if path != "" {
+		scanDir, ok := findScanDir(opts.ScanDirs, path)
+		if !ok {
+			scanDir, ok = findScanDir(opts.ScanDirs, filepath.Dir(path))
+			entryName = filepath.Base(path)
+		}
+		if !ok {
+			return nil, errNotInScanDirs(path, opts.ScanDirs)
+		}
+		scanDirs = []string{scanDir}
+	}
+	if len(scanDirs) == 0 {
+		return nil, fmt.Errorf("no scan dirs")
+	}
+	release, err := lockDataDir(pm.dataDir)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	allDirOpts, err := pm.prepareScanDirs(opts, scanDirs)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.DryRun {
+		pm.recoverJournals(opts.Recovery)
+	}
+	summary := &RunSummary{}
+	for i, scanDir := range scanDirs {
+		if ctx.Err() != nil {
+			break
+		}
+		var results []*EntryResult
+		if entryName != "" {
+			results, err = pm.runEntryOnce(ctx, scanDir, entryName, allDirOpts[i])
+		} else {
+			results, err = pm.runScanDirOnce(ctx, scanDir, allDirOpts[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+		summary.Results = append(summary.Results, results...)
+	}
+	return summary, ctx.Err()
+}
+
+func (pm *ParserMgr) runScanDirOnce(ctx context.Context, scanDir string, opts *ParserMgrRunOpts) ([]*EntryResult, error) {
+	doNextTime := pm.state.load(scanDir)
+	settle := newSettleTracker(opts.Settle)
+	now := time.Now()
+	entries, err := pm.scanEntries(scanDir, doNextTime, settle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan motherDir: %v", err)
+	}
+	results := pm.runEntries(ctx, entries, doNextTime, settle, now, opts)
+	pm.saveState(scanDir, doNextTime)
+	return results, nil
+}
+
+func (pm *ParserMgr) runEntryOnce(ctx context.Context, scanDir, entryName string, opts *ParserMgrRunOpts) ([]*EntryResult, error) {
+	entry, err := dirinfo.ScanEntry(scanDir, entryName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan entry: %v", err)
+	}
+	doNextTime := pm.state.load(scanDir)
+	delete(doNextTime, entryName)
+	settle := newSettleTracker(SettleOpts{PartialExts: opts.Settle.PartialExts})
+	results := pm.runEntries(ctx, []*dirinfo.Entry{entry}, doNextTime, settle, time.Now(), opts)
+	pm.saveState(scanDir, doNextTime)
+	return results, nil
+}
+
+// errNotInScanDirs is the error of a path that is neither a configured scan dir nor an entry of one
+func errNotInScanDirs(path string, scanDirs []string) error {
+	return fmt.Errorf("%w: %s is not a configured scan dir or an entry of one, scan dirs = %q", ErrScanDirNotFound, path, scanDirs)
+}
+
+// findScanDir returns the configured scan dir same as dir, so its options and state are used,
+// dir itself and false if none
+func findScanDir(scanDirs []string, dir string) (string, bool) {
+	for _, scanDir := range scanDirs {
+		if filepath.Clean(scanDir) == filepath.Clean(dir) {
+			return scanDir, true
+		}
+	}
+	return dir, false
+}
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+
+	"asmediamgr/pkg/dirinfo"
+	"asmediamgr/pkg/disk"
+)
+
+// trashParser matches entry "a" only, by moving it to trash
+type trashParser struct {
+	trashDir string
+}
+
+func (p *trashParser) IsDefaultEnable() bool {
+	return true
+}
+
+func (p *trashParser) Init(cfgPath string, logger log.Logger) (priority float32, err error) {
+	return 0, nil
+}
+
+func (p *trashParser) Parse(entry *dirinfo.Entry, opts *ParserMgrRunOpts) (plan *disk.Plan, err error) {
+	if entry.Name() != "a" {
+		return nil, nil
+	}
+	plan = &disk.Plan{}
+	plan.AddMoveToTrash(&disk.MoveToTrashTask{Path: filepath.Join(entry.MotherPath, entry.Name()), TrashDir: p.trashDir})
+	return plan, nil
+}
+
+func TestRunOnce(t *testing.T) {
+	scanDir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		err := os.Mkdir(filepath.Join(scanDir, name), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	state, err := newStateStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	review, err := newReviewQueue("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &ParserMgr{
+		logger:  log.NewNopLogger(),
+		parsers: []parserInfo{{name: "trash", parser: &trashParser{trashDir: t.TempDir()}}},
+		state:   state,
+		review:  review,
+	}
+	opts := &ParserMgrRunOpts{
+		ScanDirs: []string{scanDir},
+		Settle:   SettleOpts{TwoScans: true},
+		DryRun:   true,
+	}
+
+	summary, err := pm.RunOnce(context.Background(), opts, "")
+	if err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if summary.Count(EntryMatched) != 1 || summary.Count(EntryFailed) != 1 || summary.Count(EntrySkipped) != 0 {
+		t.Fatalf("RunOnce() got = %s", summary)
+	}
+
+	summary, err = pm.RunOnce(context.Background(), opts, scanDir+string(filepath.Separator))
+	if err != nil {
+		t.Fatalf("RunOnce() scan dir error = %v", err)
+	}
+	if summary.Count(EntrySkipped) != 2 {
+		t.Fatalf("RunOnce() scan dir should skip entries in backoff, got = %s", summary)
+	}
+
+	summary, err = pm.RunOnce(context.Background(), opts, filepath.Join(scanDir, "b"))
+	if err != nil {
+		t.Fatalf("RunOnce() entry error = %v", err)
+	}
+	if len(summary.Results) != 1 || summary.Results[0].Status != EntryFailed || summary.Results[0].Entry != "b" {
+		t.Fatalf("RunOnce() entry should be run regardless of backoff, got = %s", summary)
+	}
+
+	if _, err := pm.RunOnce(context.Background(), opts, filepath.Join(scanDir, "c")); err == nil {
+		t.Fatalf("RunOnce() missing entry should fail")
+	}
+	if _, err := pm.RunOnce(context.Background(), opts, filepath.Join(t.TempDir(), "a")); !errors.Is(err, ErrScanDirNotFound) {
+		t.Fatalf("RunOnce() entry of an unconfigured dir error = %v", err)
+	}
+}
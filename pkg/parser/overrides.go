@@ -0,0 +1,186 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/BurntSushi/toml"
+
+	"asmediamgr/pkg/common"
+)
+
+const (
+	// OverridesFileName is the overrides file in the parser config dir
+	OverridesFileName = "overrides.toml"
+)
+
+// Override is a manual match of entries, consulted before parsers
+// parsers still match files of the entry, but use Tmdbid instead of searching tmdb, and only parsers of
+// MediaType run the entry, Season and EpisodeOffset replace what tv parsers scraped
+type Override struct {
+	Name          string `toml:"name"`           // exact entry name
+	Glob          string `toml:"glob"`           // entry name glob, filepath.Match syntax
+	Regex         string `toml:"regex"`          // entry name regex
+	MediaTypeStr  string `toml:"media_type"`     // "tv" or "movie"
+	Tmdbid        int    `toml:"tmdbid"`         // tmdbid of the tv or movie
+	Season        *int   `toml:"season"`         // optional, tv only
+	EpisodeOffset *int   `toml:"episode_offset"` // optional, tv only, added to scraped episodes
+	MediaType     common.MediaType
+	regex         *regexp.Regexp
+}
+
+type overridesConfig struct {
+	Overrides []*Override `toml:"overrides"`
+}
+
+// Skip returns true if parsers of mediaType should not run the entry, always false without override
+func (ov *Override) Skip(mediaType common.MediaType) bool {
+	return ov != nil && ov.MediaType != mediaType
+}
+
+// ApplyTv returns season and episode with the override applied
+func (ov *Override) ApplyTv(season, episode int) (int, int) {
+	if ov == nil {
+		return season, episode
+	}
+	if ov.Season != nil {
+		season = *ov.Season
+	}
+	if ov.EpisodeOffset != nil {
+		episode += *ov.EpisodeOffset
+	}
+	return season, episode
+}
+
+func (ov *Override) match(entryName string) bool {
+	switch {
+	case ov.Name != "":
+		return ov.Name == entryName
+	case ov.Glob != "":
+		ok, _ := filepath.Match(ov.Glob, entryName) // pattern checked on load
+		return ok
+	default:
+		return ov.regex.MatchString(entryName)
+	}
+}
+
+func (ov *Override) String() string {
+	switch {
+	case ov.Name != "":
+		return "name " + ov.Name
+	case ov.Glob != "":
+		return "glob " + ov.Glob
+	default:
+		return "regex " + ov.Regex
+	}
+}
+
+// ParseMediaType parses "tv" or "movie", as media_type of overrides, review and plugins
+func ParseMediaType(str string) (common.MediaType, error) {
+	switch str {
+	case "tv":
+		return common.MediaTypeTv, nil
+	case "movie":
+		return common.MediaTypeMovie, nil
+	default:
+		return 0, fmt.Errorf("invalid media_type %q", str)
+	}
+}
+
+// MediaTypeString is the reverse of ParseMediaType
+func MediaTypeString(mediaType common.MediaType) string {
+	switch mediaType {
+	case common.MediaTypeTv:
+		return "tv"
+	case common.MediaTypeMovie:
+		return "movie"
+	default:
+		return ""
+	}
+}
+
+// loadOverrides loads and checks the overrides file, a missing file means no overrides
+func loadOverrides(path string) ([]*Override, error) {
+	cfg := &overridesConfig{}
+	_, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("DecodeFile() error = %v", err)
+	}
+	for i, ov := range cfg.Overrides {
+		matchers := 0
+		for _, s := range []string{ov.Name, ov.Glob, ov.Regex} {
+			if s != "" {
+				matchers++
+			}
+		}
+		if matchers != 1 {
+			return nil, fmt.Errorf("override %d: exactly one of name, glob and regex is required", i)
+		}
+		if ov.Glob != "" {
+			if _, err := filepath.Match(ov.Glob, ""); err != nil {
+				return nil, fmt.Errorf("override %d: invalid glob %s: %v", i, ov.Glob, err)
+			}
+		}
+		if ov.Regex != "" {
+			ov.regex, err = regexp.Compile(ov.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("override %d: Compile() error = %v", i, err)
+			}
+		}
+		ov.MediaType, err = ParseMediaType(ov.MediaTypeStr)
+		if err != nil {
+			return nil, fmt.Errorf("override %d: %v", i, err)
+		}
+		if ov.MediaType == common.MediaTypeMovie && (ov.Season != nil || ov.EpisodeOffset != nil) {
+			return nil, fmt.Errorf("override %d: season and episode_offset are tv only", i)
+		}
+		if ov.Tmdbid <= 0 {
+			return nil, fmt.Errorf("override %d: invalid tmdbid %d", i, ov.Tmdbid)
+		}
+	}
+	return cfg.Overrides, nil
+}
+
+// reloadOverrides reloads the overrides file and the absolute episode mapping file, both manual tables,
+// the previous ones are kept if either has any error
+func (pm *ParserMgr) reloadOverrides() error {
+	overrides, err := loadOverrides(filepath.Join(pm.configDir, OverridesFileName))
+	if err != nil {
+		return err
+	}
+	absolute, err := loadAbsoluteEpisodes(filepath.Join(pm.configDir, AbsoluteFileName))
+	if err != nil {
+		return fmt.Errorf("%s: %v", AbsoluteFileName, err)
+	}
+	pm.overridesMu.Lock()
+	defer pm.overridesMu.Unlock()
+	pm.overrides = overrides
+	pm.absolute = absolute
+	return nil
+}
+
+// matchOverride returns the first override matching entryName in file order, nil if none
+func (pm *ParserMgr) matchOverride(entryName string) *Override {
+	pm.overridesMu.RLock()
+	defer pm.overridesMu.RUnlock()
+	for _, ov := range pm.overrides {
+		if ov.match(entryName) {
+			return ov
+		}
+	}
+	return nil
+}
+
+// resetOverridden drops records of entries matched by an override, so they run at the next scan
+func (pm *ParserMgr) resetOverridden(doNextTime map[string]*failNextTime) {
+	for entryName := range doNextTime {
+		if pm.matchOverride(entryName) != nil {
+			delete(doNextTime, entryName)
+		}
+	}
+}
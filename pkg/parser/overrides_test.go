@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+
+	"asmediamgr/pkg/common"
+)
+
+func TestLoadOverrides(t *testing.T) {
+	dir := t.TempDir()
+	overrides, err := loadOverrides(filepath.Join(dir, OverridesFileName))
+	if err != nil || overrides != nil {
+		t.Fatalf("loadOverrides() missing file got = %v, %v", overrides, err)
+	}
+	path := filepath.Join(dir, OverridesFileName)
+	err = os.WriteFile(path, []byte(`
+[[overrides]]
+name = "Exact Name 2024"
+media_type = "movie"
+tmdbid = 1
+
+[[overrides]]
+glob = '\[Group\] Show - *'
+media_type = "tv"
+tmdbid = 2
+season = 2
+
+[[overrides]]
+regex = '^Other Show S\d+'
+media_type = "tv"
+tmdbid = 3
+episode_offset = -12
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &ParserMgr{logger: log.NewNopLogger(), configDir: dir}
+	err = pm.reloadOverrides()
+	if err != nil {
+		t.Fatalf("reloadOverrides() error = %v", err)
+	}
+	tests := []struct {
+		entryName string
+		tmdbid    int
+		mediaType common.MediaType
+	}{
+		{"Exact Name 2024", 1, common.MediaTypeMovie},
+		{"Exact Name 2024 extra", 0, 0},
+		{"[Group] Show - 05 [1080p].mkv", 2, common.MediaTypeTv},
+		{"Other Show S02 1080p", 3, common.MediaTypeTv},
+	}
+	for _, tt := range tests {
+		override := pm.matchOverride(tt.entryName)
+		if tt.tmdbid == 0 {
+			if override != nil {
+				t.Fatalf("matchOverride(%s) got = %v, want = nil", tt.entryName, override)
+			}
+			continue
+		}
+		if override == nil || override.Tmdbid != tt.tmdbid || override.MediaType != tt.mediaType {
+			t.Fatalf("matchOverride(%s) got = %+v, want tmdbid = %d", tt.entryName, override, tt.tmdbid)
+		}
+	}
+	season, episode := pm.matchOverride("Other Show S02 1080p").ApplyTv(2, 13)
+	if season != 2 || episode != 1 {
+		t.Fatalf("ApplyTv() got = %d, %d, want = 2, 1", season, episode)
+	}
+
+	err = os.WriteFile(path, []byte("[[overrides]]\nname = \"name\"\nmedia_type = \"music\"\ntmdbid = 1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.reloadOverrides(); err == nil {
+		t.Fatalf("reloadOverrides() invalid media_type should fail")
+	}
+	if pm.matchOverride("Exact Name 2024") == nil {
+		t.Fatalf("reloadOverrides() previous overrides should be kept")
+	}
+}
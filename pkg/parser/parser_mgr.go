@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"os"
@@ -17,6 +18,7 @@ import (
 
 	"asmediamgr/pkg/common"
 	"asmediamgr/pkg/dirinfo"
+	"asmediamgr/pkg/dirwatch"
 	"asmediamgr/pkg/disk"
 )
 
@@ -48,6 +50,11 @@ type TmdbService interface {
 	GetMovieDetails(id int, urlOptions map[string]string) (*tmdb.MovieDetails, error)
 	GetSearchTVShow(query string, urlOptions map[string]string) (*tmdb.SearchTVShows, error)
 	GetTVDetails(id int, urlOptions map[string]string) (*tmdb.TVDetails, error)
+	GetTVSeasonDetails(id, seasonNumber int, urlOptions map[string]string) (*tmdb.TVSeasonDetails, error)
+	GetTVEpisodeGroupsDetails(id string, urlOptions map[string]string) (*tmdb.TVEpisodeGroupsDetails, error)
+	GetMovieAlternativeTitles(id int, urlOptions map[string]string) (*tmdb.MovieAlternativeTitles, error)
+	GetTVAlternativeTitles(id int, urlOptions map[string]string) (*tmdb.TVAlternativeTitles, error)
+	GetSearchMulti(query string, urlOptions map[string]string) (*tmdb.SearchMulti, error)
 }
 
 // DiskService is a service that can do real disk operations, such as rename files, etc
@@ -57,6 +64,9 @@ type DiskService interface {
 	RenameMovie(task *disk.MovieRenameTask) error
 	RenameMovieSubtitle(task *disk.MovieSubtitleRenameTask) error
 	MoveToTrash(task *disk.MoveToTrashTask) error
+	BeginPlan(plan *disk.Plan, tag disk.AuditTag) (journalID string, err error)
+	EndPlan(journalID string, succ bool) (reverted []*disk.AuditRecord, err error)
+	RecoverJournals(policy disk.RecoveryPolicy) (records []*disk.AuditRecord, err error)
 }
 
 var (
@@ -116,16 +126,19 @@ func GetDefaultDiskService() DiskService {
 }
 
 // Parserable is an interface for parsers
+// Parse only matches the entry and returns the plan of disk operations, nil plan means no match,
+// the plan is validated and run by ParserMgr through DiskService
 type Parserable interface {
 	IsDefaultEnable() bool
 	Init(cfgPath string, logger log.Logger) (priority float32, err error)
-	Parse(entry *dirinfo.Entry, opts *ParserMgrRunOpts) (ok bool, err error)
+	Parse(entry *dirinfo.Entry, opts *ParserMgrRunOpts) (plan *disk.Plan, err error)
 }
 
 // ParserMgrOpts is the options for the parser
 type ParserMgrOpts struct {
 	Logger         log.Logger // logger
 	ConfigDir      string     // config tomls dir
+	DataDir        string     // data dir to persist runtime state, empty means no persistence
 	EnableParsers  []string   // enable parsers
 	DisableParsers []string   // disable parsers, higher priority than enable parsers
 }
@@ -157,8 +170,31 @@ func NewParserMgr(opts *ParserMgrOpts) (*ParserMgr, error) {
 			enableParsers[name] = parser
 		}
 	}
+	state, err := newStateStore(opts.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load parser state: %v", err)
+	}
+	review, err := newReviewQueue(opts.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load review queue: %v", err)
+	}
+	var audit *disk.AuditLog
+	if opts.DataDir != "" {
+		audit = disk.NewAuditLog(filepath.Join(opts.DataDir, disk.AuditFileName))
+	}
 	pm := &ParserMgr{
-		logger: opts.Logger,
+		logger:    opts.Logger,
+		configDir: opts.ConfigDir,
+		dataDir:   opts.DataDir,
+		state:     state,
+		review:    review,
+		audit:     audit,
+		cmds:      make(map[string]chan dirCmd),
+		paused:    make(map[string]bool),
+	}
+	err = pm.reloadOverrides()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load overrides: %v", err)
 	}
 	for name, parser := range enableParsers {
 		cfgPath := filepath.Join(opts.ConfigDir, name+".toml")
@@ -186,7 +222,13 @@ func (a byPriority) Len() int { return len(a) }
 
 func (a byPriority) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
 
-func (a byPriority) Less(i, j int) bool { return a[i].priority < a[j].priority }
+// Less orders by priority, then by name, so parsers of the same priority run in a stable order
+func (a byPriority) Less(i, j int) bool {
+	if a[i].priority != a[j].priority {
+		return a[i].priority < a[j].priority
+	}
+	return a[i].name < a[j].name
+}
 
 // parserInfo is a struct that holds the parser info
 type parserInfo struct {
@@ -198,106 +240,417 @@ type parserInfo struct {
 // ParserMgr is a struct that holds the parser
 type ParserMgr struct {
 	logger        log.Logger
+	configDir     string
+	dataDir       string // locked while parsers run, empty means no persistence
 	parsers       []parserInfo
-	sleepDurScan  time.Duration
+	state         *stateStore
 	sleepDurParse time.Duration
+	reloadMu      sync.Mutex      // serializes config reloads, guards reloadSubs
+	reloadSubs    []chan struct{} // scan dir goroutines notified after configs are reloaded
+	overridesMu   sync.RWMutex    // guards overrides and absolute
+	overrides     []*Override
+	absolute      *AbsoluteEpisodes
+	review        *reviewQueue
+	audit         *disk.AuditLog         // nil means no audit
+	dirsMu        sync.Mutex             // guards cmds and paused
+	cmds          map[string]chan dirCmd // scan dir -> commands to its goroutine, requested by review and admin
+	paused        map[string]bool        // scan dirs paused by admin
 }
 
 // ParserMgrRunOpts is the runtime options for the parser
 type ParserMgrRunOpts struct {
 	ScanDirs      []string
+	ScanDirOpts   map[string]*ScanDirOpts // per scan dir options, keyed by scan dir
 	MediaTypeDirs map[common.MediaType]string
+	Parsers       []string // enabled parsers subset, still run in priority order, empty means all enabled parsers
 	SleepDurScan  time.Duration
-	SleepDurParse time.Duration
+	SleepDurParse time.Duration       // extra sleep after each parser run, 0 means no sleep, tmdb is rate limited by TmdbService
+	Workers       int                 // entries run in parallel within a scan dir
+	Watch         bool                // watch scan dirs to run changed entries right away, full scan is kept as fallback
+	WatchDebounce time.Duration       // run a changed entry only after it is quiet for this duration
+	Settle        SettleOpts          // policy to skip entries still being written
+	DryRun        bool                // print the plan of matched entries instead of running it
+	Recovery      disk.RecoveryPolicy // how plans left unfinished by a crash are recovered on start
+	Override      *Override           // manual match of the entry being run, set by ParserMgr, nil if none
+	Absolute      *AbsoluteEpisodes   // absolute episode mappings, set by ParserMgr
+	Trace         *Trace              // records how the entry is parsed, set by Explain, nil if not explaining
+}
+
+// ScanDirOpts is the options of a single scan dir, empty fields fall back to ParserMgrRunOpts
+type ScanDirOpts struct {
+	MediaTypeDirs map[common.MediaType]string // target dirs, override the same media type in ParserMgrRunOpts
+	Parsers       []string                    // enabled parsers subset
+	SleepDurScan  time.Duration               // scan interval
+	Workers       int                         // entries run in parallel
+}
+
+// forScanDir returns the runtime options of scanDir, ScanDirOpts merged, parsers are passed this options
+func (opts *ParserMgrRunOpts) forScanDir(scanDir string) *ParserMgrRunOpts {
+	dirOpts := *opts
+	dirOpts.ScanDirs = []string{scanDir}
+	dirOpts.ScanDirOpts = nil
+	dirOpts.MediaTypeDirs = make(map[common.MediaType]string)
+	for mediaType, dir := range opts.MediaTypeDirs {
+		dirOpts.MediaTypeDirs[mediaType] = dir
+	}
+	if dirOpts.SleepDurScan == 0 {
+		dirOpts.SleepDurScan = defaultScanSleepDur
+	}
+	if dirOpts.Workers <= 0 {
+		dirOpts.Workers = defaultWorkers
+	}
+	override, ok := opts.ScanDirOpts[scanDir]
+	if !ok || override == nil {
+		return &dirOpts
+	}
+	for mediaType, dir := range override.MediaTypeDirs {
+		dirOpts.MediaTypeDirs[mediaType] = dir
+	}
+	if len(override.Parsers) > 0 {
+		dirOpts.Parsers = override.Parsers
+	}
+	if override.SleepDurScan > 0 {
+		dirOpts.SleepDurScan = override.SleepDurScan
+	}
+	if override.Workers > 0 {
+		dirOpts.Workers = override.Workers
+	}
+	return &dirOpts
 }
 
 const (
-	defaultScanSleepDur  = time.Duration(5) * time.Minute // default sleep duration for scanning
-	defaultParseSleepDur = time.Duration(1) * time.Second // default sleep duration for parsing
+	defaultScanSleepDur = time.Duration(5) * time.Minute // default sleep duration for scanning
+	defaultWorkers      = 1                              // default workers of a scan dir
+	dirCmdBuffer        = 64                             // max pending commands of a scan dir
 )
 
 // RunParsers runs the parsers with the options, maybe in multiple dirs, with multiple goroutines
-func (pm *ParserMgr) RunParsers(opts *ParserMgrRunOpts) error {
-	if opts.SleepDurScan == 0 {
-		pm.sleepDurScan = defaultScanSleepDur
-	} else {
-		pm.sleepDurScan = opts.SleepDurScan
-	}
-	if opts.SleepDurParse == 0 {
-		pm.sleepDurParse = defaultParseSleepDur
-	} else {
-		pm.sleepDurParse = opts.SleepDurParse
-	}
+// it returns after ctx is done and all in-flight entries are finished, ErrDataDirLocked if another process runs
+func (pm *ParserMgr) RunParsers(ctx context.Context, opts *ParserMgrRunOpts) error {
+	pm.sleepDurParse = opts.SleepDurParse
 	if len(opts.ScanDirs) == 0 {
 		return fmt.Errorf("no scan dirs")
 	}
-	var wg sync.WaitGroup
+	release, err := lockDataDir(pm.dataDir)
+	if err != nil {
+		return err
+	}
+	defer release()
+	allDirOpts, err := pm.prepareScanDirs(opts, opts.ScanDirs)
+	if err != nil {
+		return err
+	}
+	pm.state.retain(opts.ScanDirs)
+	if !opts.DryRun {
+		pm.recoverJournals(opts.Recovery)
+	}
+	pm.dirsMu.Lock()
 	for _, scanDir := range opts.ScanDirs {
+		pm.cmds[scanDir] = make(chan dirCmd, dirCmdBuffer)
+	}
+	pm.dirsMu.Unlock()
+	var wg sync.WaitGroup
+	for i, scanDir := range opts.ScanDirs {
 		wg.Add(1)
+		go pm.runParsersWithDir(ctx, &wg, scanDir, allDirOpts[i])
+	}
+	wg.Wait()
+	return nil
+}
+
+// prepareScanDirs checks scanDirs and returns their runtime options
+func (pm *ParserMgr) prepareScanDirs(opts *ParserMgrRunOpts, scanDirs []string) ([]*ParserMgrRunOpts, error) {
+	var allDirOpts []*ParserMgrRunOpts
+	for _, scanDir := range scanDirs {
 		_, err := os.Stat(scanDir)
 		if err != nil {
-			return fmt.Errorf("failed to stat scanDir: %v", err)
+			return nil, fmt.Errorf("failed to stat scanDir: %v", err)
+		}
+		dirOpts := opts.forScanDir(scanDir)
+		for _, name := range dirOpts.Parsers {
+			if _, ok := pm.parserInfo(name); !ok {
+				return nil, fmt.Errorf("scanDir %s: parser %s not enabled", scanDir, name)
+			}
 		}
-		go pm.runParsersWithDir(&wg, scanDir, opts)
+		allDirOpts = append(allDirOpts, dirOpts)
 	}
-	wg.Wait()
-	return nil
+	return allDirOpts, nil
 }
 
 // failNextTime is a struct that holds the next time to run the parser
 // prevent the parser from running too frequently
 type failNextTime struct {
-	validTime time.Time // valid to run time for entry
-	failCnt   int32     // fail count
+	ValidTime time.Time `json:"valid_time"`         // valid to run time for entry
+	FailCnt   int32     `json:"fail_cnt"`           // fail count
+	LastErr   string    `json:"last_err,omitempty"` // last parser error, if any
 }
 
 // runParsersWithDir runs the parsers with the dir
 // TODO need unittest for this function
-func (pm *ParserMgr) runParsersWithDir(wg *sync.WaitGroup, scanDir string, opts *ParserMgrRunOpts) {
+func (pm *ParserMgr) runParsersWithDir(ctx context.Context, wg *sync.WaitGroup, scanDir string, opts *ParserMgrRunOpts) {
 	defer wg.Done()
-	doNextTime := make(map[string]*failNextTime)
-	for {
+	doNextTime := pm.state.load(scanDir)
+	settle := newSettleTracker(opts.Settle)
+	events := &dirEvents{
+		reload:   pm.subscribeReload(),
+		cmds:     pm.cmdChan(scanDir),
+		rechecks: make(chan string, dirCmdBuffer),
+		pending:  make(map[string]*time.Timer),
+	}
+	defer events.stopRechecks()
+	if opts.Watch {
+		var err error
+		events.changes, err = dirwatch.Watch(ctx, scanDir, opts.WatchDebounce)
+		if err != nil {
+			level.Warn(pm.logger).Log("msg", "failed to watch scanDir, fallback to polling", "scanDir", scanDir, "err", err)
+		}
+	}
+	for ctx.Err() == nil {
 		now := time.Now()
-		scanDirRunTotal.With(prometheus.Labels{"scan_dir": scanDir}).Inc()
-		entries, err := dirinfo.ScanMotherDir(scanDir)
+		entries, err := pm.scanEntries(scanDir, doNextTime, settle)
 		if err != nil {
 			level.Error(pm.logger).Log("msg", fmt.Sprintf("failed to scan motherDir: %v", err))
-			time.Sleep(pm.sleepDurScan)
+			common.SleepContext(ctx, opts.SleepDurScan)
 			break
 		}
-		entriesMap := make(map[string]struct{})
-		for _, entry := range entries {
-			entriesMap[entry.Name()] = struct{}{}
+		if pm.isPaused(scanDir) {
+			level.Debug(pm.logger).Log("msg", "scanDir paused, skip", "scanDir", scanDir)
+		} else {
+			pm.runEntries(ctx, entries, doNextTime, settle, now, opts)
 		}
-		for entryName := range doNextTime {
-			if _, ok := entriesMap[entryName]; !ok {
-				delete(doNextTime, entryName)
-			}
+		pm.saveState(scanDir, doNextTime)
+		pm.waitNextScan(ctx, scanDir, events, doNextTime, settle, opts)
+	}
+}
+
+// scanEntries scans entries of scanDir, and drops records, snapshots and review items of entries gone
+func (pm *ParserMgr) scanEntries(scanDir string, doNextTime map[string]*failNextTime, settle *settleTracker) ([]*dirinfo.Entry, error) {
+	scanDirRunTotal.With(prometheus.Labels{"scan_dir": scanDir}).Inc()
+	entries, err := dirinfo.ScanMotherDir(scanDir)
+	if err != nil {
+		return nil, err
+	}
+	entriesMap := make(map[string]struct{})
+	for _, entry := range entries {
+		entriesMap[entry.Name()] = struct{}{}
+	}
+	for entryName := range doNextTime {
+		if _, ok := entriesMap[entryName]; !ok {
+			delete(doNextTime, entryName)
 		}
-		for _, entry := range entries {
-			nextTime, ok := doNextTime[entry.Name()]
+	}
+	settle.prune(entriesMap)
+	if err := pm.review.retain(scanDir, entriesMap); err != nil {
+		level.Error(pm.logger).Log("msg", "failed to save review queue", "err", err)
+	}
+	return entries, nil
+}
+
+// dirEvents are the events a scan dir goroutine waits for between full scans
+type dirEvents struct {
+	changes <-chan string   // changed entries reported by the watcher, nil if not watching
+	reload  <-chan struct{} // configs reloaded
+	cmds    <-chan dirCmd   // commands requested by review and admin
+
+	rechecks chan string            // changed entries not settled yet, sent by pending timers
+	pending  map[string]*time.Timer // entry -> timer to recheck it, only touched by the scan dir goroutine
+}
+
+// scheduleRecheck sends entryName to rechecks after wait, a pending recheck of the entry is replaced,
+// a recheck is dropped if rechecks is full, the next full scan picks the entry up anyway, a nil dirEvents schedules nothing
+func (e *dirEvents) scheduleRecheck(entryName string, wait time.Duration) {
+	if e == nil {
+		return
+	}
+	if timer, ok := e.pending[entryName]; ok {
+		timer.Stop()
+	}
+	e.pending[entryName] = time.AfterFunc(wait, func() {
+		select {
+		case e.rechecks <- entryName:
+		default:
+		}
+	})
+}
+
+func (e *dirEvents) stopRechecks() {
+	for entryName, timer := range e.pending {
+		timer.Stop()
+		delete(e.pending, entryName)
+	}
+}
+
+// waitNextScan waits sleepDurScan before the next full scan, entries reported changed by the
+// watcher are run right away in the meantime unless the scan dir is paused, commands are handled by handleCmd,
+// events.changes is set to nil if the watcher stopped
+// a config reload resets entries without a match and starts the next full scan right away
+func (pm *ParserMgr) waitNextScan(ctx context.Context, scanDir string, events *dirEvents, doNextTime map[string]*failNextTime, settle *settleTracker, opts *ParserMgrRunOpts) {
+	timer := time.NewTimer(opts.SleepDurScan)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			return
+		case <-events.reload:
+			level.Info(pm.logger).Log("msg", "configs reloaded, rescan", "scanDir", scanDir)
+			resetNoMatch(doNextTime)
+			pm.resetOverridden(doNextTime)
+			return
+		case entryName, ok := <-events.changes:
 			if !ok {
-				nextTime = &failNextTime{validTime: now, failCnt: 0}
-				doNextTime[entry.Name()] = nextTime
+				if ctx.Err() == nil {
+					level.Warn(pm.logger).Log("msg", "watcher stopped, fallback to polling", "scanDir", scanDir)
+				}
+				events.changes = nil
+				continue
 			}
-			if nextTime.validTime.After(now) {
+			if pm.isPaused(scanDir) {
 				continue
 			}
-			parserName, err := pm.runEntry(entry, opts)
-			if err != nil {
-				level.Error(pm.logger).Log("msg", "run entry err", "entry", entry.Name(), "err", err)
-				time.Sleep(pm.sleepDurScan)
+			pm.runChangedEntry(ctx, scanDir, entryName, events, doNextTime, settle, opts)
+			pm.saveState(scanDir, doNextTime)
+		case entryName := <-events.rechecks:
+			delete(events.pending, entryName)
+			if pm.isPaused(scanDir) {
+				continue
+			}
+			pm.runChangedEntry(ctx, scanDir, entryName, events, doNextTime, settle, opts)
+			pm.saveState(scanDir, doNextTime)
+		case cmd := <-events.cmds:
+			if pm.handleCmd(ctx, scanDir, cmd, events, doNextTime, settle, opts) {
 				return
 			}
-			nextTime.failCnt++
-			nextTime.validTime = now.Add(punishAddTime(nextTime.failCnt))
-			if parserName != "" {
-				level.Info(pm.logger).Log("msg", "entry parser succ", "entry", entry.Name(), "parser", parserName)
-			} else {
-				level.Warn(pm.logger).Log("msg", "entry parser fail", "entry", entry.Name(), "nextValidTime", nextTime.validTime, "failCnt", nextTime.failCnt)
+		}
+	}
+}
+
+// runChangedEntry runs a single entry reported changed by the watcher, its backoff is reset
+// because new content may make it matchable now, an entry not settled yet is checked again when it may be,
+// instead of waiting for the next full scan
+func (pm *ParserMgr) runChangedEntry(ctx context.Context, scanDir, entryName string, events *dirEvents, doNextTime map[string]*failNextTime, settle *settleTracker, opts *ParserMgrRunOpts) {
+	entry, err := dirinfo.ScanEntry(scanDir, entryName)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			level.Error(pm.logger).Log("msg", "failed to scan changed entry", "entry", entryName, "err", err)
+		}
+		delete(doNextTime, entryName)
+		delete(settle.snapshots, entryName)
+		return
+	}
+	level.Debug(pm.logger).Log("msg", "entry changed", "scanDir", scanDir, "entry", entryName)
+	delete(doNextTime, entry.Name())
+	now := time.Now()
+	if nextTime, ok, _ := pm.readyToRun(entry, doNextTime, settle, now); ok {
+		pm.runAndPunish(ctx, entry, nextTime, now, opts)
+		return
+	}
+	if wait, ok := settle.recheckAfter(entry, now, opts.WatchDebounce); ok {
+		level.Debug(pm.logger).Log("msg", "entry not settled, recheck later", "entry", entryName, "wait", wait)
+		events.scheduleRecheck(entryName, wait)
+	}
+}
+
+// runEntries runs entries with a pool of opts.Workers workers, an entry is always run by a single worker
+// doNextTime and settle are only touched by the caller goroutine, a worker only updates the record of its entry
+// it returns the result of every entry not interrupted by ctx, in no particular order
+// pause is checked before each entry is dispatched, entries left after a pause are skipped
+func (pm *ParserMgr) runEntries(ctx context.Context, entries []*dirinfo.Entry, doNextTime map[string]*failNextTime, settle *settleTracker, now time.Time, opts *ParserMgrRunOpts) []*EntryResult {
+	workers := make(chan struct{}, opts.Workers)
+	var wg sync.WaitGroup
+	var resultsMu sync.Mutex
+	var results []*EntryResult
+	addResult := func(result *EntryResult) {
+		resultsMu.Lock()
+		defer resultsMu.Unlock()
+		results = append(results, result)
+	}
+	for _, entry := range entries {
+		nextTime, ok, reason := pm.readyToRun(entry, doNextTime, settle, now)
+		if !ok {
+			addResult(&EntryResult{ScanDir: entry.MotherPath, Entry: entry.Name(), Status: EntrySkipped, Reason: reason})
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return results
+		case workers <- struct{}{}:
+		}
+		if pm.isPaused(entry.MotherPath) {
+			<-workers
+			addResult(&EntryResult{ScanDir: entry.MotherPath, Entry: entry.Name(), Status: EntrySkipped, Reason: "paused"})
+			continue
+		}
+		wg.Add(1)
+		go func(entry *dirinfo.Entry, nextTime *failNextTime) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			if result := pm.runAndPunish(ctx, entry, nextTime, now, opts); result != nil {
+				addResult(result)
 			}
+		}(entry, nextTime)
+	}
+	wg.Wait()
+	return results
+}
+
+// readyToRun returns the record of the entry if its backoff is over and it is settled, otherwise the reason to skip it
+func (pm *ParserMgr) readyToRun(entry *dirinfo.Entry, doNextTime map[string]*failNextTime, settle *settleTracker, now time.Time) (nextTime *failNextTime, ok bool, reason string) {
+	nextTime, ok = doNextTime[entry.Name()]
+	if !ok {
+		nextTime = &failNextTime{ValidTime: now, FailCnt: 0}
+		doNextTime[entry.Name()] = nextTime
+	}
+	if nextTime.ValidTime.After(now) {
+		return nil, false, fmt.Sprintf("backoff until %s", nextTime.ValidTime.Format(time.RFC3339))
+	}
+	if ok, reason := settle.settled(entry, now); !ok {
+		level.Debug(pm.logger).Log("msg", "entry not settled, skip", "entry", entry.Name(), "reason", reason)
+		return nil, false, reason
+	}
+	return nextTime, true, ""
+}
+
+// runAndPunish runs the entry and punishes it for the next time
+// returns nil if interrupted by ctx
+func (pm *ParserMgr) runAndPunish(ctx context.Context, entry *dirinfo.Entry, nextTime *failNextTime, now time.Time, opts *ParserMgrRunOpts) *EntryResult {
+	parserName, parseErr := pm.runEntry(ctx, entry, opts)
+	if parserName == "" && ctx.Err() != nil {
+		return nil // interrupted by shutdown, not a real failure
+	}
+	nextTime.FailCnt++
+	nextTime.ValidTime = now.Add(punishAddTime(nextTime.FailCnt))
+	nextTime.LastErr = ""
+	if parseErr != nil {
+		nextTime.LastErr = parseErr.Error()
+	}
+	var err error
+	if parserName != "" {
+		level.Info(pm.logger).Log("msg", "entry parser succ", "entry", entry.Name(), "parser", parserName)
+		err = pm.review.remove(entry.MotherPath, entry.Name())
+	} else {
+		level.Warn(pm.logger).Log("msg", "entry parser fail", "entry", entry.Name(), "nextValidTime", nextTime.ValidTime, "failCnt", nextTime.FailCnt)
+		err = pm.review.add(entry.MotherPath, entry.Name(), parseErr, nextTime.FailCnt, now)
+	}
+	if err != nil {
+		level.Error(pm.logger).Log("msg", "failed to save review queue", "err", err)
+	}
+	result := &EntryResult{ScanDir: entry.MotherPath, Entry: entry.Name(), Parser: parserName, Status: EntryMatched}
+	if parserName == "" {
+		result.Status = EntryFailed
+		result.Reason = nextTime.LastErr
+		if result.Reason == "" {
+			result.Reason = "no parser matched"
 		}
-		time.Sleep(pm.sleepDurScan)
+	}
+	return result
+}
+
+func (pm *ParserMgr) saveState(scanDir string, doNextTime map[string]*failNextTime) {
+	if err := pm.state.update(scanDir, doNextTime); err != nil {
+		level.Error(pm.logger).Log("msg", "failed to save parser state", "scanDir", scanDir, "err", err)
 	}
 }
 
@@ -311,28 +664,128 @@ func punishAddTime(failCnt int32) time.Duration {
 	return time.Duration(math.Pow(2, float64(failCnt-1))) * time.Minute
 }
 
-func (pm *ParserMgr) runEntry(entry *dirinfo.Entry, opts *ParserMgrRunOpts) (okParserName string, err error) {
+// runEntry runs the parsers in priority order until one of them matches the entry,
+// parseErr is the parser error that stopped the run, it is recorded as the last error of the entry
+// a parser is never interrupted, so an in-flight rename always finishes, ctx is only checked between parsers
+func (pm *ParserMgr) runEntry(ctx context.Context, entry *dirinfo.Entry, opts *ParserMgrRunOpts) (okParserName string, parseErr error) {
 	entryRunTotal.With(prometheus.Labels{"entry_name": entry.Name()}).Inc()
 	// TODO if entry is NOT existed any more, should return "", nil
-	for _, parserInfo := range pm.parsers {
+	entryOpts := *opts
+	entryOpts.Override = pm.entryOverride(entry)
+	entryOpts.Absolute = pm.absoluteEpisodes()
+	opts = &entryOpts
+	if opts.Override != nil {
+		level.Info(pm.logger).Log("msg", "entry overridden", "entry", entry.Name(), "override", opts.Override, "tmdbid", opts.Override.Tmdbid)
+	}
+	for _, parserInfo := range pm.parsersFor(opts) {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
 		ok, err := pm.runParser(entry, parserInfo, opts)
+		pm.sleepAfterParse(ctx)
 		if err != nil {
 			level.Error(pm.logger).Log("msg", "run parser err", "parser", parserInfo.name, "err", err)
-			time.Sleep(pm.sleepDurParse)
-			return "", nil
+			return "", &ParserError{Parser: parserInfo.name, Err: err}
 		}
 		if ok {
 			okParserName = parserInfo.name
-			time.Sleep(pm.sleepDurParse)
 			break
 		}
-		time.Sleep(pm.sleepDurParse)
+	}
+	if okParserName == "" && opts.Override != nil {
+		level.Warn(pm.logger).Log("msg", "entry overridden but no parser matched its files", "entry", entry.Name())
 	}
 	return okParserName, nil
 }
 
-// runParser runs the parser, and will recover all parser logic level panic
+// entryOverride returns the manual match of entry, from overrides config or the resolved review, nil if none
+func (pm *ParserMgr) entryOverride(entry *dirinfo.Entry) *Override {
+	override := pm.matchOverride(entry.Name())
+	if override == nil {
+		override = pm.review.resolved(entry.MotherPath, entry.Name())
+	}
+	return override
+}
+
+// ParserError is the error of the parser that stopped running an entry
+type ParserError struct {
+	Parser string
+	Err    error
+}
+
+func (e *ParserError) Error() string {
+	return fmt.Sprintf("parser %s: %v", e.Parser, e.Err)
+}
+
+func (e *ParserError) Unwrap() error {
+	return e.Err
+}
+
+func (pm *ParserMgr) sleepAfterParse(ctx context.Context) {
+	if pm.sleepDurParse > 0 {
+		common.SleepContext(ctx, pm.sleepDurParse)
+	}
+}
+
+// parsersFor returns the parsers to run with opts in priority order
+func (pm *ParserMgr) parsersFor(opts *ParserMgrRunOpts) []parserInfo {
+	if len(opts.Parsers) == 0 {
+		return pm.parsers
+	}
+	var ret []parserInfo
+	for _, parserInfo := range pm.parsers {
+		for _, name := range opts.Parsers {
+			if parserInfo.name == name {
+				ret = append(ret, parserInfo)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// parserInfo returns the enabled parser named name
+func (pm *ParserMgr) parserInfo(name string) (parserInfo, bool) {
+	for _, parserInfo := range pm.parsers {
+		if parserInfo.name == name {
+			return parserInfo, true
+		}
+	}
+	return parserInfo{}, false
+}
+
+// runParser runs the parser, then validates and runs its plan, it will recover all parser logic level panic
 func (pm *ParserMgr) runParser(entry *dirinfo.Entry, parserInfo parserInfo, opts *ParserMgrRunOpts) (ok bool, err error) {
+	plan, err := pm.parseEntry(entry, parserInfo, opts)
+	if err != nil {
+		return false, err
+	}
+	if plan == nil {
+		return false, nil
+	}
+	err = disk.ValidatePlan(plan)
+	if err != nil {
+		return false, fmt.Errorf("invalid plan: %v", err)
+	}
+	if opts.DryRun {
+		fmt.Printf("[dryrun] %s matched by %s, plan:\n%s", entry.Name(), parserInfo.name, plan)
+		return true, nil
+	}
+	tag := disk.AuditTag{
+		Batch:   disk.NewBatchID(time.Now()),
+		ScanDir: entry.MotherPath,
+		Entry:   entry.Name(),
+		Parser:  parserInfo.name,
+	}
+	err = pm.runPlan(plan, tag)
+	if err != nil {
+		return false, fmt.Errorf("run plan: %v", err)
+	}
+	return true, nil
+}
+
+// parseEntry runs Parse of the parser, and will recover all parser logic level panic
+func (pm *ParserMgr) parseEntry(entry *dirinfo.Entry, parserInfo parserInfo, opts *ParserMgrRunOpts) (plan *disk.Plan, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Printf("panic: %v\n", r)
@@ -342,3 +795,89 @@ func (pm *ParserMgr) runParser(entry *dirinfo.Entry, parserInfo parserInfo, opts
 	}()
 	return parserInfo.parser.Parse(entry, opts)
 }
+
+// runPlan runs plan through DiskService as a whole, it is journaled by DiskService,
+// so a failed plan is rolled back and a plan interrupted by a crash is recovered on the next start
+func (pm *ParserMgr) runPlan(plan *disk.Plan, tag disk.AuditTag) error {
+	diskService := GetDefaultDiskService()
+	journalID, err := diskService.BeginPlan(plan, tag)
+	if err != nil {
+		return fmt.Errorf("begin plan: %v", err)
+	}
+	err = pm.runOps(diskService, plan, tag)
+	reverted, endErr := diskService.EndPlan(journalID, err == nil)
+	pm.appendAudit(reverted)
+	if endErr != nil {
+		level.Error(pm.logger).Log("msg", "failed to end plan", "batch", tag.Batch, "entry", tag.Entry, "err", endErr)
+	}
+	return err
+}
+
+// runOps runs the ops of plan in order, and stops at the first failed op
+// every op done is recorded in the audit log with tag, skipped and failed ops are not
+func (pm *ParserMgr) runOps(diskService DiskService, plan *disk.Plan, tag disk.AuditTag) error {
+	for seq, op := range plan.Ops {
+		var err error
+		switch op.Type {
+		case disk.OpRenameTvEpisode:
+			err = diskService.RenameTvEpisode(op.TvEpisode)
+		case disk.OpRenameTvSubtitle:
+			err = diskService.RenameTvSubtitle(op.TvSubtitle)
+		case disk.OpRenameMovie:
+			err = diskService.RenameMovie(op.Movie)
+		case disk.OpRenameMovieSubtitle:
+			err = diskService.RenameMovieSubtitle(op.MovieSubtitle)
+		case disk.OpMoveToTrash:
+			err = diskService.MoveToTrash(op.Trash)
+		default:
+			err = fmt.Errorf("unknown op type %d", op.Type)
+		}
+		if err == nil {
+			pm.recordAudit(tag, seq, op)
+			continue
+		}
+		if op.SkipExisting && os.IsExist(err) {
+			level.Warn(pm.logger).Log("msg", "target already existed, skip", "op", op, "err", err)
+			continue
+		}
+		if op.Optional {
+			level.Warn(pm.logger).Log("msg", "optional op failed", "op", op, "err", err)
+			continue
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// recordAudit records a done op in the audit log, a failure is only logged, the op is already done
+func (pm *ParserMgr) recordAudit(tag disk.AuditTag, seq int, op *disk.Op) {
+	if pm.audit == nil {
+		return
+	}
+	err := pm.audit.Record(tag, seq, op, time.Now())
+	if err != nil {
+		level.Error(pm.logger).Log("msg", "failed to record audit log", "op", op, "batch", tag.Batch, "err", err)
+	}
+}
+
+// appendAudit appends records of ops run or reverted by DiskService itself
+func (pm *ParserMgr) appendAudit(records []*disk.AuditRecord) {
+	if pm.audit == nil {
+		return
+	}
+	for _, rec := range records {
+		err := pm.audit.Append(rec)
+		if err != nil {
+			level.Error(pm.logger).Log("msg", "failed to record audit log", "batch", rec.Batch, "path", rec.NewPath, "err", err)
+		}
+	}
+}
+
+// recoverJournals recovers plans left unfinished by a crash, before any scan dir runs
+func (pm *ParserMgr) recoverJournals(policy disk.RecoveryPolicy) {
+	records, err := GetDefaultDiskService().RecoverJournals(policy)
+	pm.appendAudit(records)
+	if err != nil {
+		level.Error(pm.logger).Log("msg", "failed to recover some unfinished plans", "policy", policy, "err", err)
+	}
+}
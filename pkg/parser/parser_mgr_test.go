@@ -1,11 +1,20 @@
 package parser
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-kit/log"
 
+	"asmediamgr/pkg/common"
 	"asmediamgr/pkg/dirinfo"
+	"asmediamgr/pkg/disk"
 )
 
 type MockParser struct{}
@@ -18,8 +27,8 @@ func (p *MockParser) Init(cfgPath string, logger log.Logger) (priority float32,
 	return 0, nil
 }
 
-func (p *MockParser) Parse(entry *dirinfo.Entry, opts *ParserMgrRunOpts) (ok bool, err error) {
-	return true, nil
+func (p *MockParser) Parse(entry *dirinfo.Entry, opts *ParserMgrRunOpts) (plan *disk.Plan, err error) {
+	return &disk.Plan{}, nil
 }
 
 func TestNewParserMgr(t *testing.T) {
@@ -47,6 +56,23 @@ func TestNewParserMgr(t *testing.T) {
 	}
 }
 
+func TestByPriority(t *testing.T) {
+	parsers := []parserInfo{
+		{name: "tvdir", priority: 0},
+		{name: "scene", priority: -1},
+		{name: "moviedir", priority: 0},
+		{name: "fansub", priority: -2},
+		{name: "other", priority: -1},
+	}
+	sort.Sort(byPriority(parsers))
+	want := []string{"fansub", "other", "scene", "moviedir", "tvdir"}
+	for i, p := range parsers {
+		if p.name != want[i] {
+			t.Fatalf("sort.Sort(byPriority) got[%d] = %s, want = %s", i, p.name, want[i])
+		}
+	}
+}
+
 func TestPusnishAddTime(t *testing.T) {
 	if punishAddTime(0).Minutes() != 0 {
 		t.Errorf("punishAddTime(0) = %v", punishAddTime(0))
@@ -64,3 +90,183 @@ func TestPusnishAddTime(t *testing.T) {
 		t.Errorf("punishAddTime(200) = %v", punishAddTime(200))
 	}
 }
+
+func TestForScanDir(t *testing.T) {
+	opts := &ParserMgrRunOpts{
+		ScanDirs: []string{"general", "anime"},
+		ScanDirOpts: map[string]*ScanDirOpts{
+			"anime": {
+				MediaTypeDirs: map[common.MediaType]string{common.MediaTypeTv: "animelib"},
+				Parsers:       []string{"tvepfile"},
+				SleepDurScan:  time.Minute,
+			},
+		},
+		MediaTypeDirs: map[common.MediaType]string{
+			common.MediaTypeMovie: "movies",
+			common.MediaTypeTv:    "tv",
+		},
+	}
+	general := opts.forScanDir("general")
+	if general.MediaTypeDirs[common.MediaTypeTv] != "tv" || len(general.Parsers) != 0 || general.SleepDurScan != defaultScanSleepDur {
+		t.Fatalf("forScanDir() general got = %+v", general)
+	}
+	anime := opts.forScanDir("anime")
+	if anime.MediaTypeDirs[common.MediaTypeTv] != "animelib" || anime.MediaTypeDirs[common.MediaTypeMovie] != "movies" {
+		t.Fatalf("forScanDir() anime MediaTypeDirs got = %v", anime.MediaTypeDirs)
+	}
+	if len(anime.Parsers) != 1 || anime.Parsers[0] != "tvepfile" || anime.SleepDurScan != time.Minute {
+		t.Fatalf("forScanDir() anime got = %+v", anime)
+	}
+	if opts.MediaTypeDirs[common.MediaTypeTv] != "tv" {
+		t.Fatalf("forScanDir() should not modify the original options")
+	}
+}
+
+type countParser struct {
+	mu      sync.Mutex
+	running int
+	maxRun  int
+	entries map[string]int
+}
+
+func (p *countParser) IsDefaultEnable() bool {
+	return true
+}
+
+func (p *countParser) Init(cfgPath string, logger log.Logger) (priority float32, err error) {
+	return 0, nil
+}
+
+func (p *countParser) Parse(entry *dirinfo.Entry, opts *ParserMgrRunOpts) (plan *disk.Plan, err error) {
+	p.mu.Lock()
+	p.running++
+	if p.running > p.maxRun {
+		p.maxRun = p.running
+	}
+	p.entries[entry.Name()]++
+	p.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	p.mu.Lock()
+	p.running--
+	p.mu.Unlock()
+	return nil, nil
+}
+
+func TestRunEntries(t *testing.T) {
+	p := &countParser{entries: make(map[string]int)}
+	review, err := newReviewQueue("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &ParserMgr{
+		logger:  log.NewNopLogger(),
+		parsers: []parserInfo{{name: "count", parser: p}},
+		review:  review,
+	}
+	var entries []*dirinfo.Entry
+	for i := 0; i < 10; i++ {
+		entries = append(entries, &dirinfo.Entry{Type: dirinfo.DirEntry, MyDirPath: fmt.Sprintf("entry%d", i)})
+	}
+	doNextTime := make(map[string]*failNextTime)
+	now := time.Now()
+	pm.runEntries(context.Background(), entries, doNextTime, newSettleTracker(SettleOpts{}), now, &ParserMgrRunOpts{Workers: 3})
+	if p.maxRun > 3 {
+		t.Fatalf("runEntries() got = %d parallel runs, want <= 3", p.maxRun)
+	}
+	for _, entry := range entries {
+		if p.entries[entry.Name()] != 1 {
+			t.Fatalf("runEntries() entry %s run %d times, want = 1", entry.Name(), p.entries[entry.Name()])
+		}
+		if doNextTime[entry.Name()].FailCnt != 1 {
+			t.Fatalf("runEntries() entry %s fail count = %d, want = 1", entry.Name(), doNextTime[entry.Name()].FailCnt)
+		}
+	}
+	if items := pm.ReviewItems(); len(items) != len(entries) {
+		t.Fatalf("runEntries() review items got = %d, want = %d", len(items), len(entries))
+	}
+}
+
+// pauseParser pauses its scan dir while running the first entry
+type pauseParser struct {
+	pm *ParserMgr
+}
+
+func (p *pauseParser) IsDefaultEnable() bool {
+	return true
+}
+
+func (p *pauseParser) Init(cfgPath string, logger log.Logger) (priority float32, err error) {
+	return 0, nil
+}
+
+func (p *pauseParser) Parse(entry *dirinfo.Entry, opts *ParserMgrRunOpts) (plan *disk.Plan, err error) {
+	return nil, p.pm.PauseScanDir(entry.MotherPath)
+}
+
+func TestRunEntriesPaused(t *testing.T) {
+	review, err := newReviewQueue("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &ParserMgr{
+		logger: log.NewNopLogger(),
+		review: review,
+		cmds:   map[string]chan dirCmd{"downloads": make(chan dirCmd, 1)},
+		paused: make(map[string]bool),
+	}
+	pm.parsers = []parserInfo{{name: "pause", parser: &pauseParser{pm: pm}}}
+	var entries []*dirinfo.Entry
+	for i := 0; i < 3; i++ {
+		entries = append(entries, &dirinfo.Entry{Type: dirinfo.DirEntry, MotherPath: "downloads", MyDirPath: fmt.Sprintf("entry%d", i)})
+	}
+	results := pm.runEntries(context.Background(), entries, make(map[string]*failNextTime), newSettleTracker(SettleOpts{}), time.Now(), &ParserMgrRunOpts{Workers: 1})
+	summary := &RunSummary{Results: results}
+	if summary.Count(EntryFailed) != 1 || summary.Count(EntrySkipped) != 2 {
+		t.Fatalf("runEntries() paused partway got = %s", summary)
+	}
+	for _, result := range results {
+		if result.Status == EntrySkipped && result.Reason != "paused" {
+			t.Errorf("runEntries() skipped %s reason = %s, want = paused", result.Entry, result.Reason)
+		}
+	}
+}
+
+func TestChangedEntryRecheck(t *testing.T) {
+	scanDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(scanDir, "Show.S01E01.mkv"), []byte("episode"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := &countParser{entries: make(map[string]int)}
+	review, err := newReviewQueue("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := newStateStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &ParserMgr{
+		logger:  log.NewNopLogger(),
+		parsers: []parserInfo{{name: "count", parser: p}},
+		review:  review,
+		state:   state,
+	}
+	changes := make(chan string, 1)
+	events := &dirEvents{
+		changes:  changes,
+		rechecks: make(chan string, dirCmdBuffer),
+		pending:  make(map[string]*time.Timer),
+	}
+	defer events.stopRechecks()
+	opts := &ParserMgrRunOpts{
+		SleepDurScan:  2 * time.Second, // the recheck is after minRecheck
+		WatchDebounce: 10 * time.Millisecond,
+		// settle defaults of the config, the entry was just written so the watcher event alone is not settled
+		Settle: SettleOpts{Dur: time.Minute, TwoScans: true, PartialExts: DefaultPartialExts},
+	}
+	changes <- "Show.S01E01.mkv"
+	pm.waitNextScan(context.Background(), scanDir, events, make(map[string]*failNextTime), newSettleTracker(opts.Settle), opts)
+	if got := p.entries["Show.S01E01.mkv"]; got != 1 {
+		t.Fatalf("waitNextScan() changed entry run %d times before the next full scan, want = 1", got)
+	}
+}
@@ -0,0 +1,338 @@
+// Package plugin runs external parsers as subprocesses, so niche naming conventions can be scripted in any language.
+// A plugin reads a Request JSON line from stdin and writes a Response JSON line to stdout,
+// tmdb lookups and renames of the matched files are then done as for the built-in parsers.
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"asmediamgr/pkg/common"
+	"asmediamgr/pkg/dirinfo"
+	"asmediamgr/pkg/disk"
+	"asmediamgr/pkg/identify"
+	"asmediamgr/pkg/parser"
+	"asmediamgr/pkg/utils"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+)
+
+// Config is the config of a plugin, loaded from its parser config file
+type Config struct {
+	Command    string        `toml:"command"`    // executable, searched in PATH if it has no separator
+	Args       []string      `toml:"args"`       // arguments of the command
+	Dir        string        `toml:"dir"`        // working dir of the command, empty means the current dir
+	Timeout    time.Duration `toml:"timeout"`    // max duration of a request, the plugin is killed after it, 0 means 30s
+	Persistent bool          `toml:"persistent"` // keep the plugin running and send it one request per line
+	Priority   float32       `toml:"priority"`   // parsers of lower priority run first, not changed by reload
+}
+
+func loadConfig(cfgPath string) (*Config, error) {
+	cfg := &Config{}
+	_, err := toml.DecodeFile(cfgPath, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("DecodeFile() error = %v", err)
+	}
+	if cfg.Command == "" {
+		return nil, fmt.Errorf("no command in %s", cfgPath)
+	}
+	if cfg.Timeout < 0 {
+		return nil, fmt.Errorf("invalid timeout = %v", cfg.Timeout)
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	return cfg, nil
+}
+
+// Register registers a plugin parser of each name, configured by <name>.toml in the parser config dir
+// Note: this function is not thread safe, it must be called before parser.NewParserMgr
+func Register(names []string) error {
+	for _, name := range names {
+		if _, ok := parser.RegisteredParsers[name]; ok {
+			return fmt.Errorf("parser %s already registered", name)
+		}
+		parser.RegisterParser(name, &Plugin{name: name})
+	}
+	return nil
+}
+
+// Plugin is a parser that asks a subprocess to match entries
+type Plugin struct {
+	name   string
+	logger log.Logger
+	mu     sync.RWMutex // guards cfg and runner, swapped on reload
+	cfg    *Config
+	runner runner
+}
+
+// IsDefaultEnable returns true, a plugin is registered only if it is configured
+func (p *Plugin) IsDefaultEnable() bool {
+	return true
+}
+
+func (p *Plugin) Init(cfgPath string, logger log.Logger) (priority float32, err error) {
+	p.logger = logger
+	cfg, err := loadConfig(cfgPath)
+	if err != nil {
+		return 0, err
+	}
+	p.cfg = cfg
+	p.runner = newRunner(cfg, logger)
+	return cfg.Priority, nil
+}
+
+// Reload loads cfgPath, a persistent plugin is restarted at the next request
+func (p *Plugin) Reload(cfgPath string) error {
+	cfg, err := loadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	old := p.runner
+	p.cfg = cfg
+	p.runner = newRunner(cfg, p.logger)
+	p.mu.Unlock()
+	return old.close()
+}
+
+// Close stops the plugin if it is persistent
+func (p *Plugin) Close() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.runner == nil {
+		return nil
+	}
+	return p.runner.close()
+}
+
+func (p *Plugin) get() (*Config, runner) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cfg, p.runner
+}
+
+func (p *Plugin) Parse(entry *dirinfo.Entry, opts *parser.ParserMgrRunOpts) (plan *disk.Plan, err error) {
+	resp, err := p.call(entry, opts)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("plugin error = %s", resp.Error)
+	}
+	if !resp.Match {
+		opts.Trace.Logf("plugin: no match")
+		return nil, nil
+	}
+	mediaType, err := parser.ParseMediaType(resp.MediaType)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Override.Skip(mediaType) {
+		opts.Trace.Logf("skipped, override is not %s", resp.MediaType)
+		return nil, nil
+	}
+	files, err := matchedFiles(entry, mediaType, resp)
+	if err != nil {
+		return nil, err
+	}
+	opts.Trace.Logf("plugin matched media_type = %s, name = %q, year = %d, tmdbid = %d, %d files", resp.MediaType, resp.Name, resp.Year, resp.Tmdbid, len(resp.Files))
+	info, err := p.identify(mediaType, resp, opts.Override, opts.Trace)
+	if err != nil {
+		return nil, err
+	}
+	level.Info(p.logger).Log("msg", "matched", "entry", entry.Name(), "mediaType", resp.MediaType, "originalName", info.originalName,
+		"year", info.year, "tmdbid", info.tmdbid, "files", len(resp.Files))
+	return newPlan(entry, mediaType, resp, files, info, opts)
+}
+
+// call sends entry to the plugin and reads its response
+func (p *Plugin) call(entry *dirinfo.Entry, opts *parser.ParserMgrRunOpts) (*Response, error) {
+	cfg, runner := p.get()
+	line, err := json.Marshal(newRequest(entry, opts.Override))
+	if err != nil {
+		return nil, fmt.Errorf("Marshal() error = %v", err)
+	}
+	opts.Trace.Logf("plugin: %s, %d files sent", cfg.Command, len(entry.FileList))
+	out, err := runner.run(line)
+	if err != nil {
+		return nil, fmt.Errorf("run plugin %s error = %w", p.name, err)
+	}
+	opts.Trace.Logf("plugin: responded %s", out)
+	resp := &Response{}
+	err = json.Unmarshal(out, resp)
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshal() response of plugin %s error = %v", p.name, err)
+	}
+	return resp, nil
+}
+
+type mediaInfo struct {
+	originalName string
+	year         int
+	tmdbid       int
+}
+
+// identify returns the tmdb info of the response, the tmdbid of the override wins, the response name is searched without tmdbid
+func (p *Plugin) identify(mediaType common.MediaType, resp *Response, override *parser.Override, trace *parser.Trace) (*mediaInfo, error) {
+	tmdbService := trace.TmdbService(parser.GetDefaultTmdbService())
+	info := &mediaInfo{tmdbid: resp.Tmdbid}
+	if override != nil {
+		info.tmdbid = override.Tmdbid
+	}
+	var err error
+	var releaseDate string
+	switch mediaType {
+	case common.MediaTypeTv:
+		if info.tmdbid <= 0 {
+			info.tmdbid, err = identify.SearchTv(tmdbService, resp.Name, resp.Year, p.logger)
+			if err != nil {
+				return nil, fmt.Errorf("search tv of plugin response, error = %w", err)
+			}
+		}
+		detail, err := tmdbService.GetTVDetails(info.tmdbid, common.DefaultTmdbSearchOpts)
+		if err != nil {
+			return nil, fmt.Errorf("get tv detail of tmdbid = %d, error = %v", info.tmdbid, err)
+		}
+		info.originalName, releaseDate = detail.OriginalName, detail.FirstAirDate
+	default:
+		if info.tmdbid <= 0 {
+			info.tmdbid, err = identify.SearchMovie(tmdbService, resp.Name, resp.Year, p.logger)
+			if err != nil {
+				return nil, fmt.Errorf("search movie of plugin response, error = %w", err)
+			}
+		}
+		detail, err := tmdbService.GetMovieDetails(info.tmdbid, common.DefaultTmdbSearchOpts)
+		if err != nil {
+			return nil, fmt.Errorf("get movie detail of tmdbid = %d, error = %v", info.tmdbid, err)
+		}
+		info.originalName, releaseDate = detail.OriginalTitle, detail.ReleaseDate
+	}
+	dt, err := common.ParseTmdbDateStr(releaseDate)
+	if err != nil {
+		return nil, fmt.Errorf("tmdbid = %d, invalid release date = %s", info.tmdbid, releaseDate)
+	}
+	info.year = dt.Year
+	return info, nil
+}
+
+// matchedFiles returns the files of the entry in the response, in the same order,
+// every file must be in the entry and be media or subtitle, a movie has at most one media file
+func matchedFiles(entry *dirinfo.Entry, mediaType common.MediaType, resp *Response) ([]*dirinfo.File, error) {
+	if len(resp.Files) == 0 {
+		return nil, fmt.Errorf("plugin matched no files")
+	}
+	entryFiles := make(map[string]*dirinfo.File, len(entry.FileList))
+	for _, file := range entry.FileList {
+		entryFiles[relPath(file)] = file
+	}
+	files := make([]*dirinfo.File, 0, len(resp.Files))
+	mediaFiles := 0
+	for _, result := range resp.Files {
+		file, ok := entryFiles[result.RelPath]
+		if !ok {
+			return nil, fmt.Errorf("plugin file %s is not in the entry", result.RelPath)
+		}
+		if utils.IsMediaExt(file.Ext) {
+			mediaFiles++
+		} else if !utils.IsSubtitleExt(file.Ext) {
+			return nil, fmt.Errorf("plugin file %s is neither media nor subtitle", result.RelPath)
+		}
+		files = append(files, file)
+	}
+	if mediaType == common.MediaTypeMovie && mediaFiles > 1 {
+		return nil, fmt.Errorf("plugin matched %d movie files", mediaFiles)
+	}
+	return files, nil
+}
+
+// newPlan returns the plan of files matched by the response
+func newPlan(entry *dirinfo.Entry, mediaType common.MediaType, resp *Response, files []*dirinfo.File, info *mediaInfo, opts *parser.ParserMgrRunOpts) (*disk.Plan, error) {
+	targetDir, ok := opts.MediaTypeDirs[mediaType]
+	if !ok {
+		return nil, fmt.Errorf("no %s target dir", resp.MediaType)
+	}
+	plan := &disk.Plan{}
+	for i, result := range resp.Files {
+		oldPath := filepath.Join(entry.MotherPath, files[i].RelPathToMother)
+		isSubtitle := utils.IsSubtitleExt(files[i].Ext)
+		switch mediaType {
+		case common.MediaTypeTv:
+			season, episode := opts.Override.ApplyTv(result.Season, result.Episode)
+			if season < 0 || episode < 0 {
+				return nil, fmt.Errorf("plugin file %s, invalid season = %d, episode = %d", result.RelPath, season, episode)
+			}
+			episodeEnd := 0
+			if result.EpisodeEnd > result.Episode {
+				episodeEnd = result.EpisodeEnd + episode - result.Episode
+			}
+			if isSubtitle {
+				plan.AddTvSubtitle(&disk.TvSubtitleRenameTask{
+					OldPath:      oldPath,
+					NewMotherDir: targetDir,
+					OriginalName: info.originalName,
+					Year:         info.year,
+					Tmdbid:       info.tmdbid,
+					Season:       season,
+					Episode:      episode,
+					EpisodeEnd:   episodeEnd,
+					Language:     result.Language,
+				})
+				continue
+			}
+			plan.AddTvEpisode(&disk.TvEpisodeRenameTask{
+				OldPath:      oldPath,
+				NewMotherDir: targetDir,
+				OriginalName: info.originalName,
+				Year:         info.year,
+				Tmdbid:       info.tmdbid,
+				Season:       season,
+				Episode:      episode,
+				EpisodeEnd:   episodeEnd,
+			})
+		default:
+			if isSubtitle {
+				plan.AddMovieSubtitle(&disk.MovieSubtitleRenameTask{
+					OldPath:      oldPath,
+					NewMotherDir: targetDir,
+					OriginalName: info.originalName,
+					Year:         info.year,
+					Tmdbid:       info.tmdbid,
+					Language:     result.Language,
+				})
+				continue
+			}
+			plan.AddMovie(&disk.MovieRenameTask{
+				OldPath:      oldPath,
+				NewMotherDir: targetDir,
+				OriginalName: info.originalName,
+				Year:         info.year,
+				Tmdbid:       info.tmdbid,
+			})
+		}
+	}
+	if resp.Trash && entry.Type == dirinfo.DirEntry {
+		trashDir, ok := opts.MediaTypeDirs[common.MediaTypeTrash]
+		if !ok {
+			return nil, fmt.Errorf("no trash dir")
+		}
+		plan.AddMoveToTrash(&disk.MoveToTrashTask{
+			Path:     filepath.Join(entry.MotherPath, entry.Name()),
+			TrashDir: trashDir,
+		}).Optional = true
+	}
+	return plan, nil
+}
+
+func relPath(file *dirinfo.File) string {
+	return filepath.ToSlash(file.RelPathToMother)
+}
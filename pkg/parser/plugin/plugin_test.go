@@ -0,0 +1,230 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tmdb "github.com/cyruzin/golang-tmdb"
+	"github.com/go-kit/log"
+
+	"asmediamgr/pkg/common"
+	"asmediamgr/pkg/dirinfo"
+	"asmediamgr/pkg/disk"
+	"asmediamgr/pkg/parser"
+	"asmediamgr/pkg/parser/fakes"
+)
+
+const helperEnv = "ASMEDIAMGR_PLUGIN_HELPER"
+
+// TestHelperPlugin is not a test, it is the plugin run by the tests, its mode is the last argument
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv(helperEnv) != "1" {
+		return
+	}
+	mode := os.Args[len(os.Args)-1]
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		req := &Request{}
+		if err := json.Unmarshal(scanner.Bytes(), req); err != nil {
+			fmt.Fprintf(os.Stderr, "bad request: %v\n", err)
+			os.Exit(1)
+		}
+		resp := &Response{}
+		switch mode {
+		case "tv":
+			resp = &Response{Match: true, MediaType: "tv", Tmdbid: 100, Trash: true}
+			for i, file := range req.Entry.Files {
+				if file.Ext == ".txt" {
+					continue
+				}
+				resp.Files = append(resp.Files, &FileResult{RelPath: file.RelPath, Season: 1, Episode: i/2 + 1, Language: "chs"})
+			}
+		case "unknownfile":
+			resp = &Response{Match: true, MediaType: "movie", Tmdbid: 200, Files: []*FileResult{{RelPath: "../etc/passwd"}}}
+		case "pid":
+			resp.Name = fmt.Sprint(os.Getpid())
+		case "hang":
+			time.Sleep(time.Minute)
+		case "fail":
+			fmt.Fprintf(os.Stderr, "plugin broken\n")
+			os.Exit(3)
+		}
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+	}
+	os.Exit(0)
+}
+
+func helperConfig(t *testing.T, mode string, persistent bool) *Config {
+	t.Setenv(helperEnv, "1")
+	return &Config{
+		Command:    os.Args[0],
+		Args:       []string{"-test.run=^TestHelperPlugin$", "--", mode},
+		Timeout:    5 * time.Second,
+		Persistent: persistent,
+	}
+}
+
+func newHelperPlugin(t *testing.T, mode string) *Plugin {
+	cfg := helperConfig(t, mode, false)
+	return &Plugin{name: "helper", logger: log.NewNopLogger(), cfg: cfg, runner: newRunner(cfg, log.NewNopLogger())}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "anime.toml")
+	content := "command = \"python3\"\nargs = [\"anime.py\"]\ntimeout = \"5s\"\npersistent = true\npriority = -1.5\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := &Plugin{name: "anime"}
+	priority, err := p.Init(cfgPath, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	if priority != -1.5 || p.cfg.Timeout != 5*time.Second || !p.cfg.Persistent || len(p.cfg.Args) != 1 {
+		t.Errorf("Init() got priority = %v, cfg = %+v", priority, p.cfg)
+	}
+	if _, ok := p.runner.(*persistentRunner); !ok {
+		t.Errorf("Init() persistent plugin got runner = %T", p.runner)
+	}
+
+	if err := os.WriteFile(cfgPath, []byte("args = [\"anime.py\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Reload(cfgPath); err == nil {
+		t.Errorf("Reload() without command should fail")
+	}
+	if p.cfg.Command != "python3" {
+		t.Errorf("Reload() should keep the previous config, got = %+v", p.cfg)
+	}
+	if _, err := (&Plugin{}).Init(filepath.Join(dir, "missing.toml"), log.NewNopLogger()); err == nil {
+		t.Errorf("Init() without config should fail")
+	}
+}
+
+func TestParse(t *testing.T) {
+	parser.RegisterTmdbService(fakes.NewFakeTmdbService(fakes.WithTvIdMapping(100, &tmdb.TVDetails{
+		ID:           100,
+		OriginalName: "Show",
+		FirstAirDate: "2020-04-01",
+	})))
+	entry := &dirinfo.Entry{
+		Type:       dirinfo.DirEntry,
+		MyDirPath:  "Show",
+		MotherPath: "scan",
+		FileList: []*dirinfo.File{
+			{RelPathToMother: filepath.Join("Show", "01.mkv"), Name: "01.mkv", Ext: ".mkv"},
+			{RelPathToMother: filepath.Join("Show", "01.ass"), Name: "01.ass", Ext: ".ass"},
+			{RelPathToMother: filepath.Join("Show", "readme.txt"), Name: "readme.txt", Ext: ".txt"},
+		},
+	}
+	opts := &parser.ParserMgrRunOpts{
+		MediaTypeDirs: map[common.MediaType]string{
+			common.MediaTypeMovie: "movies",
+			common.MediaTypeTv:    "tv",
+			common.MediaTypeTrash: "trash",
+		},
+	}
+
+	plan, err := newHelperPlugin(t, "tv").Parse(entry, opts)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if plan == nil || len(plan.Ops) != 3 {
+		t.Fatalf("Parse() got plan = %v", plan)
+	}
+	episode := plan.Ops[0].TvEpisode
+	if plan.Ops[0].Type != disk.OpRenameTvEpisode || episode.OriginalName != "Show" || episode.Year != 2020 || episode.Season != 1 || episode.Episode != 1 {
+		t.Errorf("Parse() episode got = %+v", plan.Ops[0])
+	}
+	if episode.OldPath != filepath.Join("scan", "Show", "01.mkv") || episode.NewMotherDir != "tv" {
+		t.Errorf("Parse() episode paths got = %+v", episode)
+	}
+	if plan.Ops[1].Type != disk.OpRenameTvSubtitle || plan.Ops[1].TvSubtitle.Language != "chs" || plan.Ops[1].TvSubtitle.Episode != 1 {
+		t.Errorf("Parse() subtitle got = %+v", plan.Ops[1])
+	}
+	if plan.Ops[2].Type != disk.OpMoveToTrash || !plan.Ops[2].Optional {
+		t.Errorf("Parse() trash got = %+v", plan.Ops[2])
+	}
+
+	seasonTwo, offset := 2, 12
+	opts.Override = &parser.Override{MediaType: common.MediaTypeTv, Tmdbid: 100, Season: &seasonTwo, EpisodeOffset: &offset}
+	plan, err = newHelperPlugin(t, "tv").Parse(entry, opts)
+	if err != nil {
+		t.Fatalf("Parse() with override error = %v", err)
+	}
+	if got := plan.Ops[0].TvEpisode; got.Season != 2 || got.Episode != 13 {
+		t.Errorf("Parse() with override got = %+v", got)
+	}
+	opts.Override = &parser.Override{MediaType: common.MediaTypeMovie, Tmdbid: 1}
+	plan, err = newHelperPlugin(t, "tv").Parse(entry, opts)
+	if err != nil || plan != nil {
+		t.Errorf("Parse() with movie override got plan = %v, error = %v", plan, err)
+	}
+	opts.Override = nil
+
+	plan, err = newHelperPlugin(t, "pid").Parse(entry, opts)
+	if err != nil || plan != nil {
+		t.Errorf("Parse() no match got plan = %v, error = %v", plan, err)
+	}
+	_, err = newHelperPlugin(t, "unknownfile").Parse(entry, opts)
+	if err == nil || !strings.Contains(err.Error(), "not in the entry") {
+		t.Errorf("Parse() file out of the entry error = %v", err)
+	}
+	_, err = newHelperPlugin(t, "fail").Parse(entry, opts)
+	if err == nil || !strings.Contains(err.Error(), "plugin broken") {
+		t.Errorf("Parse() failed plugin error = %v, want stderr", err)
+	}
+}
+
+func TestPersistentRunner(t *testing.T) {
+	cfg := helperConfig(t, "pid", true)
+	r := newRunner(cfg, log.NewNopLogger())
+	defer r.close()
+	pid := func() string {
+		out, err := r.run([]byte(`{"entry":{"type":"file"}}`))
+		if err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+		resp := &Response{}
+		if err := json.Unmarshal(out, resp); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		return resp.Name
+	}
+	first := pid()
+	if second := pid(); first == "" || second != first {
+		t.Errorf("run() should reuse the plugin, got pids %s and %s", first, second)
+	}
+	r.close()
+	if third := pid(); third == first {
+		t.Errorf("run() should start the plugin again after close, got pid %s", third)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	for _, persistent := range []bool{false, true} {
+		cfg := helperConfig(t, "hang", persistent)
+		cfg.Timeout = 200 * time.Millisecond
+		r := newRunner(cfg, log.NewNopLogger())
+		start := time.Now()
+		_, err := r.run([]byte(`{"entry":{"type":"file"}}`))
+		if err == nil || !strings.Contains(err.Error(), "timeout") {
+			t.Errorf("run() persistent = %v error = %v, want timeout", persistent, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("run() persistent = %v took %v", persistent, elapsed)
+		}
+		if persistent && r.(*persistentRunner).proc != nil {
+			t.Errorf("run() should drop the plugin after timeout")
+		}
+		r.close()
+	}
+}
@@ -0,0 +1,223 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+const (
+	maxStderrInError = 1024        // bytes of stderr kept in the error of a failed request
+	stopGrace        = time.Second // a persistent plugin is killed if it does not exit in time after its stdin is closed
+)
+
+// runner sends a request line to a plugin and returns its response line
+type runner interface {
+	run(req []byte) (resp []byte, err error)
+	close() error
+}
+
+func newRunner(cfg *Config, logger log.Logger) runner {
+	if cfg.Persistent {
+		return &persistentRunner{cfg: cfg, logger: logger}
+	}
+	return &oneShotRunner{cfg: cfg}
+}
+
+func command(ctx context.Context, cfg *Config) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, cfg.Command, cfg.Args...)
+	cmd.Dir = cfg.Dir
+	cmd.WaitDelay = time.Second // children of the plugin may keep its output open
+	return cmd
+}
+
+// oneShotRunner starts the plugin for every request, the request is its whole stdin
+type oneShotRunner struct {
+	cfg *Config
+}
+
+func (r *oneShotRunner) run(req []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+	cmd := command(ctx, r.cfg)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(append(req, '\n'))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("timeout after %v", r.cfg.Timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Run() error = %v, stderr = %s", err, tail(stderr.String()))
+	}
+	resp := bytes.TrimSpace(stdout.Bytes())
+	if len(resp) == 0 {
+		return nil, fmt.Errorf("empty response, stderr = %s", tail(stderr.String()))
+	}
+	return resp, nil
+}
+
+func (r *oneShotRunner) close() error {
+	return nil
+}
+
+// persistentRunner keeps the plugin running, requests are serialized, one line each way,
+// the plugin is killed on timeout or any error and started again by the next request,
+// it must exit at the end of its stdin
+type persistentRunner struct {
+	cfg    *Config
+	logger log.Logger
+	mu     sync.Mutex // guards proc, held during a request
+	proc   *process
+}
+
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	exited chan struct{} // closed after the plugin exited
+}
+
+func (r *persistentRunner) run(req []byte) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.proc == nil {
+		proc, err := r.start()
+		if err != nil {
+			return nil, err
+		}
+		r.proc = proc
+	}
+	resp, err := r.roundTrip(r.proc, req)
+	if err != nil {
+		r.stop(0)
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (r *persistentRunner) roundTrip(proc *process, req []byte) ([]byte, error) {
+	type result struct {
+		line []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		_, err := proc.stdin.Write(append(req, '\n'))
+		if err != nil {
+			done <- result{err: fmt.Errorf("Write() error = %v", err)}
+			return
+		}
+		line, err := proc.stdout.ReadBytes('\n')
+		if err != nil {
+			done <- result{err: fmt.Errorf("ReadBytes() error = %v", err)}
+			return
+		}
+		done <- result{line: bytes.TrimSpace(line)}
+	}()
+	timer := time.NewTimer(r.cfg.Timeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return res.line, res.err
+	case <-timer.C:
+		return nil, fmt.Errorf("timeout after %v", r.cfg.Timeout)
+	}
+}
+
+func (r *persistentRunner) start() (*process, error) {
+	cmd := command(context.Background(), r.cfg)
+	cmd.Stderr = &stderrLogger{logger: r.logger}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("StdinPipe() error = %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("StdoutPipe() error = %v", err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("Start() error = %v", err)
+	}
+	level.Info(r.logger).Log("msg", "plugin started", "command", r.cfg.Command, "pid", cmd.Process.Pid)
+	proc := &process{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+		exited: make(chan struct{}),
+	}
+	go func() {
+		err := cmd.Wait()
+		level.Info(r.logger).Log("msg", "plugin exited", "pid", cmd.Process.Pid, "err", err)
+		close(proc.exited)
+	}()
+	return proc, nil
+}
+
+// stop closes stdin of the plugin, and kills it if it does not exit within grace, r.mu must be held
+func (r *persistentRunner) stop(grace time.Duration) {
+	if r.proc == nil {
+		return
+	}
+	proc := r.proc
+	r.proc = nil
+	proc.stdin.Close()
+	select {
+	case <-proc.exited:
+		return
+	case <-time.After(grace):
+	}
+	err := proc.cmd.Process.Kill()
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		level.Error(r.logger).Log("msg", "failed to kill plugin", "pid", proc.cmd.Process.Pid, "err", err)
+	}
+	<-proc.exited
+}
+
+func (r *persistentRunner) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stop(stopGrace)
+	return nil
+}
+
+// stderrLogger logs stderr of a persistent plugin line by line
+type stderrLogger struct {
+	logger log.Logger
+	buf    []byte
+}
+
+func (w *stderrLogger) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		level.Warn(w.logger).Log("msg", "plugin stderr", "line", string(bytes.TrimSpace(w.buf[:i])))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// tail returns the end of stderr of a plugin, kept short for errors
+func tail(stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if len(stderr) > maxStderrInError {
+		stderr = "..." + stderr[len(stderr)-maxStderrInError:]
+	}
+	return stderr
+}
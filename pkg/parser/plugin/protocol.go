@@ -0,0 +1,93 @@
+package plugin
+
+import (
+	"time"
+
+	"asmediamgr/pkg/dirinfo"
+	"asmediamgr/pkg/parser"
+)
+
+// Request is written as a single JSON line to stdin of the plugin for every entry
+type Request struct {
+	Entry    *Entry    `json:"entry"`
+	Override *Override `json:"override,omitempty"` // manual match of the entry, the plugin may use it or ignore it
+}
+
+// Entry is dirinfo.Entry on the wire
+type Entry struct {
+	Type       string  `json:"type"` // "file" or "dir"
+	Name       string  `json:"name"`
+	MotherPath string  `json:"mother_path"`
+	Files      []*File `json:"files"`
+}
+
+// File is dirinfo.File on the wire
+type File struct {
+	RelPath string    `json:"rel_path"` // relative to mother path, slash separated, the key of the file in a Response
+	Name    string    `json:"name"`
+	Ext     string    `json:"ext"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Override is parser.Override on the wire, the tmdbid, season and episode offset are applied to the response anyway
+type Override struct {
+	MediaType     string `json:"media_type"`
+	Tmdbid        int    `json:"tmdbid"`
+	Season        *int   `json:"season,omitempty"`
+	EpisodeOffset *int   `json:"episode_offset,omitempty"`
+}
+
+// Response is read as a single JSON line from stdout of the plugin for every request
+// a matched response has the media type, the tmdbid or the name and year to search,
+// and the files to rename, files not listed are left as is
+type Response struct {
+	Match     bool          `json:"match"`
+	Error     string        `json:"error,omitempty"` // the entry is failed, unlike no match
+	MediaType string        `json:"media_type"`      // "tv" or "movie"
+	Tmdbid    int           `json:"tmdbid"`          // searched by name and year if 0
+	Name      string        `json:"name"`
+	Year      int           `json:"year"`
+	Files     []*FileResult `json:"files"`
+	Trash     bool          `json:"trash"` // move a dir entry to trash after its files are renamed
+}
+
+// FileResult is the match of a file of the entry, media or subtitle by its ext
+type FileResult struct {
+	RelPath    string `json:"rel_path"`
+	Season     int    `json:"season"`                // tv only
+	Episode    int    `json:"episode"`               // tv only
+	EpisodeEnd int    `json:"episode_end,omitempty"` // tv only, last episode of a multi-episode file
+	Language   string `json:"language"`              // subtitle only, empty for the default subtitle
+}
+
+func newRequest(entry *dirinfo.Entry, override *parser.Override) *Request {
+	req := &Request{
+		Entry: &Entry{
+			Type:       "file",
+			Name:       entry.Name(),
+			MotherPath: entry.MotherPath,
+		},
+	}
+	if entry.Type == dirinfo.DirEntry {
+		req.Entry.Type = "dir"
+	}
+	for _, file := range entry.FileList {
+		req.Entry.Files = append(req.Entry.Files, &File{
+			RelPath: relPath(file),
+			Name:    file.Name,
+			Ext:     file.Ext,
+			Size:    file.BytesNum,
+			ModTime: file.ModTime,
+		})
+	}
+	if override != nil {
+		req.Override = &Override{
+			MediaType:     parser.MediaTypeString(override.MediaType),
+			Tmdbid:        override.Tmdbid,
+			Season:        override.Season,
+			EpisodeOffset: override.EpisodeOffset,
+		}
+	}
+	return req
+}
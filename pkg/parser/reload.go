@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+
+	"asmediamgr/pkg/dirwatch"
+)
+
+// Reloadable is an optional interface for parsers whose config can be reloaded at runtime
+// Reload must keep the previous config if the new one has any error, and swap it atomically otherwise,
+// a missing config file means no config as in Init, it is called concurrently with Parse
+type Reloadable interface {
+	Reload(cfgPath string) error
+}
+
+const (
+	configWatchDebounce = time.Second // reload a config only after it is quiet for this duration
+)
+
+// ReloadConfigs reloads configs of all enabled reloadable parsers, the overrides and absolute episode mapping files
+// from ConfigDir, a parser with an invalid config keeps its previous config, entries that failed without a match
+// or are overridden get their backoff reset if anything is reloaded
+// Note: this function is concurrent safe
+func (pm *ParserMgr) ReloadConfigs() error {
+	return pm.reloadConfigs(pm.parsers, true)
+}
+
+// WatchConfigs watches ConfigDir and reloads the config of a parser right away after it changed,
+// it returns after ctx is done
+func (pm *ParserMgr) WatchConfigs(ctx context.Context) error {
+	changes, err := dirwatch.Watch(ctx, pm.configDir, configWatchDebounce)
+	if err != nil {
+		return fmt.Errorf("Watch() error = %v", err)
+	}
+	for name := range changes {
+		if name == OverridesFileName || name == AbsoluteFileName {
+			err := pm.reloadConfigs(nil, true)
+			if err != nil {
+				level.Error(pm.logger).Log("msg", "failed to reload overrides", "err", err)
+			}
+			continue
+		}
+		parserName, ok := strings.CutSuffix(name, ".toml")
+		if !ok {
+			continue
+		}
+		info, ok := pm.parserInfo(parserName)
+		if !ok {
+			continue
+		}
+		err := pm.reloadConfigs([]parserInfo{info}, false)
+		if err != nil {
+			level.Error(pm.logger).Log("msg", "failed to reload config", "err", err)
+		}
+	}
+	return nil
+}
+
+func (pm *ParserMgr) reloadConfigs(parsers []parserInfo, overrides bool) error {
+	pm.reloadMu.Lock()
+	defer pm.reloadMu.Unlock()
+	var errs []error
+	reloaded := 0
+	if overrides {
+		err := pm.reloadOverrides()
+		if err != nil {
+			level.Error(pm.logger).Log("msg", "overrides rejected, previous overrides kept", "err", err)
+			errs = append(errs, fmt.Errorf("overrides: %v", err))
+		} else {
+			level.Info(pm.logger).Log("msg", "overrides reloaded")
+			reloaded++
+		}
+	}
+	for _, parserInfo := range parsers {
+		reloadable, ok := parserInfo.parser.(Reloadable)
+		if !ok {
+			continue
+		}
+		cfgPath := filepath.Join(pm.configDir, parserInfo.name+".toml")
+		err := reloadable.Reload(cfgPath)
+		if err != nil {
+			level.Error(pm.logger).Log("msg", "config rejected, previous config kept", "parser", parserInfo.name, "err", err)
+			errs = append(errs, fmt.Errorf("parser %s: %v", parserInfo.name, err))
+			continue
+		}
+		level.Info(pm.logger).Log("msg", "config reloaded", "parser", parserInfo.name)
+		reloaded++
+	}
+	if reloaded > 0 {
+		for _, sub := range pm.reloadSubs {
+			select {
+			case sub <- struct{}{}:
+			default: // already notified, not handled yet
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// subscribeReload returns a channel notified after configs are reloaded
+func (pm *ParserMgr) subscribeReload() <-chan struct{} {
+	pm.reloadMu.Lock()
+	defer pm.reloadMu.Unlock()
+	sub := make(chan struct{}, 1)
+	pm.reloadSubs = append(pm.reloadSubs, sub)
+	return sub
+}
+
+// resetNoMatch drops records of entries that failed without any parser error, so they run at the next scan
+// records with a parser error keep their backoff, a new config does not fix them
+func resetNoMatch(doNextTime map[string]*failNextTime) {
+	for entryName, nextTime := range doNextTime {
+		if nextTime.FailCnt > 0 && nextTime.LastErr == "" {
+			delete(doNextTime, entryName)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+type reloadParser struct {
+	MockParser
+	cfgPaths []string
+	fail     bool
+}
+
+func (p *reloadParser) Reload(cfgPath string) error {
+	if p.fail {
+		return fmt.Errorf("invalid config")
+	}
+	p.cfgPaths = append(p.cfgPaths, cfgPath)
+	return nil
+}
+
+func TestReloadConfigs(t *testing.T) {
+	good := &reloadParser{}
+	bad := &reloadParser{fail: true}
+	pm := &ParserMgr{
+		logger:    log.NewNopLogger(),
+		configDir: t.TempDir(),
+		parsers: []parserInfo{
+			{name: "good", parser: good},
+			{name: "bad", parser: bad},
+			{name: "mock", parser: &MockParser{}},
+		},
+	}
+	reload := pm.subscribeReload()
+	err := pm.ReloadConfigs()
+	if err == nil {
+		t.Fatalf("ReloadConfigs() should report the invalid config")
+	}
+	if len(good.cfgPaths) != 1 || good.cfgPaths[0] != filepath.Join(pm.configDir, "good.toml") {
+		t.Fatalf("ReloadConfigs() cfgPaths got = %v", good.cfgPaths)
+	}
+	select {
+	case <-reload:
+	default:
+		t.Fatalf("ReloadConfigs() should notify subscribers")
+	}
+
+	err = os.WriteFile(filepath.Join(pm.configDir, OverridesFileName), []byte("invalid toml ["), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.parsers = pm.parsers[1:]
+	_ = pm.ReloadConfigs()
+	select {
+	case <-reload:
+		t.Fatalf("ReloadConfigs() should not notify subscribers if nothing reloaded")
+	default:
+	}
+}
+
+func TestResetNoMatch(t *testing.T) {
+	doNextTime := map[string]*failNextTime{
+		"nomatch": {FailCnt: 3},
+		"failed":  {FailCnt: 3, LastErr: "parser tvdir: some error"},
+		"new":     {FailCnt: 0},
+	}
+	resetNoMatch(doNextTime)
+	if _, ok := doNextTime["nomatch"]; ok {
+		t.Fatalf("resetNoMatch() should reset entries without a match")
+	}
+	if _, ok := doNextTime["failed"]; !ok {
+		t.Fatalf("resetNoMatch() should keep entries failed with an error")
+	}
+	if _, ok := doNextTime["new"]; !ok {
+		t.Fatalf("resetNoMatch() should keep entries never run")
+	}
+}
@@ -0,0 +1,248 @@
+package parser
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"asmediamgr/pkg/common"
+	"asmediamgr/pkg/identify"
+)
+
+const (
+	reviewFileName = "review_queue.json"
+)
+
+// ReviewCandidate is a tmdb candidate of an ambiguous entry
+type ReviewCandidate struct {
+	Tmdbid        int     `json:"tmdbid"`
+	Title         string  `json:"title"`
+	OriginalTitle string  `json:"original_title,omitempty"`
+	Year          int     `json:"year,omitempty"`
+	Score         float64 `json:"score"`
+}
+
+// ReviewItem is a failed entry waiting for a manual match
+type ReviewItem struct {
+	ID                string             `json:"id"`
+	ScanDir           string             `json:"scan_dir"`
+	Entry             string             `json:"entry"`
+	Parser            string             `json:"parser,omitempty"`     // parser that failed, empty if no parser matched
+	Reason            string             `json:"reason"`               // last failure reason
+	MediaType         string             `json:"media_type,omitempty"` // media type of candidates, "tv" or "movie"
+	Candidates        []*ReviewCandidate `json:"candidates,omitempty"`
+	FailCnt           int32              `json:"fail_cnt"`
+	FirstSeen         time.Time          `json:"first_seen"`
+	LastSeen          time.Time          `json:"last_seen"`
+	ResolvedMediaType string             `json:"resolved_media_type,omitempty"`
+	ResolvedTmdbid    int                `json:"resolved_tmdbid,omitempty"`
+}
+
+// reviewQueue persists failed entries until they succeed, disappear or are resolved and succeed
+// Note: this struct is concurrent safe, items are copied out
+type reviewQueue struct {
+	mu    sync.Mutex
+	path  string // queue file path, empty means memory only
+	items map[string]*ReviewItem
+}
+
+type reviewFile struct {
+	Items []*ReviewItem `json:"items"`
+}
+
+// newReviewQueue creates a review queue in dataDir and loads the existing queue file if any
+// if dataDir is empty, the queue is kept in memory only
+func newReviewQueue(dataDir string) (*reviewQueue, error) {
+	q := &reviewQueue{
+		items: make(map[string]*ReviewItem),
+	}
+	if dataDir == "" {
+		return q, nil
+	}
+	err := os.MkdirAll(dataDir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("MkdirAll() error = %v", err)
+	}
+	q.path = filepath.Join(dataDir, reviewFileName)
+	content, err := os.ReadFile(q.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return q, nil
+		}
+		return nil, fmt.Errorf("ReadFile() error = %v", err)
+	}
+	rf := &reviewFile{}
+	err = json.Unmarshal(content, rf)
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshal() review file %s error = %v", q.path, err)
+	}
+	for _, item := range rf.Items {
+		q.items[item.ID] = item
+	}
+	return q, nil
+}
+
+func reviewItemID(scanDir, entryName string) string {
+	sum := sha1.Sum([]byte(scanDir + "\x00" + entryName))
+	return hex.EncodeToString(sum[:6])
+}
+
+// add adds or updates the item of a failed entry, parseErr is nil if no parser matched
+func (q *reviewQueue) add(scanDir, entryName string, parseErr error, failCnt int32, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	id := reviewItemID(scanDir, entryName)
+	item, ok := q.items[id]
+	if !ok {
+		item = &ReviewItem{ID: id, ScanDir: scanDir, Entry: entryName, FirstSeen: now}
+		q.items[id] = item
+	}
+	item.FailCnt = failCnt
+	item.LastSeen = now
+	item.Parser = ""
+	item.Reason = "no parser matched"
+	item.MediaType = ""
+	item.Candidates = nil
+	var parserErr *ParserError
+	if errors.As(parseErr, &parserErr) {
+		item.Parser = parserErr.Parser
+	}
+	if parseErr != nil {
+		item.Reason = parseErr.Error()
+	}
+	var ambiguousErr *identify.AmbiguousError
+	if errors.As(parseErr, &ambiguousErr) {
+		item.MediaType = MediaTypeString(ambiguousErr.MediaType)
+		for _, score := range ambiguousErr.Scores {
+			item.Candidates = append(item.Candidates, &ReviewCandidate{
+				Tmdbid:        score.Candidate.ID,
+				Title:         score.Candidate.Title,
+				OriginalTitle: score.Candidate.OriginalTitle,
+				Year:          score.Candidate.Year,
+				Score:         score.Total,
+			})
+		}
+	}
+	return q.saveLocked()
+}
+
+// remove removes the item of an entry, if any
+func (q *reviewQueue) remove(scanDir, entryName string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	id := reviewItemID(scanDir, entryName)
+	if _, ok := q.items[id]; !ok {
+		return nil
+	}
+	delete(q.items, id)
+	return q.saveLocked()
+}
+
+// retain drops items of scanDir whose entries are not in entriesMap any more
+func (q *reviewQueue) retain(scanDir string, entriesMap map[string]struct{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	changed := false
+	for id, item := range q.items {
+		if item.ScanDir != scanDir {
+			continue
+		}
+		if _, ok := entriesMap[item.Entry]; !ok {
+			delete(q.items, id)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return q.saveLocked()
+}
+
+// list returns copies of all items, sorted by scan dir and entry name
+func (q *reviewQueue) list() []*ReviewItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ret := make([]*ReviewItem, 0, len(q.items))
+	for _, item := range q.items {
+		copied := *item
+		ret = append(ret, &copied)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].ScanDir != ret[j].ScanDir {
+			return ret[i].ScanDir < ret[j].ScanDir
+		}
+		return ret[i].Entry < ret[j].Entry
+	})
+	return ret
+}
+
+// resolve records the manual match of an item, candidate is the index of its candidates,
+// or -1 to use tmdbid and mediaType instead
+func (q *reviewQueue) resolve(id string, candidate int, tmdbid int, mediaType string) (*ReviewItem, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item, ok := q.items[id]
+	if !ok {
+		return nil, fmt.Errorf("review item %s not found", id)
+	}
+	if candidate >= 0 {
+		if candidate >= len(item.Candidates) {
+			return nil, fmt.Errorf("candidate %d out of range, %d candidates", candidate, len(item.Candidates))
+		}
+		tmdbid = item.Candidates[candidate].Tmdbid
+		mediaType = item.MediaType
+	}
+	if tmdbid <= 0 {
+		return nil, fmt.Errorf("invalid tmdbid %d", tmdbid)
+	}
+	if _, err := ParseMediaType(mediaType); err != nil {
+		return nil, err
+	}
+	item.ResolvedTmdbid = tmdbid
+	item.ResolvedMediaType = mediaType
+	copied := *item
+	return &copied, q.saveLocked()
+}
+
+// resolved returns the manual match of an entry as an override, nil if not resolved
+func (q *reviewQueue) resolved(scanDir, entryName string) *Override {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item, ok := q.items[reviewItemID(scanDir, entryName)]
+	if !ok || item.ResolvedTmdbid <= 0 {
+		return nil
+	}
+	mediaType, err := ParseMediaType(item.ResolvedMediaType)
+	if err != nil {
+		return nil
+	}
+	return &Override{
+		Name:         entryName,
+		MediaTypeStr: item.ResolvedMediaType,
+		MediaType:    mediaType,
+		Tmdbid:       item.ResolvedTmdbid,
+	}
+}
+
+func (q *reviewQueue) saveLocked() error {
+	if q.path == "" {
+		return nil
+	}
+	rf := &reviewFile{Items: make([]*ReviewItem, 0, len(q.items))}
+	for _, item := range q.items {
+		rf.Items = append(rf.Items, item)
+	}
+	sort.Slice(rf.Items, func(i, j int) bool { return rf.Items[i].ID < rf.Items[j].ID })
+	content, err := json.MarshalIndent(rf, "", "  ")
+	if err != nil {
+		return fmt.Errorf("MarshalIndent() error = %v", err)
+	}
+	return common.WriteFileAtomic(q.path, content)
+}
@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-kit/log/level"
+)
+
+// ReviewItems returns all items of the review queue
+// Note: this function is concurrent safe
+func (pm *ParserMgr) ReviewItems() []*ReviewItem {
+	return pm.review.list()
+}
+
+// ResolveReview manually matches a review item, by the index of its candidates, or by tmdbid and mediaType
+// candidate is the index of the candidates, or -1 to use tmdbid and mediaType instead,
+// either way the entry is queued to run right away through the normal parser path with the match as an override,
+// queued is false if the entry could not be queued, it is then run at the next scan
+// Note: this function is concurrent safe
+func (pm *ParserMgr) ResolveReview(id string, candidate int, tmdbid int, mediaType string) (item *ReviewItem, queued bool, err error) {
+	item, err = pm.review.resolve(id, candidate, tmdbid, mediaType)
+	if err != nil {
+		return nil, false, err
+	}
+	level.Info(pm.logger).Log("msg", "review resolved", "scanDir", item.ScanDir, "entry", item.Entry, "mediaType", item.ResolvedMediaType, "tmdbid", item.ResolvedTmdbid)
+	err = pm.sendCmd(item.ScanDir, dirCmd{typ: cmdRunNow, entry: item.Entry})
+	return item, err == nil && !pm.isPaused(item.ScanDir), nil
+}
+
+// ReviewHandler returns the http handler of the review queue, accepting renames files,
+// so it is served only by the admin api behind its token
+//
+//	GET  /review                                         lists all items
+//	POST /review/accept?id=<id>&candidate=<index>        accepts a candidate of the item
+//	POST /review/accept?id=<id>&tmdbid=<id>&media_type=  enters a tmdbid of "tv" or "movie"
+func (pm *ParserMgr) ReviewHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/review", pm.handleReviewList)
+	mux.HandleFunc("/review/accept", pm.handleReviewAccept)
+	return mux
+}
+
+func (pm *ParserMgr) handleReviewList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, pm.ReviewItems())
+}
+
+func (pm *ParserMgr) handleReviewAccept(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	id := query.Get("id")
+	if id == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+	candidate, tmdbid := -1, 0
+	var err error
+	switch {
+	case query.Get("candidate") != "":
+		candidate, err = strconv.Atoi(query.Get("candidate"))
+		if err != nil || candidate < 0 {
+			http.Error(w, fmt.Sprintf("invalid candidate %q", query.Get("candidate")), http.StatusBadRequest)
+			return
+		}
+	case query.Get("tmdbid") != "":
+		tmdbid, err = strconv.Atoi(query.Get("tmdbid"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid tmdbid %q", query.Get("tmdbid")), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "candidate or tmdbid is required", http.StatusBadRequest)
+		return
+	}
+	item, queued, err := pm.ResolveReview(id, candidate, tmdbid, query.Get("media_type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, struct {
+		Item   *ReviewItem `json:"item"`
+		Queued bool        `json:"queued"` // false means the entry is run at the next scan
+	}{item, queued})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		fmt.Fprintf(w, "encode error: %v", err)
+	}
+}
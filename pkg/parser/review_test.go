@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+
+	"asmediamgr/pkg/common"
+	"asmediamgr/pkg/identify"
+)
+
+func TestReviewQueue(t *testing.T) {
+	dataDir := t.TempDir()
+	q, err := newReviewQueue(dataDir)
+	if err != nil {
+		t.Fatalf("newReviewQueue() error = %v", err)
+	}
+	ambiguousErr := &identify.AmbiguousError{
+		MediaType: common.MediaTypeTv,
+		Total:     2,
+		Scores: []*identify.Score{
+			{Candidate: &identify.Candidate{ID: 1, Title: "Show", Year: 2020}, Total: 0.7},
+			{Candidate: &identify.Candidate{ID: 2, Title: "Show", Year: 2010}, Total: 0.65},
+		},
+	}
+	parseErr := &ParserError{Parser: "tvdir", Err: fmt.Errorf("parse error: %w", ambiguousErr)}
+	err = q.add("downloads", "Show S01", parseErr, 1, time.Now())
+	if err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+	err = q.add("downloads", "Unknown", nil, 1, time.Now())
+	if err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+
+	q, err = newReviewQueue(dataDir)
+	if err != nil {
+		t.Fatalf("newReviewQueue() reload error = %v", err)
+	}
+	items := q.list()
+	if len(items) != 2 {
+		t.Fatalf("list() got = %d items, want = 2", len(items))
+	}
+	item := items[0]
+	if item.Entry != "Show S01" || item.Parser != "tvdir" || item.MediaType != "tv" || len(item.Candidates) != 2 {
+		t.Fatalf("list() got = %+v", item)
+	}
+	if q.resolved("downloads", "Show S01") != nil {
+		t.Fatalf("resolved() should be nil before resolve")
+	}
+	_, err = q.resolve(item.ID, 1, 0, "")
+	if err != nil {
+		t.Fatalf("resolve() error = %v", err)
+	}
+	override := q.resolved("downloads", "Show S01")
+	if override == nil || override.Tmdbid != 2 || override.MediaType != common.MediaTypeTv {
+		t.Fatalf("resolved() got = %+v", override)
+	}
+	_, err = q.resolve(items[1].ID, 0, 0, "")
+	if err == nil {
+		t.Fatalf("resolve() candidate out of range should fail")
+	}
+
+	err = q.retain("downloads", map[string]struct{}{"Show S01": {}})
+	if err != nil {
+		t.Fatalf("retain() error = %v", err)
+	}
+	if len(q.list()) != 1 {
+		t.Fatalf("retain() got = %d items, want = 1", len(q.list()))
+	}
+	err = q.remove("downloads", "Show S01")
+	if err != nil || len(q.list()) != 0 {
+		t.Fatalf("remove() got = %d items, err = %v", len(q.list()), err)
+	}
+}
+
+func TestReviewHandler(t *testing.T) {
+	review, err := newReviewQueue("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &ParserMgr{
+		logger: log.NewNopLogger(),
+		review: review,
+		cmds:   map[string]chan dirCmd{"downloads": make(chan dirCmd, 1)},
+	}
+	err = review.add("downloads", "Unknown", nil, 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := pm.ReviewHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/review", nil))
+	var items []*ReviewItem
+	err = json.Unmarshal(rec.Body.Bytes(), &items)
+	if rec.Code != http.StatusOK || err != nil || len(items) != 1 {
+		t.Fatalf("GET /review got = %d, %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/review/accept?id="+items[0].ID+"&tmdbid=123&media_type=music", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("POST /review/accept invalid media_type got = %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/review/accept?id="+items[0].ID+"&tmdbid=123&media_type=movie", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST /review/accept got = %d, %s", rec.Code, rec.Body.String())
+	}
+	select {
+	case cmd := <-pm.cmds["downloads"]:
+		if cmd.typ != cmdRunNow || cmd.entry != "Unknown" {
+			t.Fatalf("POST /review/accept run now got = %+v", cmd)
+		}
+	default:
+		t.Fatalf("POST /review/accept should run the entry right away")
+	}
+	if override := review.resolved("downloads", "Unknown"); override == nil || override.Tmdbid != 123 {
+		t.Fatalf("POST /review/accept resolved got = %+v", override)
+	}
+}
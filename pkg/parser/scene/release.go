@@ -0,0 +1,150 @@
+package scene
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"asmediamgr/pkg/common"
+)
+
+// Release is what is extracted from a scene release name, such as Show.Name.S01E02.1080p.WEB-DL.x264-GRP
+type Release struct {
+	Title      string
+	Year       int // 0 if unknown
+	Season     int // -1 if unknown
+	Episode    int // -1 if unknown
+	EpisodeEnd int // last episode of a multi-episode release, such as 2 of S01E01E02 or S01E01-02, 0 if single
+	Resolution string
+	Source     string
+	Codec      string
+	Group      string
+	Tags       int // number of tokens recognized as release tags, title excluded
+}
+
+func (r *Release) String() string {
+	return fmt.Sprintf("title = %q, year = %d, season = %d, episode = %d, episode end = %d, resolution = %s, source = %s, codec = %s, group = %s",
+		r.Title, r.Year, r.Season, r.Episode, r.EpisodeEnd, r.Resolution, r.Source, r.Codec, r.Group)
+}
+
+// IsRelease returns true if the name looks like a release name, a title with a year, an episode or two other tags
+func (r *Release) IsRelease() bool {
+	if r.Title == "" {
+		return false
+	}
+	return r.Year > 0 || r.Episode >= 0 || r.Tags >= 2
+}
+
+var (
+	episodeRe    = regexp.MustCompile(`(?i)^s(\d{1,2})e(\d{1,4})((?:-?e\d{1,4})*|-\d{1,4})$`)
+	crossEpRe    = regexp.MustCompile(`(?i)^(\d{1,2})x(\d{2,3})$`)
+	seasonRe     = regexp.MustCompile(`(?i)^s(\d{1,2})$`)
+	yearRe       = regexp.MustCompile(`^(19|20)\d{2}$`)
+	resolutionRe = regexp.MustCompile(`(?i)^(\d{3,4}[pi]|4k|uhd)$`)
+	// dotted tags are joined before splitting, so H.264 and DDP5.1 stay single tokens
+	dottedCodecRe = regexp.MustCompile(`(?i)\b(h)\.(26[45])\b`)
+	dottedAudioRe = regexp.MustCompile(`(?i)\b(ddp|dd|aac|ac3|eac3|dts|truehd|opus|flac)(\d)\.(\d)\b`)
+	separatorRe   = regexp.MustCompile(`[.\s_]+`)
+
+	sources = map[string]string{
+		"web-dl": "WEB-DL", "webdl": "WEB-DL", "webrip": "WEBRip", "web": "WEB",
+		"bluray": "BluRay", "blu-ray": "BluRay", "bdrip": "BDRip", "brrip": "BRRip", "remux": "Remux",
+		"hdtv": "HDTV", "dvdrip": "DVDRip", "hdrip": "HDRip", "dvd": "DVD",
+	}
+	codecs = map[string]string{
+		"x264": "x264", "x265": "x265", "h264": "H.264", "h265": "H.265",
+		"avc": "AVC", "hevc": "HEVC", "xvid": "XviD", "av1": "AV1",
+	}
+	// otherTags end the title but are not extracted
+	otherTags = map[string]bool{
+		"repack": true, "proper": true, "internal": true, "limited": true, "extended": true, "unrated": true,
+		"remastered": true, "multi": true, "dubbed": true, "subbed": true, "hdr": true, "hdr10": true, "dv": true,
+		"10bit": true, "8bit": true, "amzn": true, "nf": true, "dsnp": true, "atvp": true, "hmax": true, "hulu": true,
+		"atmos": true, "truehd": true, "dts": true, "aac": true, "ac3": true, "eac3": true, "ddp": true, "dd": true,
+	}
+	audioTagRe = regexp.MustCompile(`(?i)^(ddp|dd|aac|ac3|eac3|dts|truehd|opus|flac)\d{2}$`)
+)
+
+// ParseRelease tokenizes a release name without ext, the title is the tokens before the first tag,
+// a year right before the first tag is the year, unless it is the whole title, so 2012.2009.1080p is 2012 of 2009
+func ParseRelease(name string) *Release {
+	r := &Release{Season: -1, Episode: -1}
+	name = dottedCodecRe.ReplaceAllString(name, "$1$2")
+	name = dottedAudioRe.ReplaceAllString(name, "$1$2$3")
+	tokens := separatorRe.Split(strings.TrimSpace(name), -1)
+	tokens, r.Group = splitGroup(tokens)
+	end := len(tokens)
+	for i, token := range tokens {
+		if r.tag(token) && end == len(tokens) {
+			end = i
+		}
+	}
+	titleEnd := end
+	if end > 1 && yearRe.MatchString(tokens[end-1]) { // the first token is always title
+		r.Year, _ = strconv.Atoi(tokens[end-1])
+		r.Tags++
+		titleEnd = end - 1
+	}
+	r.Title = strings.TrimSpace(strings.Join(tokens[:titleEnd], " "))
+	return r
+}
+
+// splitGroup splits the release group off the last token, such as x264-GRP, a source with a dash is not a group
+func splitGroup(tokens []string) ([]string, string) {
+	if len(tokens) < 2 {
+		return tokens, ""
+	}
+	last := tokens[len(tokens)-1]
+	i := strings.LastIndex(last, "-")
+	if i <= 0 || i == len(last)-1 {
+		return tokens, ""
+	}
+	if _, ok := sources[strings.ToLower(last)]; ok {
+		return tokens, ""
+	}
+	ret := append(append([]string(nil), tokens[:len(tokens)-1]...), last[:i])
+	return ret, last[i+1:]
+}
+
+// tag records token into r if it is a release tag, years are handled by ParseRelease
+func (r *Release) tag(token string) bool {
+	lower := strings.ToLower(token)
+	if groups := episodeRe.FindStringSubmatch(token); groups != nil {
+		r.Season, _ = strconv.Atoi(groups[1])
+		r.Episode, _ = strconv.Atoi(groups[2])
+		more := groups[3] // more episodes, such as E02E03 or -02
+		if end, _ := strconv.Atoi(more[strings.LastIndexAny(more, "-eE")+1:]); end > r.Episode {
+			r.EpisodeEnd = end
+		}
+	} else if groups := crossEpRe.FindStringSubmatch(token); groups != nil {
+		r.Season, _ = strconv.Atoi(groups[1])
+		r.Episode, _ = strconv.Atoi(groups[2])
+	} else if groups := seasonRe.FindStringSubmatch(token); groups != nil {
+		r.Season, _ = strconv.Atoi(groups[1])
+	} else if resolutionRe.MatchString(token) {
+		r.Resolution = lower
+	} else if source, ok := sources[lower]; ok {
+		r.Source = source
+	} else if codec, ok := codecs[lower]; ok {
+		r.Codec = codec
+	} else if !otherTags[lower] && !audioTagRe.MatchString(token) {
+		return false
+	}
+	r.Tags++
+	return true
+}
+
+// mediaType returns the media type decided by the name alone, false if the name is not enough
+func (r *Release) mediaType() (common.MediaType, bool) {
+	switch {
+	case r.Episode >= 0:
+		return common.MediaTypeTv, true
+	case r.Season >= 0:
+		return common.MediaTypeTv, true // season pack, episodes are in its files
+	case r.Year > 0:
+		return common.MediaTypeMovie, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,54 @@
+package scene
+
+import (
+	"testing"
+)
+
+func TestParseRelease(t *testing.T) {
+	tests := []struct {
+		name string
+		want Release
+	}{
+		{"Show.Name.S01E02.1080p.WEB-DL.x264-GRP", Release{Title: "Show Name", Season: 1, Episode: 2, Resolution: "1080p", Source: "WEB-DL", Codec: "x264", Group: "GRP"}},
+		{"Movie.Name.2019.2160p.BluRay", Release{Title: "Movie Name", Year: 2019, Season: -1, Episode: -1, Resolution: "2160p", Source: "BluRay"}},
+		{"Show.Name.2021.S02E10.720p.HDTV.H.264-GRP", Release{Title: "Show Name", Year: 2021, Season: 2, Episode: 10, Resolution: "720p", Source: "HDTV", Codec: "H.264", Group: "GRP"}},
+		{"Blade.Runner.2049.2017.1080p.BluRay.DDP5.1.x265-GRP", Release{Title: "Blade Runner 2049", Year: 2017, Season: -1, Episode: -1, Resolution: "1080p", Source: "BluRay", Codec: "x265", Group: "GRP"}},
+		{"2012.2009.1080p.BluRay", Release{Title: "2012", Year: 2009, Season: -1, Episode: -1, Resolution: "1080p", Source: "BluRay"}},
+		{"Show Name 3x07 HDTV", Release{Title: "Show Name", Season: 3, Episode: 7, Source: "HDTV"}},
+		{"Show.Name.S01E01E02.720p", Release{Title: "Show Name", Season: 1, Episode: 1, EpisodeEnd: 2, Resolution: "720p"}},
+		{"Show.Name.S01E01-E03.720p", Release{Title: "Show Name", Season: 1, Episode: 1, EpisodeEnd: 3, Resolution: "720p"}},
+		{"Show.Name.S01E01-02.720p", Release{Title: "Show Name", Season: 1, Episode: 1, EpisodeEnd: 2, Resolution: "720p"}},
+		{"Show_Name_S03_1080p_WEB-DL", Release{Title: "Show Name", Season: 3, Episode: -1, Resolution: "1080p", Source: "WEB-DL"}},
+		{"Movie.Name.REPACK.1080p.WEBRip.HEVC", Release{Title: "Movie Name", Season: -1, Episode: -1, Resolution: "1080p", Source: "WEBRip", Codec: "HEVC"}},
+		{"holiday video", Release{Title: "holiday video", Season: -1, Episode: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseRelease(tt.name)
+			got.Tags = 0
+			if *got != tt.want {
+				t.Errorf("ParseRelease() got = %s, want = %s", got, &tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRelease(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"Show.Name.S01E02", true},
+		{"Movie.Name.2019", true},
+		{"Movie.Name.1080p.BluRay", true},
+		{"Movie.Name.1080p", false},
+		{"holiday video", false},
+		{"S01E02.1080p", false},
+		{"[Grp] Show - 03", false},
+	}
+	for _, tt := range tests {
+		if got := ParseRelease(tt.name).IsRelease(); got != tt.want {
+			t.Errorf("ParseRelease(%q).IsRelease() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
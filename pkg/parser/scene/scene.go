@@ -0,0 +1,330 @@
+// Package scene is a parser of scene release names, such as Show.Name.S01E02.1080p.WEB-DL.x264-GRP
+// and Movie.Name.2019.2160p.BluRay, it needs no config. It runs before the regex parsers by default,
+// and leaves entries it is not confident about to them.
+package scene
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"asmediamgr/pkg/common"
+	"asmediamgr/pkg/dirinfo"
+	"asmediamgr/pkg/disk"
+	"asmediamgr/pkg/identify"
+	"asmediamgr/pkg/parser"
+	"asmediamgr/pkg/utils"
+)
+
+const (
+	name            = "scene"
+	defaultPriority = -1 // before the regex parsers, so they are the fallback
+)
+
+func init() {
+	parser.RegisterParser(name, &Scene{})
+}
+
+// Config is the optional config of the parser
+type Config struct {
+	Priority *float32 `toml:"priority"`
+}
+
+type Scene struct {
+	logger log.Logger
+}
+
+func (p *Scene) IsDefaultEnable() bool {
+	return true
+}
+
+func (p *Scene) Init(cfgPath string, logger log.Logger) (priority float32, err error) {
+	p.logger = logger
+	cfg := &Config{}
+	_, err = toml.DecodeFile(cfgPath, cfg)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("DecodeFile() error = %v", err)
+	}
+	if cfg.Priority != nil {
+		return *cfg.Priority, nil
+	}
+	return defaultPriority, nil
+}
+
+// mediaFile is a media file of the entry with its own release name parsed
+type mediaFile struct {
+	file       *dirinfo.File
+	release    *Release
+	season     int
+	episode    int
+	episodeEnd int // 0 if single
+}
+
+// subtitleFile is a subtitle named after a media file, such as Movie.2019.1080p.chs.srt
+type subtitleFile struct {
+	file     *dirinfo.File
+	media    *mediaFile
+	language string
+}
+
+type sceneInfo struct {
+	release      *Release
+	mediaType    common.MediaType
+	mediaFiles   []*mediaFile
+	subtitles    []*subtitleFile
+	originalName string
+	year         int
+	tmdbid       int
+}
+
+func (p *Scene) Parse(entry *dirinfo.Entry, opts *parser.ParserMgrRunOpts) (plan *disk.Plan, err error) {
+	info, err := p.parse(entry, opts.Override, opts.Trace)
+	if err != nil || info == nil {
+		return nil, err
+	}
+	targetDir, ok := opts.MediaTypeDirs[info.mediaType]
+	if !ok {
+		return nil, fmt.Errorf("%s target dir not found, entry: %s", mediaTypeName(info.mediaType), entry.Name())
+	}
+	level.Info(p.logger).Log("msg", "matched", "entry", entry.Name(), "release", info.release, "originalName", info.originalName,
+		"year", info.year, "tmdbid", info.tmdbid, "files", len(info.mediaFiles), "subs", len(info.subtitles))
+	plan = &disk.Plan{}
+	for _, media := range info.mediaFiles {
+		oldPath := filepath.Join(entry.MotherPath, media.file.RelPathToMother)
+		if info.mediaType == common.MediaTypeTv {
+			plan.AddTvEpisode(&disk.TvEpisodeRenameTask{
+				OldPath:      oldPath,
+				NewMotherDir: targetDir,
+				OriginalName: info.originalName,
+				Year:         info.year,
+				Tmdbid:       info.tmdbid,
+				Season:       media.season,
+				Episode:      media.episode,
+				EpisodeEnd:   media.episodeEnd,
+			})
+			continue
+		}
+		plan.AddMovie(&disk.MovieRenameTask{
+			OldPath:      oldPath,
+			NewMotherDir: targetDir,
+			OriginalName: info.originalName,
+			Year:         info.year,
+			Tmdbid:       info.tmdbid,
+		})
+	}
+	for _, sub := range info.subtitles {
+		oldPath := filepath.Join(entry.MotherPath, sub.file.RelPathToMother)
+		if info.mediaType == common.MediaTypeTv {
+			plan.AddTvSubtitle(&disk.TvSubtitleRenameTask{
+				OldPath:      oldPath,
+				NewMotherDir: targetDir,
+				OriginalName: info.originalName,
+				Year:         info.year,
+				Tmdbid:       info.tmdbid,
+				Season:       sub.media.season,
+				Episode:      sub.media.episode,
+				EpisodeEnd:   sub.media.episodeEnd,
+				Language:     sub.language,
+			})
+			continue
+		}
+		plan.AddMovieSubtitle(&disk.MovieSubtitleRenameTask{
+			OldPath:      oldPath,
+			NewMotherDir: targetDir,
+			OriginalName: info.originalName,
+			Year:         info.year,
+			Tmdbid:       info.tmdbid,
+			Language:     sub.language,
+		})
+	}
+	if entry.Type == dirinfo.DirEntry {
+		trashDir, ok := opts.MediaTypeDirs[common.MediaTypeTrash]
+		if !ok {
+			return nil, fmt.Errorf("trash dir not found, entry: %s", entry.Name())
+		}
+		plan.AddMoveToTrash(&disk.MoveToTrashTask{
+			Path:     filepath.Join(entry.MotherPath, entry.Name()),
+			TrashDir: trashDir,
+		}).Optional = true
+	}
+	return plan, nil
+}
+
+// parse returns nil info without error if the entry is not a release name or the match is not confident
+func (p *Scene) parse(entry *dirinfo.Entry, override *parser.Override, trace *parser.Trace) (*sceneInfo, error) {
+	info := &sceneInfo{}
+	switch entry.Type {
+	case dirinfo.FileEntry:
+		file := entry.FileList[0]
+		if !utils.IsMediaExt(file.Ext) {
+			trace.Logf("not a media file")
+			return nil, nil
+		}
+		info.release = ParseRelease(strings.TrimSuffix(file.Name, file.Ext))
+		info.mediaFiles = []*mediaFile{{file: file, release: info.release}}
+	case dirinfo.DirEntry:
+		info.release = ParseRelease(entry.Name())
+		info.mediaFiles, info.subtitles = dirFiles(entry)
+		if len(info.mediaFiles) == 0 {
+			trace.Logf("no media file in dir")
+			return nil, nil
+		}
+	}
+	trace.Logf("release %s", info.release)
+	if !info.release.IsRelease() {
+		trace.Logf("not a release name")
+		return nil, nil
+	}
+	tmdbService := trace.TmdbService(parser.GetDefaultTmdbService())
+	var ok bool
+	info.mediaType, ok = info.release.mediaType()
+	switch {
+	case override != nil:
+		info.mediaType, info.tmdbid = override.MediaType, override.Tmdbid
+	case !ok:
+		mediaType, tmdbid, err := identify.SearchMulti(tmdbService, info.release.Title, info.release.Year, p.logger)
+		if lowConfidence(err) {
+			trace.Logf("low confidence of multi search: %v", err)
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("search multi, error = %w", err)
+		}
+		info.mediaType, info.tmdbid = mediaType, tmdbid
+		trace.Logf("multi search decided %s, tmdbid = %d", mediaTypeName(mediaType), tmdbid)
+	}
+	if !p.checkFiles(info, override, trace) {
+		return nil, nil
+	}
+	err := p.identify(tmdbService, info, trace)
+	if lowConfidence(err) {
+		trace.Logf("low confidence of search: %v", err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// checkFiles sets season and episode of tv media files, it returns false if the media files do not fit the media type
+func (p *Scene) checkFiles(info *sceneInfo, override *parser.Override, trace *parser.Trace) bool {
+	if info.mediaType == common.MediaTypeMovie {
+		if len(info.mediaFiles) != 1 {
+			trace.Logf("movie with %d media files", len(info.mediaFiles))
+			return false
+		}
+		return true
+	}
+	for _, media := range info.mediaFiles {
+		media.season, media.episode = media.release.Season, media.release.Episode
+		if media.season < 0 {
+			media.season = info.release.Season
+		}
+		episode := media.episode
+		media.season, media.episode = override.ApplyTv(media.season, media.episode)
+		if media.release.EpisodeEnd > episode {
+			media.episodeEnd = media.release.EpisodeEnd + media.episode - episode
+		}
+		if media.season < 0 || media.episode < 0 {
+			trace.Logf("no season or episode in %s", media.file.Name)
+			return false
+		}
+	}
+	return true
+}
+
+// identify searches tmdb for the release title if tmdbid is unknown, and loads the details
+func (p *Scene) identify(tmdbService parser.TmdbService, info *sceneInfo, trace *parser.Trace) (err error) {
+	var releaseDate string
+	switch info.mediaType {
+	case common.MediaTypeTv:
+		if info.tmdbid <= 0 {
+			info.tmdbid, err = identify.SearchTv(tmdbService, info.release.Title, info.release.Year, p.logger)
+			if err != nil {
+				return fmt.Errorf("search tv, error = %w", err)
+			}
+		}
+		detail, err := tmdbService.GetTVDetails(info.tmdbid, common.DefaultTmdbSearchOpts)
+		if err != nil {
+			return fmt.Errorf("get tv detail of tmdbid = %d, error = %v", info.tmdbid, err)
+		}
+		info.originalName, releaseDate = detail.OriginalName, detail.FirstAirDate
+	default:
+		if info.tmdbid <= 0 {
+			info.tmdbid, err = identify.SearchMovie(tmdbService, info.release.Title, info.release.Year, p.logger)
+			if err != nil {
+				return fmt.Errorf("search movie, error = %w", err)
+			}
+		}
+		detail, err := tmdbService.GetMovieDetails(info.tmdbid, common.DefaultTmdbSearchOpts)
+		if err != nil {
+			return fmt.Errorf("get movie detail of tmdbid = %d, error = %v", info.tmdbid, err)
+		}
+		info.originalName, releaseDate = detail.OriginalTitle, detail.ReleaseDate
+	}
+	dt, err := common.ParseTmdbDateStr(releaseDate)
+	if err != nil {
+		return fmt.Errorf("tmdbid = %d, invalid release date = %s", info.tmdbid, releaseDate)
+	}
+	info.year = dt.Year
+	trace.Logf("identified %q of %d, tmdbid = %d", info.originalName, info.year, info.tmdbid)
+	return nil
+}
+
+// lowConfidence returns true if tmdb found nothing or nothing confident enough, the entry is left to other parsers
+func lowConfidence(err error) bool {
+	var ambiguousErr *identify.AmbiguousError
+	return errors.Is(err, identify.ErrNoCandidate) || errors.As(err, &ambiguousErr)
+}
+
+// dirFiles returns media files of a dir entry except samples, and subtitles named after one of them
+func dirFiles(entry *dirinfo.Entry) ([]*mediaFile, []*subtitleFile) {
+	var mediaFiles []*mediaFile
+	for _, file := range entry.FileList {
+		if !utils.IsMediaExt(file.Ext) || isSample(file) {
+			continue
+		}
+		mediaFiles = append(mediaFiles, &mediaFile{file: file, release: ParseRelease(strings.TrimSuffix(file.Name, file.Ext))})
+	}
+	var subtitles []*subtitleFile
+	for _, file := range entry.FileList {
+		if !utils.IsSubtitleExt(file.Ext) {
+			continue
+		}
+		base := strings.TrimSuffix(file.Name, file.Ext)
+		for _, media := range mediaFiles {
+			mediaBase := strings.TrimSuffix(media.file.Name, media.file.Ext)
+			if lang, ok := strings.CutPrefix(base, mediaBase); ok && (lang == "" || lang[0] == '.') {
+				subtitles = append(subtitles, &subtitleFile{file: file, media: media, language: strings.TrimPrefix(lang, ".")})
+				break
+			}
+		}
+	}
+	return mediaFiles, subtitles
+}
+
+// isSample returns true for sample clips shipped with releases, such as Sample/movie-sample.mkv
+func isSample(file *dirinfo.File) bool {
+	for _, part := range strings.FieldsFunc(strings.ToLower(filepath.ToSlash(file.RelPathToMother)), func(r rune) bool {
+		return r == '/' || r == '.' || r == '-' || r == '_' || r == ' '
+	}) {
+		if part == "sample" {
+			return true
+		}
+	}
+	return false
+}
+
+func mediaTypeName(mediaType common.MediaType) string {
+	if mediaType == common.MediaTypeTv {
+		return "tv"
+	}
+	return "movie"
+}
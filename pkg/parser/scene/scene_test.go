@@ -0,0 +1,117 @@
+package scene
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	tmdb "github.com/cyruzin/golang-tmdb"
+	"github.com/go-kit/log"
+
+	"asmediamgr/pkg/common"
+	"asmediamgr/pkg/dirinfo"
+	"asmediamgr/pkg/disk"
+	"asmediamgr/pkg/parser"
+	"asmediamgr/pkg/parser/fakes"
+)
+
+// results builds tmdb search results from json, their result structs are anonymous
+func results[T any](t *testing.T, content string) *T {
+	t.Helper()
+	ret := new(T)
+	if err := json.Unmarshal([]byte(content), ret); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	return ret
+}
+
+func TestParse(t *testing.T) {
+	parser.RegisterTmdbService(fakes.NewFakeTmdbService(
+		fakes.WithTvQueryMapping("Show Name", results[tmdb.SearchTVShows](t,
+			`{"results":[{"id":100,"name":"Show Name","original_name":"Show Name","first_air_date":"2020-04-01"}]}`)),
+		fakes.WithTvIdMapping(100, &tmdb.TVDetails{ID: 100, OriginalName: "Show Name", FirstAirDate: "2020-04-01"}),
+		fakes.WithMovieQueryMapping("Movie Name", results[tmdb.SearchMovies](t,
+			`{"results":[{"id":200,"title":"Movie Name","original_title":"Movie Name","release_date":"2019-06-01"}]}`)),
+		fakes.WithMovieQueryMapping("Unknown Name", results[tmdb.SearchMovies](t, `{"results":[]}`)),
+		fakes.WithMovieIdMapping(200, &tmdb.MovieDetails{ID: 200, OriginalTitle: "Movie Name", ReleaseDate: "2019-06-01"}),
+		fakes.WithMultiQueryMapping("Show Name", results[tmdb.SearchMulti](t,
+			`{"results":[{"id":100,"media_type":"tv","name":"Show Name","original_name":"Show Name","first_air_date":"2020-04-01"},
+			{"id":7,"media_type":"person","name":"Show Name"}]}`)),
+		fakes.WithMultiQueryMapping("Same Name", results[tmdb.SearchMulti](t,
+			`{"results":[{"id":300,"media_type":"movie","title":"Same Name","release_date":"2001-01-01","popularity":10},
+			{"id":301,"media_type":"tv","name":"Same Name","first_air_date":"2011-01-01","popularity":10}]}`)),
+	))
+	p := &Scene{logger: log.NewNopLogger()}
+	opts := &parser.ParserMgrRunOpts{MediaTypeDirs: fakes.MediaTypeDirs()}
+
+	plan, err := p.Parse(fakes.FileEntry("Show.Name.S01E02.1080p.WEB-DL.x264-GRP.mkv"), opts)
+	if err != nil || plan == nil || len(plan.Ops) != 1 {
+		t.Fatalf("Parse() tv file got plan = %v, error = %v", plan, err)
+	}
+	episode := plan.Ops[0].TvEpisode
+	if plan.Ops[0].Type != disk.OpRenameTvEpisode || episode.Tmdbid != 100 || episode.Year != 2020 || episode.Season != 1 || episode.Episode != 2 {
+		t.Errorf("Parse() tv file got = %+v", episode)
+	}
+
+	entry := fakes.DirEntry("Movie.Name.2019.2160p.BluRay.x265-GRP",
+		"Movie.Name.2019.2160p.BluRay.x265-GRP.mkv",
+		"Movie.Name.2019.2160p.BluRay.x265-GRP.chs.srt",
+		filepath.Join("Sample", "movie-sample.mkv"),
+		"GRP.nfo",
+	)
+	plan, err = p.Parse(entry, opts)
+	if err != nil || plan == nil || len(plan.Ops) != 3 {
+		t.Fatalf("Parse() movie dir got plan = %v, error = %v", plan, err)
+	}
+	if movie := plan.Ops[0].Movie; plan.Ops[0].Type != disk.OpRenameMovie || movie.Tmdbid != 200 || movie.Year != 2019 ||
+		movie.OldPath != filepath.Join("scan", entry.FileList[0].RelPathToMother) {
+		t.Errorf("Parse() movie got = %+v", plan.Ops[0].Movie)
+	}
+	if sub := plan.Ops[1].MovieSubtitle; plan.Ops[1].Type != disk.OpRenameMovieSubtitle || sub.Language != "chs" {
+		t.Errorf("Parse() movie subtitle got = %+v", plan.Ops[1])
+	}
+	if plan.Ops[2].Type != disk.OpMoveToTrash || !plan.Ops[2].Optional {
+		t.Errorf("Parse() trash got = %+v", plan.Ops[2])
+	}
+
+	plan, err = p.Parse(fakes.DirEntry("Show.Name.S01.1080p.WEB-DL", "Show.Name.S01E01.1080p.WEB-DL.mkv", "Show.Name.S01E02.1080p.WEB-DL.mkv"), opts)
+	if err != nil || plan == nil || len(plan.Ops) != 3 || plan.Ops[1].TvEpisode.Episode != 2 {
+		t.Errorf("Parse() season pack got plan = %v, error = %v", plan, err)
+	}
+
+	plan, err = p.Parse(fakes.DirEntry("Show.Name.1080p.WEB-DL", "Show.Name.1x05.mkv"), opts)
+	if err != nil || plan == nil || plan.Ops[0].Type != disk.OpRenameTvEpisode || plan.Ops[0].TvEpisode.Episode != 5 {
+		t.Errorf("Parse() multi search got plan = %v, error = %v", plan, err)
+	}
+
+	for _, entry := range []*dirinfo.Entry{
+		fakes.FileEntry("Same.Name.1080p.BluRay.mkv"),                           // ambiguous multi search
+		fakes.FileEntry("Unknown.Name.2019.1080p.mkv"),                          // not found
+		fakes.FileEntry("[Grp] Show Name - 03 [1080p].mkv"),                     // not a release name
+		fakes.FileEntry("Show.Name.S01E02.1080p.nfo"),                           // not a media file
+		fakes.DirEntry("Show.Name.S01.1080p.WEB-DL", "Extras.1080p.WEB-DL.mkv"), // no episode
+		fakes.DirEntry("Movie.Name.2019.1080p.BluRay", "CD1.mkv", "CD2.mkv"),    // a movie of two files
+	} {
+		plan, err = p.Parse(entry, opts)
+		if err != nil || plan != nil {
+			t.Errorf("Parse(%s) got plan = %v, error = %v, want no match", entry.Name(), plan, err)
+		}
+	}
+}
+
+func TestParseOverride(t *testing.T) {
+	parser.RegisterTmdbService(fakes.NewFakeTmdbService(
+		fakes.WithTvIdMapping(100, &tmdb.TVDetails{ID: 100, OriginalName: "Show Name", FirstAirDate: "2020-04-01"}),
+	))
+	p := &Scene{logger: log.NewNopLogger()}
+	opts := &parser.ParserMgrRunOpts{MediaTypeDirs: fakes.MediaTypeDirs()}
+	season := 2
+	opts.Override = &parser.Override{MediaType: common.MediaTypeTv, Tmdbid: 100, Season: &season}
+	plan, err := p.Parse(fakes.FileEntry("Other.Title.S01E03.1080p.WEB-DL.mkv"), opts)
+	if err != nil || plan == nil {
+		t.Fatalf("Parse() with override got plan = %v, error = %v", plan, err)
+	}
+	if got := plan.Ops[0].TvEpisode; got.Tmdbid != 100 || got.Season != 2 || got.Episode != 3 {
+		t.Errorf("Parse() with override got = %+v", got)
+	}
+}
@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"strings"
+	"time"
+
+	"asmediamgr/pkg/dirinfo"
+)
+
+var (
+	// DefaultPartialExts are extensions of files still being downloaded by common download clients
+	DefaultPartialExts = []string{".part", ".!qB", ".!ut", ".crdownload", ".aria2", ".tmp"}
+)
+
+// SettleOpts is the policy to decide whether an entry is still being written
+// an entry is settled if any of the enabled conditions is met, if none is enabled, every entry is settled
+type SettleOpts struct {
+	Dur         time.Duration // settled if total size and newest mtime unchanged for Dur, 0 to disable
+	TwoScans    bool          // settled if total size and newest mtime unchanged across two scans
+	PartialExts []string      // entries containing any file with these extensions are never settled
+}
+
+// entrySnapshot is what an entry looked like at the last scan
+type entrySnapshot struct {
+	totalSize   int64
+	newestMtime time.Time
+}
+
+// settleTracker tracks entry snapshots of a single scan dir
+// Note: this struct is NOT concurrent safe
+type settleTracker struct {
+	opts      SettleOpts
+	snapshots map[string]entrySnapshot
+}
+
+func newSettleTracker(opts SettleOpts) *settleTracker {
+	return &settleTracker{
+		opts:      opts,
+		snapshots: make(map[string]entrySnapshot),
+	}
+}
+
+// settled records the entry snapshot and reports whether the entry can be handed to parsers
+func (st *settleTracker) settled(entry *dirinfo.Entry, now time.Time) (ok bool, reason string) {
+	snapshot := entrySnapshot{}
+	for _, file := range entry.FileList {
+		if isPartialExt(file.Ext, st.opts.PartialExts) {
+			return false, "partial download file " + file.Name
+		}
+		snapshot.totalSize += file.BytesNum
+		if file.ModTime.After(snapshot.newestMtime) {
+			snapshot.newestMtime = file.ModTime
+		}
+	}
+	prev, seen := st.snapshots[entry.Name()]
+	st.snapshots[entry.Name()] = snapshot
+	if st.opts.Dur <= 0 && !st.opts.TwoScans {
+		return true, ""
+	}
+	if seen && prev != snapshot {
+		return false, "changed since last scan"
+	}
+	if st.opts.Dur > 0 && now.Sub(snapshot.newestMtime) >= st.opts.Dur {
+		return true, ""
+	}
+	if st.opts.TwoScans && seen {
+		return true, ""
+	}
+	return false, "not settled yet"
+}
+
+// minRecheck is the shortest wait before an entry not settled is checked again
+const minRecheck = time.Second
+
+// recheckAfter returns how long to wait before checking again an entry that settled just refused,
+// quiet is the wait for a second observation of TwoScans, false if waiting alone does not help, such as a partial download
+func (st *settleTracker) recheckAfter(entry *dirinfo.Entry, now time.Time, quiet time.Duration) (time.Duration, bool) {
+	for _, file := range entry.FileList {
+		if isPartialExt(file.Ext, st.opts.PartialExts) {
+			return 0, false // the watcher reports the entry again when the download is renamed
+		}
+	}
+	snapshot, ok := st.snapshots[entry.Name()]
+	if !ok || (st.opts.Dur <= 0 && !st.opts.TwoScans) {
+		return 0, false
+	}
+	wait := time.Duration(-1)
+	if st.opts.Dur > 0 {
+		wait = st.opts.Dur - now.Sub(snapshot.newestMtime)
+	}
+	if st.opts.TwoScans && (wait < 0 || quiet < wait) {
+		wait = quiet
+	}
+	if wait < minRecheck {
+		wait = minRecheck
+	}
+	return wait, true
+}
+
+// prune drops snapshots of entries not in entriesMap
+func (st *settleTracker) prune(entriesMap map[string]struct{}) {
+	for name := range st.snapshots {
+		if _, ok := entriesMap[name]; !ok {
+			delete(st.snapshots, name)
+		}
+	}
+}
+
+func isPartialExt(ext string, partialExts []string) bool {
+	for _, partialExt := range partialExts {
+		if strings.EqualFold(ext, partialExt) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"asmediamgr/pkg/dirinfo"
+)
+
+func testSettleEntry(size int64, mtime time.Time, ext string) *dirinfo.Entry {
+	return &dirinfo.Entry{
+		Type:      dirinfo.DirEntry,
+		MyDirPath: "entry",
+		FileList: []*dirinfo.File{
+			{Name: "file" + ext, Ext: ext, BytesNum: size, ModTime: mtime},
+		},
+	}
+}
+
+func TestSettleTrackerDur(t *testing.T) {
+	now := time.Now()
+	st := newSettleTracker(SettleOpts{Dur: time.Minute})
+	if ok, _ := st.settled(testSettleEntry(100, now.Add(-10*time.Second), ".mkv"), now); ok {
+		t.Fatalf("settled() recently modified entry should not be settled")
+	}
+	if ok, _ := st.settled(testSettleEntry(100, now.Add(-10*time.Second), ".mkv"), now.Add(time.Minute)); !ok {
+		t.Fatalf("settled() entry unchanged for 1 minute should be settled")
+	}
+	if ok, _ := st.settled(testSettleEntry(200, now.Add(-2*time.Minute), ".mkv"), now); ok {
+		t.Fatalf("settled() entry changed since last scan should not be settled")
+	}
+}
+
+func TestSettleTrackerTwoScans(t *testing.T) {
+	now := time.Now()
+	st := newSettleTracker(SettleOpts{TwoScans: true})
+	if ok, _ := st.settled(testSettleEntry(100, now, ".mkv"), now); ok {
+		t.Fatalf("settled() first scan should not be settled")
+	}
+	if ok, _ := st.settled(testSettleEntry(100, now, ".mkv"), now); !ok {
+		t.Fatalf("settled() unchanged across two scans should be settled")
+	}
+	st.prune(map[string]struct{}{})
+	if ok, _ := st.settled(testSettleEntry(100, now, ".mkv"), now); ok {
+		t.Fatalf("settled() pruned entry should start over")
+	}
+}
+
+func TestSettleTrackerPartialExt(t *testing.T) {
+	now := time.Now()
+	st := newSettleTracker(SettleOpts{PartialExts: DefaultPartialExts})
+	if ok, _ := st.settled(testSettleEntry(100, now.Add(-time.Hour), ".!qB"), now); ok {
+		t.Fatalf("settled() partial download should never be settled")
+	}
+	if ok, _ := st.settled(testSettleEntry(100, now, ".mkv"), now); !ok {
+		t.Fatalf("settled() no policy enabled should be settled")
+	}
+}
+
+func TestSettleTrackerRecheckAfter(t *testing.T) {
+	now := time.Now()
+	st := newSettleTracker(SettleOpts{Dur: time.Minute, TwoScans: true, PartialExts: DefaultPartialExts})
+	entry := testSettleEntry(100, now.Add(-50*time.Second), ".mkv")
+	if _, ok := st.recheckAfter(entry, now, 30*time.Second); ok {
+		t.Fatalf("recheckAfter() entry never seen should not be rechecked")
+	}
+	st.settled(entry, now)
+	if wait, ok := st.recheckAfter(entry, now, 30*time.Second); !ok || wait != 10*time.Second {
+		t.Fatalf("recheckAfter() got = %v, %v, want = 10s before settle dur", wait, ok)
+	}
+	entry = testSettleEntry(200, now, ".mkv")
+	st.settled(entry, now)
+	if wait, ok := st.recheckAfter(entry, now, 30*time.Second); !ok || wait != 30*time.Second {
+		t.Fatalf("recheckAfter() got = %v, %v, want = 30s for a second observation", wait, ok)
+	}
+	if _, ok := st.recheckAfter(testSettleEntry(100, now, ".!qB"), now, 30*time.Second); ok {
+		t.Fatalf("recheckAfter() partial download should not be rechecked")
+	}
+}
@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"asmediamgr/pkg/common"
+)
+
+const (
+	stateFileName = "parser_state.json"
+)
+
+// stateStore persists the failNextTime records of every scan dir, so backoff survives restarts
+// Note: this struct is concurrent safe, records are copied in and out
+type stateStore struct {
+	mu   sync.Mutex
+	path string                              // state file path, empty means memory only
+	dirs map[string]map[string]*failNextTime // scan dir -> entry name -> record
+}
+
+// stateFile is the on-disk layout of the state file
+type stateFile struct {
+	ScanDirs map[string]map[string]*failNextTime `json:"scan_dirs"`
+}
+
+// newStateStore creates a state store in dataDir and loads the existing state file if any
+// if dataDir is empty, the state is kept in memory only
+func newStateStore(dataDir string) (*stateStore, error) {
+	s := &stateStore{
+		dirs: make(map[string]map[string]*failNextTime),
+	}
+	if dataDir == "" {
+		return s, nil
+	}
+	err := os.MkdirAll(dataDir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("MkdirAll() error = %v", err)
+	}
+	s.path = filepath.Join(dataDir, stateFileName)
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("ReadFile() error = %v", err)
+	}
+	sf := &stateFile{}
+	err = json.Unmarshal(content, sf)
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshal() state file %s error = %v", s.path, err)
+	}
+	for scanDir, records := range sf.ScanDirs {
+		if records == nil {
+			continue
+		}
+		s.dirs[scanDir] = records
+	}
+	return s, nil
+}
+
+// load returns a copy of the records of scanDir
+func (s *stateStore) load(scanDir string) map[string]*failNextTime {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyRecords(s.dirs[scanDir])
+}
+
+// update replaces the records of scanDir with a copy of records and writes the state file,
+// entries not in records are pruned
+func (s *stateStore) update(scanDir string, records map[string]*failNextTime) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirs[scanDir] = copyRecords(records)
+	return s.saveLocked()
+}
+
+// retain drops the records of scan dirs not in scanDirs
+func (s *stateStore) retain(scanDirs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keep := make(map[string]struct{}, len(scanDirs))
+	for _, scanDir := range scanDirs {
+		keep[scanDir] = struct{}{}
+	}
+	for scanDir := range s.dirs {
+		if _, ok := keep[scanDir]; !ok {
+			delete(s.dirs, scanDir)
+		}
+	}
+}
+
+// saveLocked writes the state file atomically, by writing a temp file and renaming it
+func (s *stateStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	content, err := json.MarshalIndent(&stateFile{ScanDirs: s.dirs}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("MarshalIndent() error = %v", err)
+	}
+	return common.WriteFileAtomic(s.path, content)
+}
+
+func copyRecords(records map[string]*failNextTime) map[string]*failNextTime {
+	ret := make(map[string]*failNextTime, len(records))
+	for name, record := range records {
+		if record == nil {
+			continue
+		}
+		r := *record
+		ret[name] = &r
+	}
+	return ret
+}
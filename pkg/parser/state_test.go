@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStateStoreSaveAndLoad(t *testing.T) {
+	dataDir := t.TempDir()
+	s, err := newStateStore(dataDir)
+	if err != nil {
+		t.Fatalf("newStateStore() error = %v", err)
+	}
+	validTime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	err = s.update("scan1", map[string]*failNextTime{
+		"entry1": {ValidTime: validTime, FailCnt: 3, LastErr: "multiple results"},
+	})
+	if err != nil {
+		t.Fatalf("update() error = %v", err)
+	}
+	err = s.update("scan2", map[string]*failNextTime{
+		"entry2": {ValidTime: validTime, FailCnt: 1},
+	})
+	if err != nil {
+		t.Fatalf("update() error = %v", err)
+	}
+
+	reloaded, err := newStateStore(dataDir)
+	if err != nil {
+		t.Fatalf("newStateStore() reload error = %v", err)
+	}
+	records := reloaded.load("scan1")
+	if len(records) != 1 {
+		t.Fatalf("load() got = %d records, want = 1", len(records))
+	}
+	record := records["entry1"]
+	if record == nil || !record.ValidTime.Equal(validTime) || record.FailCnt != 3 || record.LastErr != "multiple results" {
+		t.Fatalf("load() got = %+v", record)
+	}
+
+	reloaded.retain([]string{"scan1"})
+	if len(reloaded.load("scan2")) != 0 {
+		t.Fatalf("retain() scan2 should be dropped")
+	}
+}
+
+func TestStateStorePrune(t *testing.T) {
+	s, err := newStateStore("")
+	if err != nil {
+		t.Fatalf("newStateStore() error = %v", err)
+	}
+	err = s.update("scan", map[string]*failNextTime{
+		"entry1": {FailCnt: 1},
+		"entry2": {FailCnt: 2},
+	})
+	if err != nil {
+		t.Fatalf("update() error = %v", err)
+	}
+	records := s.load("scan")
+	delete(records, "entry1")
+	records["entry2"].FailCnt = 5
+	if s.load("scan")["entry2"].FailCnt != 2 {
+		t.Fatalf("load() should return a copy")
+	}
+	err = s.update("scan", records)
+	if err != nil {
+		t.Fatalf("update() error = %v", err)
+	}
+	records = s.load("scan")
+	if _, ok := records["entry1"]; ok {
+		t.Fatalf("update() entry1 should be pruned")
+	}
+	if records["entry2"].FailCnt != 5 {
+		t.Fatalf("update() entry2 got = %d, want = 5", records["entry2"].FailCnt)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
+	"sync"
 
 	"github.com/BurntSushi/toml"
 	"github.com/go-kit/log"
@@ -14,6 +16,7 @@ import (
 	"asmediamgr/pkg/common"
 	"asmediamgr/pkg/dirinfo"
 	"asmediamgr/pkg/disk"
+	"asmediamgr/pkg/identify"
 	"asmediamgr/pkg/parser"
 	"asmediamgr/pkg/utils"
 )
@@ -28,6 +31,7 @@ func init() {
 
 type TvDir struct {
 	logger   log.Logger
+	mu       sync.RWMutex // guards patterns, swapped on reload
 	patterns []*Pattern
 }
 
@@ -37,6 +41,8 @@ type Pattern struct {
 	EpisodeFileAtLeast string `toml:"episode_file_at_least"`
 	SubtitlePatternStr string `toml:"subtitle_pattern"`
 	Season             *int   `toml:"season"`
+	Absolute           bool   `toml:"absolute"`      // episodes are absolute numbers, mapped to tmdb seasons and episodes
+	EpisodeGroup       string `toml:"episode_group"` // seasons and episodes are in the ordering of the tmdb episode group
 
 	DirPattern              *regexp.Regexp
 	EpisodePattern          *regexp.Regexp
@@ -50,66 +56,102 @@ type Config struct {
 
 func (p *TvDir) Init(cfgPath string, logger log.Logger) (priority float32, err error) {
 	p.logger = logger
-	cfg := &Config{}
-	_, err = toml.DecodeFile(cfgPath, cfg)
+	patterns, err := loadPatterns(cfgPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return 0, nil
 		}
 		return 0, err
 	}
+	p.patterns = patterns
+	return 0, nil
+}
+
+// Reload loads and compiles cfgPath, patterns are swapped only if the whole config is valid,
+// a missing cfgPath means no patterns as in Init
+func (p *TvDir) Reload(cfgPath string) error {
+	patterns, err := loadPatterns(cfgPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.patterns = patterns
+	return nil
+}
+
+func (p *TvDir) getPatterns() []*Pattern {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.patterns
+}
+
+func loadPatterns(cfgPath string) ([]*Pattern, error) {
+	cfg := &Config{}
+	_, err := toml.DecodeFile(cfgPath, cfg)
+	if err != nil {
+		return nil, err
+	}
 	for _, pattern := range cfg.Patterns {
 		pattern.DirPattern, err = regexp.Compile(pattern.DirPatternStr)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
 		pattern.EpisodePattern, err = regexp.Compile(pattern.EpisodePatternStr)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
 		pattern.EpisodeFileAtLeastBytes, err = utils.SizeStringToBytesNum(pattern.EpisodeFileAtLeast)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
 		pattern.SubtitlePattern, err = regexp.Compile(pattern.SubtitlePatternStr)
 		if err != nil {
-			return 0, err
+			return nil, err
+		}
+		if pattern.Absolute && pattern.EpisodeGroup != "" {
+			return nil, fmt.Errorf("dir_pattern = %s, absolute and episode_group are exclusive", pattern.DirPatternStr)
 		}
 	}
-	p.patterns = cfg.Patterns
-	return 0, nil
+	return cfg.Patterns, nil
 }
 
 func (p *TvDir) IsDefaultEnable() bool {
 	return true
 }
 
-func (p *TvDir) Parse(entry *dirinfo.Entry, opts *parser.ParserMgrRunOpts) (ok bool, err error) {
+func (p *TvDir) Parse(entry *dirinfo.Entry, opts *parser.ParserMgrRunOpts) (plan *disk.Plan, err error) {
 	if entry.Type != dirinfo.DirEntry {
-		return false, nil
+		opts.Trace.Logf("not a dir entry")
+		return nil, nil
+	}
+	if opts.Override.Skip(common.MediaTypeTv) {
+		opts.Trace.Logf("skipped, override is not tv")
+		return nil, nil
 	}
 	if len(entry.FileList) <= 0 {
-		return false, fmt.Errorf("no files in dir, entry: %s", entry.Name())
+		return nil, fmt.Errorf("no files in dir, entry: %s", entry.Name())
 	}
 	tvTargetDir, ok := opts.MediaTypeDirs[common.MediaTypeTv]
 	if !ok {
-		return false, fmt.Errorf("no tv target dir")
+		return nil, fmt.Errorf("no tv target dir")
 	}
 	trashDir, ok := opts.MediaTypeDirs[common.MediaTypeTrash]
 	if !ok {
-		return false, fmt.Errorf("no trash dir")
+		return nil, fmt.Errorf("no trash dir")
 	}
-	info, err := p.parse(entry)
+	info, err := p.parse(entry, opts.Override, opts.Absolute, opts.Trace)
 	if err != nil {
-		return false, fmt.Errorf("parse error: %v", err)
+		return nil, fmt.Errorf("parse error: %w", err)
 	}
 	if info == nil {
-		return false, nil
+		return nil, nil
 	}
 	level.Info(p.logger).Log("msg", "parsed", "dir", entry.Name(), "originalName", info.originalName, "year", info.year, "tmdbid", info.tmdbid)
-	diskService := parser.GetDefaultDiskService()
-	for mKey, file := range info.mediaFiles {
-		err = diskService.RenameTvEpisode(&disk.TvEpisodeRenameTask{
+	plan = &disk.Plan{}
+	for _, mKey := range sortedEpisodeKeys(info.mediaFiles) {
+		file := info.mediaFiles[mKey]
+		plan.AddTvEpisode(&disk.TvEpisodeRenameTask{
 			OldPath:      filepath.Join(entry.MotherPath, file.RelPathToMother),
 			NewMotherDir: tvTargetDir,
 			OriginalName: info.originalName,
@@ -117,13 +159,12 @@ func (p *TvDir) Parse(entry *dirinfo.Entry, opts *parser.ParserMgrRunOpts) (ok b
 			Tmdbid:       info.tmdbid,
 			Season:       mKey.season,
 			Episode:      mKey.episode,
+			EpisodeEnd:   mKey.episodeEnd,
 		})
-		if err != nil {
-			return false, fmt.Errorf("rename tv episode error: %v", err)
-		}
 	}
-	for sKey, file := range info.subtitleFiles {
-		err = diskService.RenameTvSubtitle(&disk.TvSubtitleRenameTask{
+	for _, sKey := range sortedSubtitleKeys(info.subtitleFiles) {
+		file := info.subtitleFiles[sKey]
+		plan.AddTvSubtitle(&disk.TvSubtitleRenameTask{
 			OldPath:      filepath.Join(entry.MotherPath, file.RelPathToMother),
 			NewMotherDir: tvTargetDir,
 			OriginalName: info.originalName,
@@ -131,20 +172,48 @@ func (p *TvDir) Parse(entry *dirinfo.Entry, opts *parser.ParserMgrRunOpts) (ok b
 			Tmdbid:       info.tmdbid,
 			Season:       sKey.season,
 			Episode:      sKey.episode,
+			EpisodeEnd:   sKey.episodeEnd,
 			Language:     sKey.lang,
 		})
-		if err != nil {
-			return false, fmt.Errorf("rename tv subtitle error: %v", err)
-		}
 	}
-	err = diskService.MoveToTrash(&disk.MoveToTrashTask{
+	plan.AddMoveToTrash(&disk.MoveToTrashTask{
 		Path:     filepath.Join(entry.MotherPath, entry.Name()),
 		TrashDir: trashDir,
+	}).Optional = true
+	return plan, nil
+}
+
+// sortedEpisodeKeys returns keys sorted by season and episode, so the plan is deterministic
+func sortedEpisodeKeys(files map[episodeKey]*dirinfo.File) []episodeKey {
+	keys := make([]episodeKey, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].season != keys[j].season {
+			return keys[i].season < keys[j].season
+		}
+		return keys[i].episode < keys[j].episode
 	})
-	if err != nil {
-		level.Warn(p.logger).Log("msg", "move to trash error", "err", err)
+	return keys
+}
+
+// sortedSubtitleKeys returns keys sorted by season, episode and language, so the plan is deterministic
+func sortedSubtitleKeys(files map[subtitleKey]*dirinfo.File) []subtitleKey {
+	keys := make([]subtitleKey, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
 	}
-	return true, nil
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].season != keys[j].season {
+			return keys[i].season < keys[j].season
+		}
+		if keys[i].episode != keys[j].episode {
+			return keys[i].episode < keys[j].episode
+		}
+		return keys[i].lang < keys[j].lang
+	})
+	return keys
 }
 
 type tvInfo struct {
@@ -156,9 +225,13 @@ type tvInfo struct {
 	subtitleFiles map[subtitleKey]*dirinfo.File
 }
 
-func (p *TvDir) parse(entry *dirinfo.Entry) (info *tvInfo, err error) {
-	for _, pattern := range p.patterns {
-		info, err := p.matchPattern(entry, pattern)
+func (p *TvDir) parse(entry *dirinfo.Entry, override *parser.Override, absolute *parser.AbsoluteEpisodes, trace *parser.Trace) (info *tvInfo, err error) {
+	patterns := p.getPatterns()
+	if len(patterns) == 0 {
+		trace.Logf("no patterns configured")
+	}
+	for _, pattern := range patterns {
+		info, err := p.matchPattern(entry, pattern, override, absolute, trace)
 		if err != nil {
 			return nil, err
 		}
@@ -176,18 +249,30 @@ const (
 )
 
 type episodeKey struct {
-	season  int
-	episode int
+	season     int
+	episode    int
+	episodeEnd int // last episode of a multi-episode file, such as 2 of S01E01-E02, 0 if single
 }
 
 type subtitleKey struct {
-	lang    string
-	season  int
-	episode int
+	lang       string
+	season     int
+	episode    int
+	episodeEnd int
 }
 
-func (p *TvDir) matchPattern(entry *dirinfo.Entry, pattern *Pattern) (info *tvInfo, err error) {
+// applyTv applies override to season and episode, episodeEnd of a multi-episode file is moved along with episode
+func applyTv(override *parser.Override, season, episode, episodeEnd int) (int, int, int) {
+	newSeason, newEpisode := override.ApplyTv(season, episode)
+	if episodeEnd <= episode {
+		return newSeason, newEpisode, 0
+	}
+	return newSeason, newEpisode, episodeEnd + newEpisode - episode
+}
+
+func (p *TvDir) matchPattern(entry *dirinfo.Entry, pattern *Pattern, override *parser.Override, absolute *parser.AbsoluteEpisodes, trace *parser.Trace) (info *tvInfo, err error) {
 	groups := pattern.DirPattern.FindStringSubmatch(entry.Name())
+	trace.Match("dir pattern", pattern.DirPattern, entry.Name(), groups)
 	if len(groups) <= 0 {
 		return nil, nil
 	}
@@ -220,14 +305,15 @@ func (p *TvDir) matchPattern(entry *dirinfo.Entry, pattern *Pattern) (info *tvIn
 	subtitleFiles := make(map[subtitleKey]*dirinfo.File)
 	for _, file := range entry.FileList {
 		if utils.IsMediaExt(file.Ext) && utils.FileAtLeast(file, pattern.EpisodeFileAtLeastBytes) {
-			mKey, err := p.matchMediaFile(file, pattern)
+			mKey, err := p.matchMediaFile(file, pattern, trace)
 			if err != nil {
 				return nil, err
 			}
 			if mKey == nil {
 				continue
 			}
-			if mKey.season < 0 || mKey.episode < 0 {
+			mKey.season, mKey.episode, mKey.episodeEnd = applyTv(override, mKey.season, mKey.episode, mKey.episodeEnd)
+			if (mKey.season < 0 && !pattern.Absolute) || mKey.episode < 0 {
 				continue
 			}
 			mediaFiles[*mKey] = file
@@ -240,50 +326,41 @@ func (p *TvDir) matchPattern(entry *dirinfo.Entry, pattern *Pattern) (info *tvIn
 			fileNameWithoutExt := file.Name[:len(file.Name)-len(file.Ext)-1]
 			mKey, ok := mediaFileRev[fileNameWithoutExt]
 			if ok {
-				sKey := &subtitleKey{lang: "", season: mKey.season, episode: mKey.episode}
+				sKey := &subtitleKey{lang: "", season: mKey.season, episode: mKey.episode, episodeEnd: mKey.episodeEnd}
 				subtitleFiles[*sKey] = file
 				continue
 			}
 			if pattern.SubtitlePatternStr == "" {
 				continue
 			}
-			sKey, err := p.matchSubtitleFile(file, pattern)
+			sKey, err := p.matchSubtitleFile(file, pattern, trace)
 			if err != nil {
 				return nil, err
 			}
 			if sKey == nil {
 				continue
 			}
-			if sKey.season < 0 || sKey.episode < 0 {
+			sKey.season, sKey.episode, sKey.episodeEnd = applyTv(override, sKey.season, sKey.episode, sKey.episodeEnd)
+			if (sKey.season < 0 && !pattern.Absolute) || sKey.episode < 0 {
 				continue
 			}
 			subtitleFiles[*sKey] = file
 		}
 	}
 	if len(mediaFiles) <= 0 && len(subtitleFiles) <= 0 {
+		trace.Logf("no media file at least %s matched episode pattern, no subtitle file matched", pattern.EpisodeFileAtLeast)
 		return nil, nil
 	}
-	tmdbService := parser.GetDefaultTmdbService()
+	trace.Logf("extracted name = %q, year = %d, tmdbid = %d, %d episodes, %d subtitles", info.name, info.year, info.tmdbid, len(mediaFiles), len(subtitleFiles))
+	if override != nil {
+		info.tmdbid = override.Tmdbid
+	}
+	tmdbService := trace.TmdbService(parser.GetDefaultTmdbService())
 	if info.tmdbid <= 0 {
-		searchOpts := common.DefaultTmdbSearchOpts
-		if info.year >= common.ValidStartYear {
-			searchOpts["year"] = strconv.Itoa(info.year)
-		}
-		results, err := tmdbService.GetSearchTVShow(info.name, searchOpts)
+		info.tmdbid, err = identify.SearchTv(tmdbService, info.name, info.year, p.logger)
 		if err != nil {
 			return nil, err
 		}
-		if results.TotalResults <= 0 {
-			return nil, fmt.Errorf("no tv show found, name: %s, year: %d", info.name, info.year)
-		}
-		if results.TotalResults > 1 {
-			var hits []string
-			for i := 0; i < 3 && i < len(results.Results); i++ {
-				hits = append(hits, fmt.Sprintf("%s-%d", results.Results[i].OriginalName, results.Results[i].ID))
-			}
-			return nil, fmt.Errorf("multiple tvs found: %v", hits)
-		}
-		info.tmdbid = int(results.Results[0].ID)
 	}
 	detail, err := tmdbService.GetTVDetails(info.tmdbid, common.DefaultTmdbSearchOpts)
 	if err != nil {
@@ -295,18 +372,83 @@ func (p *TvDir) matchPattern(entry *dirinfo.Entry, pattern *Pattern) (info *tvIn
 		return nil, err
 	}
 	info.year = dt.Year
+	switch {
+	case pattern.Absolute:
+		mediaFiles, subtitleFiles, err = remapEpisodes(mediaFiles, subtitleFiles, func(key episodeKey) (episodeKey, error) {
+			season, episode, err := absolute.Map(tmdbService, info.tmdbid, key.episode)
+			if err != nil {
+				return key, fmt.Errorf("map absolute episode, error = %v", err)
+			}
+			trace.Logf("absolute episode %d is season %d episode %d", key.episode, season, episode)
+			return episodeKey{season: season, episode: episode}, nil
+		})
+	case pattern.EpisodeGroup != "":
+		mediaFiles, subtitleFiles, err = remapEpisodes(mediaFiles, subtitleFiles, func(key episodeKey) (episodeKey, error) {
+			season, episode, err := parser.MapEpisodeGroup(tmdbService, info.tmdbid, pattern.EpisodeGroup, key.season, key.episode)
+			if err != nil {
+				return key, fmt.Errorf("map episode group, error = %v", err)
+			}
+			trace.Logf("season %d episode %d of episode group %s is season %d episode %d", key.season, key.episode, pattern.EpisodeGroup, season, episode)
+			return episodeKey{season: season, episode: episode}, nil
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
 	info.mediaFiles = mediaFiles
 	info.subtitleFiles = subtitleFiles
 	return info, nil
 }
 
+// remapEpisodes maps seasons and episodes of media and subtitle files by mapEpisode, such as from absolute numbers,
+// both ends of a multi-episode file are mapped and must stay in one season
+func remapEpisodes(mediaFiles map[episodeKey]*dirinfo.File, subtitleFiles map[subtitleKey]*dirinfo.File,
+	mapEpisode func(key episodeKey) (episodeKey, error),
+) (map[episodeKey]*dirinfo.File, map[subtitleKey]*dirinfo.File, error) {
+	mapKey := func(key episodeKey) (episodeKey, error) {
+		mKey, err := mapEpisode(episodeKey{season: key.season, episode: key.episode})
+		if err != nil || key.episodeEnd <= key.episode {
+			return mKey, err
+		}
+		endKey, err := mapEpisode(episodeKey{season: key.season, episode: key.episodeEnd})
+		if err != nil {
+			return mKey, err
+		}
+		if endKey.season != mKey.season || endKey.episode <= mKey.episode {
+			return mKey, fmt.Errorf("episodes %d to %d are not a range of one season, got S%02dE%02d to S%02dE%02d",
+				key.episode, key.episodeEnd, mKey.season, mKey.episode, endKey.season, endKey.episode)
+		}
+		mKey.episodeEnd = endKey.episode
+		return mKey, nil
+	}
+	newMediaFiles := make(map[episodeKey]*dirinfo.File, len(mediaFiles))
+	for key, file := range mediaFiles {
+		mKey, err := mapKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		newMediaFiles[mKey] = file
+	}
+	newSubtitleFiles := make(map[subtitleKey]*dirinfo.File, len(subtitleFiles))
+	for key, file := range subtitleFiles {
+		mKey, err := mapKey(episodeKey{season: key.season, episode: key.episode, episodeEnd: key.episodeEnd})
+		if err != nil {
+			return nil, nil, err
+		}
+		newSubtitleFiles[subtitleKey{lang: key.lang, season: mKey.season, episode: mKey.episode, episodeEnd: mKey.episodeEnd}] = file
+	}
+	return newMediaFiles, newSubtitleFiles, nil
+}
+
 const (
-	mediaGroupSeason  = "season"
-	mediaGroupEpisode = "episode"
+	mediaGroupSeason     = "season"
+	mediaGroupEpisode    = "episode"
+	mediaGroupEpisodeEnd = "episode_end" // optional, such as 02 of S01E01-E02
 )
 
-func (p *TvDir) matchMediaFile(file *dirinfo.File, pattern *Pattern) (key *episodeKey, err error) {
+func (p *TvDir) matchMediaFile(file *dirinfo.File, pattern *Pattern, trace *parser.Trace) (key *episodeKey, err error) {
 	groups := pattern.EpisodePattern.FindStringSubmatch(file.Name)
+	trace.Match("episode pattern", pattern.EpisodePattern, file.Name, groups)
 	if len(groups) <= 0 {
 		return nil, nil
 	}
@@ -331,6 +473,15 @@ func (p *TvDir) matchMediaFile(file *dirinfo.File, pattern *Pattern) (key *episo
 				return nil, err
 			}
 			key.episode = episode
+		case mediaGroupEpisodeEnd:
+			if groups[i] == "" {
+				continue
+			}
+			episodeEnd, err := strconv.Atoi(groups[i])
+			if err != nil {
+				return nil, err
+			}
+			key.episodeEnd = episodeEnd
 		default:
 			return nil, fmt.Errorf("unknown group name: %s", name)
 		}
@@ -344,8 +495,9 @@ const (
 	subtitleGroupEpisode = "episode"
 )
 
-func (p *TvDir) matchSubtitleFile(file *dirinfo.File, pattern *Pattern) (key *subtitleKey, err error) {
+func (p *TvDir) matchSubtitleFile(file *dirinfo.File, pattern *Pattern, trace *parser.Trace) (key *subtitleKey, err error) {
 	groups := pattern.SubtitlePattern.FindStringSubmatch(file.Name)
+	trace.Match("subtitle pattern", pattern.SubtitlePattern, file.Name, groups)
 	if len(groups) <= 0 {
 		return nil, nil
 	}
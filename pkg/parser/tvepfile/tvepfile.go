@@ -1,11 +1,14 @@
 package tvepfile
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/BurntSushi/toml"
 	"github.com/go-kit/log"
@@ -14,6 +17,7 @@ import (
 	"asmediamgr/pkg/common"
 	"asmediamgr/pkg/dirinfo"
 	"asmediamgr/pkg/disk"
+	"asmediamgr/pkg/identify"
 	"asmediamgr/pkg/parser"
 )
 
@@ -27,6 +31,7 @@ func init() {
 
 type TvEpFile struct {
 	logger   log.Logger
+	mu       sync.RWMutex // guards patterns, swapped on reload
 	patterns []*PatternConfig
 }
 
@@ -35,6 +40,7 @@ type tvEpInfo struct {
 	originalName string
 	season       int
 	episode      int
+	episodeEnd   int // last episode of a multi-episode file, such as 2 of S01E01-E02, 0 if single
 	tmdbid       int
 	year         int
 }
@@ -45,6 +51,8 @@ type PatternConfig struct {
 	Season        int      `toml:"season"`
 	OptNames      []string `toml:"opt_names"`
 	EpisodeOffset *int     `toml:"episode_offset"`
+	Absolute      bool     `toml:"absolute"`      // episode is an absolute number, mapped to tmdb season and episode
+	EpisodeGroup  string   `toml:"episode_group"` // season and episode are in the ordering of the tmdb episode group
 	Pattern       *regexp.Regexp
 	Opts          []PatternOpt
 }
@@ -73,7 +81,7 @@ func loadConfigFile(cfgPath string) (*Config, error) {
 	cfg := &Config{}
 	_, err := toml.DecodeFile(cfgPath, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("DecodeFile() error = %v", err)
+		return nil, fmt.Errorf("DecodeFile() error = %w", err)
 	}
 	return cfg, nil
 }
@@ -84,42 +92,85 @@ func (p *TvEpFile) Init(cfgPath string, logger log.Logger) (priority float32, er
 		p.patterns = cfg.Patterns // TODO make 0 as invalid
 	}
 	p.logger = logger
-	for _, pattern := range p.patterns {
+	err = compilePatterns(p.patterns)
+	if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// Reload loads and compiles cfgPath, patterns are swapped only if the whole config is valid,
+// a missing cfgPath means no patterns as in Init
+func (p *TvEpFile) Reload(cfgPath string) error {
+	cfg, err := loadConfigFile(cfgPath)
+	if errors.Is(err, os.ErrNotExist) {
+		cfg, err = &Config{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	err = compilePatterns(cfg.Patterns)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.patterns = cfg.Patterns
+	return nil
+}
+
+func (p *TvEpFile) getPatterns() []*PatternConfig {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.patterns
+}
+
+func compilePatterns(patterns []*PatternConfig) (err error) {
+	for _, pattern := range patterns {
 		pattern.Pattern, err = regexp.Compile(pattern.PatternStr)
 		if err != nil {
-			return 0, fmt.Errorf("Compile() error = %v", err)
+			return fmt.Errorf("Compile() error = %v", err)
+		}
+		if pattern.Absolute && pattern.EpisodeGroup != "" {
+			return fmt.Errorf("pattern = %s, absolute and episode_group are exclusive", pattern.PatternStr)
 		}
+		pattern.Opts = nil
 		for _, optName := range pattern.OptNames {
 			opt, ok := patternOpts[optName]
 			if !ok {
-				return 0, fmt.Errorf("unknown optName = %s", optName)
+				return fmt.Errorf("unknown optName = %s", optName)
 			}
 			pattern.Opts = append(pattern.Opts, opt)
 		}
 	}
-	return 0, nil
+	return nil
 }
 
-func (p *TvEpFile) Parse(entry *dirinfo.Entry, opts *parser.ParserMgrRunOpts) (ok bool, err error) {
+func (p *TvEpFile) Parse(entry *dirinfo.Entry, opts *parser.ParserMgrRunOpts) (plan *disk.Plan, err error) {
 	if entry.Type != dirinfo.FileEntry || len(entry.FileList) != 1 {
-		return false, nil
+		opts.Trace.Logf("not a single file entry")
+		return nil, nil
+	}
+	if opts.Override.Skip(common.MediaTypeTv) {
+		opts.Trace.Logf("skipped, override is not tv")
+		return nil, nil
 	}
 	file := entry.FileList[0]
 	tvMediaTargetDir, ok := opts.MediaTypeDirs[common.MediaTypeTv]
 	if !ok {
-		return false, fmt.Errorf("no tv media target dir")
+		return nil, fmt.Errorf("no tv media target dir")
 	}
-	info, err := p.parse(entry)
+	info, err := p.parse(entry, opts.Override, opts.Absolute, opts.Trace)
 	if err != nil {
-		return false, fmt.Errorf("parse() error = %v", err)
+		return nil, fmt.Errorf("parse() error = %w", err)
 	}
 	if info == nil {
-		return false, nil // no match and no error
+		return nil, nil // no match and no error
 	}
 	level.Info(p.logger).Log("msg", "matched", "file", entry.Name(), "name", info.name, "originalName", info.originalName,
 		"season", info.season, "episode", info.episode, "tmdbid", info.tmdbid, "year", info.year)
-	diskService := parser.GetDefaultDiskService()
-	err = diskService.RenameTvEpisode(&disk.TvEpisodeRenameTask{
+	plan = &disk.Plan{}
+	plan.AddTvEpisode(&disk.TvEpisodeRenameTask{
 		OldPath:      filepath.Join(entry.MotherPath, file.RelPathToMother),
 		NewMotherDir: tvMediaTargetDir,
 		OriginalName: info.originalName,
@@ -127,16 +178,18 @@ func (p *TvEpFile) Parse(entry *dirinfo.Entry, opts *parser.ParserMgrRunOpts) (o
 		Tmdbid:       info.tmdbid,
 		Season:       info.season,
 		Episode:      info.episode,
+		EpisodeEnd:   info.episodeEnd,
 	})
-	if err != nil {
-		return false, fmt.Errorf("diskService.RenameTvEpisode() error = %v", err)
-	}
-	return true, nil
+	return plan, nil
 }
 
-func (p *TvEpFile) parse(entry *dirinfo.Entry) (info *tvEpInfo, err error) {
-	for _, pattern := range p.patterns {
-		info, err = p.patternMatch(entry, pattern)
+func (p *TvEpFile) parse(entry *dirinfo.Entry, override *parser.Override, absolute *parser.AbsoluteEpisodes, trace *parser.Trace) (info *tvEpInfo, err error) {
+	patterns := p.getPatterns()
+	if len(patterns) == 0 {
+		trace.Logf("no patterns configured")
+	}
+	for _, pattern := range patterns {
+		info, err = p.patternMatch(entry, pattern, override, absolute, trace)
 		if err != nil {
 			return nil, err // error, stop all parsers
 		}
@@ -147,10 +200,11 @@ func (p *TvEpFile) parse(entry *dirinfo.Entry) (info *tvEpInfo, err error) {
 	return nil, nil // no match and no error
 }
 
-func (p *TvEpFile) patternMatch(entry *dirinfo.Entry, pattern *PatternConfig) (info *tvEpInfo, err error) {
+func (p *TvEpFile) patternMatch(entry *dirinfo.Entry, pattern *PatternConfig, override *parser.Override, absolute *parser.AbsoluteEpisodes, trace *parser.Trace) (info *tvEpInfo, err error) {
 	file := entry.FileList[0]
 	entryNameWithoutExt, _ := strings.CutSuffix(file.Name, file.Ext)
 	groups := pattern.Pattern.FindStringSubmatch(entryNameWithoutExt)
+	trace.Match("pattern", pattern.Pattern, entryNameWithoutExt, groups)
 	if len(groups) == 0 {
 		return nil, nil
 	}
@@ -185,6 +239,27 @@ func (p *TvEpFile) patternMatch(entry *dirinfo.Entry, pattern *PatternConfig) (i
 				return nil, fmt.Errorf("ParseInt() episode error = %v", err)
 			}
 			info.episode = int(n)
+		case "episode_end": // optional, such as 02 of S01E01-E02
+			if groups[i] == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(groups[i], 10, 31)
+			if err != nil {
+				return nil, fmt.Errorf("ParseInt() episode_end error = %v", err)
+			}
+			info.episodeEnd = int(n)
+		case "seasonch": // Chinese numerals, such as 十二 of 第十二季
+			n, ok := common.ChineseToNum(groups[i])
+			if !ok {
+				return nil, fmt.Errorf("ChineseToNum() not chinese number seasonch = %s", groups[i])
+			}
+			info.season = n
+		case "episodech": // Chinese or full-width numerals, such as 二十三 of 第二十三集 or １２ of 第１２集
+			n, ok := common.ChineseToNum(groups[i])
+			if !ok {
+				return nil, fmt.Errorf("ChineseToNum() not chinese number episodech = %s", groups[i])
+			}
+			info.episode = n
 		case "tmdbid":
 			n, err := strconv.ParseInt(groups[i], 10, 31)
 			if err != nil {
@@ -203,6 +278,9 @@ func (p *TvEpFile) patternMatch(entry *dirinfo.Entry, pattern *PatternConfig) (i
 	}
 	if pattern.EpisodeOffset != nil {
 		info.episode += *pattern.EpisodeOffset
+		if info.episodeEnd > 0 {
+			info.episodeEnd += *pattern.EpisodeOffset
+		}
 	}
 	for _, opt := range pattern.Opts {
 		err = opt(entry, info)
@@ -210,7 +288,63 @@ func (p *TvEpFile) patternMatch(entry *dirinfo.Entry, pattern *PatternConfig) (i
 			return nil, fmt.Errorf("opt() error = %v", err)
 		}
 	}
-	tmdbService := parser.GetDefaultTmdbService()
+	trace.Logf("extracted name = %q, season = %d, episode = %d, episode end = %d, year = %d, tmdbid = %d",
+		info.name, info.season, info.episode, info.episodeEnd, info.year, info.tmdbid)
+	span := 0 // episodes after the first one of a multi-episode file
+	if info.episodeEnd > info.episode {
+		span = info.episodeEnd - info.episode
+	}
+	tmdbService := trace.TmdbService(parser.GetDefaultTmdbService())
+	info, err = p.deal(tmdbService, pattern, override, info)
+	if err != nil {
+		return nil, err
+	}
+	season, episode := info.season, info.episode
+	info.season, info.episode, err = p.mapEpisode(tmdbService, pattern, absolute, info.tmdbid, season, episode, trace)
+	if err != nil || span == 0 {
+		return info, err
+	}
+	endSeason, endEpisode, err := p.mapEpisode(tmdbService, pattern, absolute, info.tmdbid, season, episode+span, trace)
+	if err != nil {
+		return nil, err
+	}
+	if endSeason != info.season || endEpisode <= info.episode {
+		return nil, fmt.Errorf("episodes %d to %d are not a range of one season, got S%02dE%02d to S%02dE%02d",
+			episode, episode+span, info.season, info.episode, endSeason, endEpisode)
+	}
+	info.episodeEnd = endEpisode
+	return info, nil
+}
+
+// mapEpisode maps season and episode of an absolute or episode group pattern to the default tmdb season and episode,
+// others are returned as is
+func (p *TvEpFile) mapEpisode(tmdbService parser.TmdbService, pattern *PatternConfig, absolute *parser.AbsoluteEpisodes,
+	tmdbid, season, episode int, trace *parser.Trace,
+) (newSeason, newEpisode int, err error) {
+	switch {
+	case pattern.Absolute:
+		newSeason, newEpisode, err = absolute.Map(tmdbService, tmdbid, episode)
+		if err != nil {
+			return -1, -1, fmt.Errorf("map absolute episode, error = %v", err)
+		}
+		trace.Logf("absolute episode %d is season %d episode %d", episode, newSeason, newEpisode)
+	case pattern.EpisodeGroup != "":
+		newSeason, newEpisode, err = parser.MapEpisodeGroup(tmdbService, tmdbid, pattern.EpisodeGroup, season, episode)
+		if err != nil {
+			return -1, -1, fmt.Errorf("map episode group, error = %v", err)
+		}
+		trace.Logf("season %d episode %d of episode group %s is season %d episode %d", season, episode, pattern.EpisodeGroup, newSeason, newEpisode)
+	default:
+		return season, episode, nil
+	}
+	return newSeason, newEpisode, nil
+}
+
+// deal identifies the tv of info by what the pattern extracted
+func (p *TvEpFile) deal(tmdbService parser.TmdbService, pattern *PatternConfig, override *parser.Override, info *tvEpInfo) (newInfo *tvEpInfo, err error) {
+	if override != nil {
+		return p.dealOverride(tmdbService, override, info)
+	}
 	if info.tmdbid > 0 && pattern.Season >= 0 && info.episode >= 0 {
 		return p.dealPreTmdbAndSeason(tmdbService, pattern, info)
 	} else if info.tmdbid > 0 && info.season >= 0 && info.episode >= 0 {
@@ -229,6 +363,16 @@ var (
 	}
 )
 
+// dealOverride uses tmdbid of the override instead of the scraped or searched one
+func (p *TvEpFile) dealOverride(tmdbService parser.TmdbService, override *parser.Override, info *tvEpInfo) (newInfo *tvEpInfo, err error) {
+	info.tmdbid = override.Tmdbid
+	info.season, info.episode = override.ApplyTv(info.season, info.episode)
+	if info.season < 0 || info.episode < 0 {
+		return nil, fmt.Errorf("deal override, tmdbid = %d, invalid season = %d, episode = %d", info.tmdbid, info.season, info.episode)
+	}
+	return p.dealPreTmdbidAndScrapedSeason(tmdbService, info)
+}
+
 func (p *TvEpFile) dealPreTmdbAndSeason(tmdbService parser.TmdbService, pattern *PatternConfig, info *tvEpInfo) (newInfo *tvEpInfo, err error) {
 	tvDetail, err := tmdbService.GetTVDetails(info.tmdbid, defaultTmdbUrlOptions)
 	if err != nil {
@@ -268,25 +412,10 @@ func (p *TvEpFile) dealPreTmdbidAndScrapedSeason(tmdbService parser.TmdbService,
 }
 
 func (p *TvEpFile) dealSearchNameAndScrapedSeason(tmdbService parser.TmdbService, info *tvEpInfo) (newInfo *tvEpInfo, err error) {
-	urlOptions := defaultTmdbUrlOptions
-	if info.year > common.ValidStartYear {
-		urlOptions["year"] = strconv.Itoa(info.year)
-	}
-	tvs, err := tmdbService.GetSearchTVShow(info.name, urlOptions)
+	info.tmdbid, err = identify.SearchTv(tmdbService, info.name, info.year, p.logger)
 	if err != nil {
-		return nil, fmt.Errorf("deal search name and scraped season, name = %s, year = %d, error = %v", info.name, info.year, err)
-	}
-	if tvs.TotalResults <= 0 {
-		return nil, fmt.Errorf("deal search name and scraped season, name = %s, year = %d, no result", info.name, info.year)
-	}
-	if tvs.TotalResults > 1 {
-		var results []string
-		for i := 0; i < 3 && i < len(tvs.Results); i++ {
-			results = append(results, fmt.Sprintf("%s-%d", tvs.Results[i].Name, tvs.Results[i].ID))
-		}
-		return nil, fmt.Errorf("deal search name and scraped season, multiple result, search name = %s, year = %d ,first 3 results = %v", info.name, info.year, results)
+		return nil, fmt.Errorf("deal search name and scraped season, error = %w", err)
 	}
-	info.tmdbid = int(tvs.Results[0].ID)
 	tvDetail, err := tmdbService.GetTVDetails(info.tmdbid, defaultTmdbUrlOptions)
 	if err != nil {
 		return nil, fmt.Errorf("deal search name and scraped season, get detail of tmdbid = %d, error = %v", info.tmdbid, err)
@@ -306,25 +435,10 @@ func (p *TvEpFile) dealSearchNameAndScrapedSeason(tmdbService parser.TmdbService
 }
 
 func (p *TvEpFile) dealSearchNameAndPreSeason(tmdbService parser.TmdbService, pattern *PatternConfig, info *tvEpInfo) (newInfo *tvEpInfo, err error) {
-	urlOptions := defaultTmdbUrlOptions
-	if info.year > common.ValidStartYear {
-		urlOptions["year"] = strconv.Itoa(info.year)
-	}
-	tvs, err := tmdbService.GetSearchTVShow(info.name, urlOptions)
+	info.tmdbid, err = identify.SearchTv(tmdbService, info.name, info.year, p.logger)
 	if err != nil {
-		return nil, fmt.Errorf("deal search name and pre seaon, name = %s, year = %d, error = %v", info.name, info.year, err)
-	}
-	if tvs.TotalResults <= 0 {
-		return nil, fmt.Errorf("deal search name and pre seaon, name = %s, year = %d, no result", info.name, info.year)
-	}
-	if tvs.TotalResults > 1 {
-		var results []string
-		for i := 0; i < 3 && i < len(tvs.Results); i++ {
-			results = append(results, fmt.Sprintf("%s-%d", tvs.Results[i].Name, tvs.Results[i].ID))
-		}
-		return nil, fmt.Errorf("deal search name and pre seaon, name = %s, year = %d, multiple results, first 3 results = %v", info.name, info.year, results)
+		return nil, fmt.Errorf("deal search name and pre seaon, error = %w", err)
 	}
-	info.tmdbid = int(tvs.Results[0].ID)
 	tvDetail, err := tmdbService.GetTVDetails(info.tmdbid, defaultTmdbUrlOptions)
 	if err != nil {
 		return nil, fmt.Errorf("deal search name and pre seaon, tmdbid = %d, error = %v", info.tmdbid, err)
@@ -356,17 +470,11 @@ func OptChineseSeasonName(entry *dirinfo.Entry, info *tvEpInfo) error {
 		return nil
 	}
 	numStr := groups[2]
-	var err error
-	var n int
-	n, err = strconv.Atoi(numStr)
-	if err != nil {
-		var ok bool
-		n, ok = common.ChineseToNum(numStr)
-		if !ok {
-			return fmt.Errorf("ChineseToNum() not chinese number = %s", numStr)
-		}
+	n, ok := common.ChineseToNum(numStr) // Arabic digits as well
+	if !ok {
+		return fmt.Errorf("ChineseToNum() not chinese number = %s", numStr)
 	}
-	info.season = int(n)
-	info.name = groups[1]
+	info.season = n
+	info.name = strings.TrimSpace(groups[1])
 	return nil
 }
@@ -1,6 +1,9 @@
 package tvepfile
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 
 	tmdb "github.com/cyruzin/golang-tmdb"
@@ -85,7 +88,8 @@ func init() {
 func compareTvEpInfo(t *testing.T, got, want *tvEpInfo) {
 	t.Helper()
 	// name do not matter after matching
-	if got.originalName != want.originalName || got.season != want.season || got.episode != want.episode || got.tmdbid != want.tmdbid || got.year != want.year {
+	if got.originalName != want.originalName || got.season != want.season || got.episode != want.episode || got.episodeEnd != want.episodeEnd ||
+		got.tmdbid != want.tmdbid || got.year != want.year {
 		t.Fatalf("compareTvEpInfo() got = %v, want = %v", got, want)
 	}
 }
@@ -121,7 +125,7 @@ func TestPreTmdbidAndSeason(t *testing.T) {
 		},
 	}
 	initTvEpFile(t, parser)
-	info, err := parser.parse(entry)
+	info, err := parser.parse(entry, nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -157,7 +161,7 @@ func TestPreTmdbidAndScrapedSeason(t *testing.T) {
 		},
 	}
 	initTvEpFile(t, parser)
-	info, err := parser.parse(entry)
+	info, err := parser.parse(entry, nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -193,7 +197,7 @@ func TestSearchByNameAndScrapedSeasonAndEpisode(t *testing.T) {
 		},
 	}
 	initTvEpFile(t, parser)
-	info, err := parser.parse(entry)
+	info, err := parser.parse(entry, nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -229,7 +233,7 @@ func TestSearchByNameAndPreSeasonAndScrapedEpisode(t *testing.T) {
 		},
 	}
 	initTvEpFile(t, parser)
-	info, err := parser.parse(entry)
+	info, err := parser.parse(entry, nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -266,7 +270,7 @@ func TestSearchByNameAndPreSeasonAndScrapedEpisodeWithChineseSeasonNameOpt(t *te
 		},
 	}
 	initTvEpFile(t, parser)
-	info, err := parser.parse(entry)
+	info, err := parser.parse(entry, nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -278,3 +282,216 @@ func TestSearchByNameAndPreSeasonAndScrapedEpisodeWithChineseSeasonNameOpt(t *te
 		year:         2020,
 	})
 }
+
+func TestChineseNumeralGroups(t *testing.T) {
+	tests := []struct {
+		fileName string
+		pattern  *PatternConfig
+		season   int
+		episode  int
+	}{
+		{
+			fileName: "Search Name 第十二季 第二十三集.mp4",
+			pattern:  &PatternConfig{PatternStr: `(?P<name>.*) 第(?P<seasonch>.+)季 第(?P<episodech>.+)集`, Season: -1},
+			season:   12,
+			episode:  23,
+		},
+		{
+			fileName: "Search Name 第十季 第１２集.mp4",
+			pattern:  &PatternConfig{PatternStr: `(?P<name>.*) 第(?P<episodech>.+)集`, Season: -1, OptNames: []string{ChineseSeasonOpt}},
+			season:   10,
+			episode:  12,
+		},
+		{
+			fileName: "Search Name 第一百零五期.mp4",
+			pattern:  &PatternConfig{PatternStr: `(?P<name>.*) 第(?P<episodech>.+)期`, Season: 1},
+			season:   1,
+			episode:  105,
+		},
+	}
+	for _, tt := range tests {
+		entry := &dirinfo.Entry{
+			Type:     dirinfo.FileEntry,
+			FileList: []*dirinfo.File{{Name: tt.fileName, Ext: ".mp4"}},
+		}
+		parser := &TvEpFile{patterns: []*PatternConfig{tt.pattern}}
+		initTvEpFile(t, parser)
+		info, err := parser.parse(entry, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("parse() fileName = %s, error = %v", tt.fileName, err)
+		}
+		compareTvEpInfo(t, info, &tvEpInfo{
+			originalName: "Some Original Name",
+			season:       tt.season,
+			episode:      tt.episode,
+			tmdbid:       123456789,
+			year:         2020,
+		})
+	}
+
+	entry := &dirinfo.Entry{Type: dirinfo.FileEntry, FileList: []*dirinfo.File{{Name: "Search Name 第甲集.mp4", Ext: ".mp4"}}}
+	parser := &TvEpFile{patterns: []*PatternConfig{{PatternStr: `(?P<name>.*) 第(?P<episodech>.+)集`, Season: 1}}}
+	initTvEpFile(t, parser)
+	if _, err := parser.parse(entry, nil, nil, nil); err == nil {
+		t.Fatalf("parse() not a number should fail")
+	}
+}
+
+func TestReload(t *testing.T) {
+	parser := &TvEpFile{}
+	initTvEpFile(t, parser)
+	cfgPath := filepath.Join(t.TempDir(), "tvepfile.toml")
+	err := os.WriteFile(cfgPath, []byte("[[patterns]]\npattern = 'ep(?P<episode>\\d+)'\ntmdbid = 1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = parser.Reload(cfgPath)
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(parser.getPatterns()) != 1 {
+		t.Fatalf("Reload() patterns got = %d, want = 1", len(parser.getPatterns()))
+	}
+	err = os.WriteFile(cfgPath, []byte("[[patterns]]\npattern = 'ep(?P<episode>\\d+'\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = parser.Reload(cfgPath)
+	if err == nil {
+		t.Fatalf("Reload() invalid pattern should fail")
+	}
+	if len(parser.getPatterns()) != 1 || parser.getPatterns()[0].Tmdbid != 1 {
+		t.Fatalf("Reload() previous patterns should be kept")
+	}
+	err = os.Remove(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = parser.Reload(cfgPath)
+	if err != nil {
+		t.Fatalf("Reload() missing config error = %v", err)
+	}
+	if len(parser.getPatterns()) != 0 {
+		t.Fatalf("Reload() missing config patterns got = %d, want = 0", len(parser.getPatterns()))
+	}
+}
+
+func TestOverride(t *testing.T) {
+	entry := &dirinfo.Entry{
+		Type: dirinfo.FileEntry,
+		FileList: []*dirinfo.File{
+			{
+				Name: "[Group] Ambiguous Name - 05 [1080p].mkv",
+				Ext:  ".mkv",
+			},
+		},
+	}
+	p := &TvEpFile{
+		patterns: []*PatternConfig{
+			{
+				PatternStr: `^\[Group\] (?P<name>.*) - (?P<episode>\d+) \[1080p\]$`,
+				Season:     1,
+			},
+		},
+	}
+	initTvEpFile(t, p)
+	season, offset := 2, -4
+	info, err := p.parse(entry, &parser.Override{
+		Tmdbid:        123456789,
+		Season:        &season,
+		EpisodeOffset: &offset,
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareTvEpInfo(t, info, &tvEpInfo{
+		originalName: "Some Original Name",
+		season:       2,
+		episode:      1,
+		tmdbid:       123456789,
+		year:         2020,
+	})
+}
+
+func TestEpisodeGroup(t *testing.T) {
+	groups := &tmdb.TVEpisodeGroupsDetails{}
+	err := json.Unmarshal([]byte(`{"id": "group", "groups": [
+		{"name": "Part 2", "order": 2, "episodes": [
+			{"show_id": 123456789, "season_number": 1, "episode_number": 13, "order": 0},
+			{"show_id": 123456789, "season_number": 1, "episode_number": 14, "order": 1}
+		]}
+	]}`), groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeTmdbService.TvEpisodeGroupMapping["group"] = groups
+	defer delete(fakeTmdbService.TvEpisodeGroupMapping, "group")
+	entry := &dirinfo.Entry{
+		Type: dirinfo.FileEntry,
+		FileList: []*dirinfo.File{
+			{
+				Name: "Search Name S02E02.mkv",
+				Ext:  ".mkv",
+			},
+		},
+	}
+	p := &TvEpFile{
+		patterns: []*PatternConfig{
+			{
+				PatternStr:   `^(?P<name>.*) S(?P<season>\d+)E(?P<episode>\d+)$`,
+				Season:       -1,
+				EpisodeGroup: "group",
+			},
+		},
+	}
+	initTvEpFile(t, p)
+	info, err := p.parse(entry, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareTvEpInfo(t, info, &tvEpInfo{
+		originalName: "Some Original Name",
+		season:       1,
+		episode:      14,
+		tmdbid:       123456789,
+		year:         2020,
+	})
+	p.patterns[0].Absolute = true
+	if err := compilePatterns(p.patterns); err == nil {
+		t.Fatalf("compilePatterns() absolute and episode_group should be exclusive")
+	}
+}
+
+func TestMultiEpisode(t *testing.T) {
+	p := &TvEpFile{
+		patterns: []*PatternConfig{
+			{
+				PatternStr: `^(?P<name>.*) S(?P<season>\d+)E(?P<episode>\d+)(?:-?E(?P<episode_end>\d+))?$`,
+				Season:     -1,
+			},
+		},
+	}
+	initTvEpFile(t, p)
+	for name, wantEnd := range map[string]int{
+		"Search Name S01E01E02.mkv":  2,
+		"Search Name S01E01-E03.mkv": 3,
+		"Search Name S01E01.mkv":     0,
+	} {
+		entry := &dirinfo.Entry{
+			Type:     dirinfo.FileEntry,
+			FileList: []*dirinfo.File{{Name: name, Ext: ".mkv"}},
+		}
+		info, err := p.parse(entry, nil, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compareTvEpInfo(t, info, &tvEpInfo{
+			originalName: "Some Original Name",
+			season:       1,
+			episode:      1,
+			episodeEnd:   wantEnd,
+			tmdbid:       123456789,
+			year:         2020,
+		})
+	}
+}
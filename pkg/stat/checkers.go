@@ -79,9 +79,16 @@ type multipleTvEpisodeChecker struct{}
 
 func (mtec *multipleTvEpisodeChecker) check(tvStat *tvStat) StatErr {
 	statErr := &MultipleTvEpisodeStatErr{tmdbid: tvStat.tmdbid}
+	seen := make(map[*fileInfo]bool) // a multi-episode file is in episodeFiles of each of its episodes
 	for _, files := range tvStat.episodeFiles {
-		if len(files) > 1 {
-			statErr.fileInfos = append(statErr.fileInfos, files...)
+		if len(files) <= 1 {
+			continue
+		}
+		for _, file := range files {
+			if !seen[file] {
+				seen[file] = true
+				statErr.fileInfos = append(statErr.fileInfos, file)
+			}
 		}
 	}
 	if len(statErr.fileInfos) > 0 {
@@ -119,9 +126,11 @@ type largeTvEpisodeChecker struct {
 
 func (ltec *largeTvEpisodeChecker) check(tvStat *tvStat) StatErr {
 	statErr := &LargeTvEpisodeStatErr{tmdbid: tvStat.tmdbid}
+	seen := make(map[*fileInfo]bool)
 	for _, files := range tvStat.episodeFiles {
 		for _, file := range files {
-			if file.size > ltec.sizeThreshold {
+			if file.size > ltec.sizeThreshold && !seen[file] {
+				seen[file] = true
 				statErr.fileInfos = append(statErr.fileInfos, file)
 			}
 		}
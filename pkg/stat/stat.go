@@ -1,6 +1,7 @@
 package stat
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,6 +13,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 
+	"asmediamgr/pkg/common"
 	"asmediamgr/pkg/dirinfo"
 	"asmediamgr/pkg/utils"
 )
@@ -42,6 +44,8 @@ type Stat struct {
 	tvStats    map[int]*tvStat
 	tvCheckers []tvChecker
 	tvStatErrs []StatErr
+
+	trigger chan struct{} // requests a stat task right away, see RunNow
 }
 
 const (
@@ -68,6 +72,7 @@ func NewStat(opts *StatOpts) (*Stat, error) {
 		initWait:  opts.InitWait,
 		tvDirs:    opts.TvDirs,
 		movieDirs: opts.MovieDirs,
+		trigger:   make(chan struct{}, 1),
 	}
 	st.movieCheckers = append(st.movieCheckers, &multipleMovieChecker{})
 	if opts.LargeMovieSize > 0 {
@@ -116,19 +121,40 @@ type fileInfo struct {
 	size int64
 }
 
-func (st *Stat) Run() error {
+// Run runs stat task every interval until ctx is done, a running stat task is always finished
+func (st *Stat) Run(ctx context.Context) error {
 	if st.initWait > 0 {
 		level.Info(st.logger).Log("msg", "wait for init", "dur", st.initWait)
-		initWaitTicker := time.NewTicker(st.initWait)
-		<-initWaitTicker.C
-		initWaitTicker.Stop()
+		if !common.SleepContext(ctx, st.initWait) {
+			return nil
+		}
 	}
 	st.statTask()
 	ticker := time.NewTicker(st.interval)
-	for range ticker.C {
-		st.statTask()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			st.statTask()
+		case <-st.trigger:
+			st.statTask()
+		}
+	}
+}
+
+// RunNow requests a stat task right away, it is run by Run after the running task if any,
+// returns false if a request is already pending
+// Note: this function is concurrent safe
+func (st *Stat) RunNow() bool {
+	select {
+	case st.trigger <- struct{}{}:
+		level.Info(st.logger).Log("msg", "stat task requested")
+		return true
+	default:
+		return false
 	}
-	return nil
 }
 
 type MovieStat struct {
@@ -422,7 +448,7 @@ func (st *Stat) getTotalMovieFiles(entry *dirinfo.Entry) []*fileInfo {
 }
 
 var (
-	tvEpisodePattern = regexp.MustCompile(`^.*S(?P<season>\d+)E(?P<episode>\d+).*$`)
+	tvEpisodePattern = regexp.MustCompile(`^.*S(?P<season>\d+)E(?P<episode>\d+)(?:-E(?P<episode_end>\d+))?.*$`)
 )
 
 type tvEpisodeNameInvalid struct {
@@ -460,6 +486,7 @@ func (st *Stat) getTotalTvEpisodeFiles(entry *dirinfo.Entry) map[tvEpisodeKey][]
 		}
 		season := -1
 		episode := -1
+		episodeEnd := -1
 		var err error
 		for i, name := range tvEpisodePattern.SubexpNames() {
 			switch name {
@@ -475,19 +502,32 @@ func (st *Stat) getTotalTvEpisodeFiles(entry *dirinfo.Entry) map[tvEpisodeKey][]
 					level.Error(st.logger).Log("msg", "failed to get episode", "invalid file", file.RelPathToMother)
 					continue
 				}
+			case "episode_end":
+				if groups[i] == "" {
+					continue
+				}
+				episodeEnd, err = strconv.Atoi(groups[i])
+				if err != nil {
+					level.Error(st.logger).Log("msg", "failed to get episode end", "invalid file", file.RelPathToMother)
+					continue
+				}
 			}
 		}
 		if season < 0 || episode < 0 {
 			level.Error(st.logger).Log("msg", "failed to get season or episode", "invalid file", file.RelPathToMother)
 		}
-		key := tvEpisodeKey{season: season, episode: episode}
-		if _, ok := episodeFiles[key]; !ok {
-			episodeFiles[key] = make([]*fileInfo, 0)
+		if episodeEnd < episode {
+			episodeEnd = episode
 		}
-		episodeFiles[key] = append(episodeFiles[key], &fileInfo{
+		// a multi-episode file, such as S01E01-E02, is a file of each episode in its range
+		info := &fileInfo{
 			path: filepath.Join(entry.MotherPath, file.RelPathToMother),
 			size: file.BytesNum,
-		})
+		}
+		for ep := episode; ep <= episodeEnd; ep++ {
+			key := tvEpisodeKey{season: season, episode: ep}
+			episodeFiles[key] = append(episodeFiles[key], info)
+		}
 	}
 	return episodeFiles
 }
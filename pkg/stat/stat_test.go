@@ -1 +1,50 @@
 package stat
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+
+	"asmediamgr/pkg/dirinfo"
+)
+
+func TestMultiEpisodeFiles(t *testing.T) {
+	newEntry := func(names ...string) *dirinfo.Entry {
+		entry := &dirinfo.Entry{MyDirPath: "Show (2020) [tmdbid-1]"}
+		for _, name := range names {
+			entry.FileList = append(entry.FileList, &dirinfo.File{
+				RelPathToMother: filepath.Join(entry.MyDirPath, "Season 1", name),
+				Name:            name,
+				Ext:             filepath.Ext(name),
+			})
+		}
+		return entry
+	}
+	tests := []struct {
+		name     string
+		entry    *dirinfo.Entry
+		episodes int
+		wantErr  bool
+	}{
+		{"range", newEntry("S01E01-E02.mkv", "S01E03.mkv"), 3, false},
+		{"overlap", newEntry("S01E01-E02.mkv", "S01E02.mkv"), 2, true},
+		{"single", newEntry("S01E01.mkv", "S01E02.mkv"), 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &Stat{logger: log.NewNopLogger()}
+			episodeFiles := st.getTotalTvEpisodeFiles(tt.entry)
+			if len(episodeFiles) != tt.episodes {
+				t.Fatalf("getTotalTvEpisodeFiles() got %d episodes, want %d", len(episodeFiles), tt.episodes)
+			}
+			statErr := (&multipleTvEpisodeChecker{}).check(&tvStat{tmdbid: 1, episodeFiles: episodeFiles})
+			if (statErr != nil) != tt.wantErr {
+				t.Fatalf("check() error = %v, wantErr = %v", statErr, tt.wantErr)
+			}
+			if statErr != nil && len(statErr.(*MultipleTvEpisodeStatErr).fileInfos) != 2 {
+				t.Errorf("check() got files = %d, want 2", len(statErr.(*MultipleTvEpisodeStatErr).fileInfos))
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package tmdb
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces out requests evenly, so at most rate requests are sent per second
+// Note: this struct is concurrent safe
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newRateLimiter creates a rate limiter, rate <= 0 means no limit
+func newRateLimiter(rate float64) *rateLimiter {
+	l := &rateLimiter{}
+	if rate > 0 {
+		l.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return l
+}
+
+// wait blocks until the caller is allowed to send a request
+func (l *rateLimiter) wait() {
+	if l.interval <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	sleep := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	if sleep > 0 {
+		time.Sleep(sleep)
+	}
+}
@@ -0,0 +1,35 @@
+package tmdb
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(100)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 11; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.wait()
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("wait() 11 requests at 100/s took %v, want at least 100ms", elapsed)
+	}
+}
+
+func TestRateLimiterNoLimit(t *testing.T) {
+	l := newRateLimiter(0)
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		l.wait()
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("wait() without limit took %v", elapsed)
+	}
+}
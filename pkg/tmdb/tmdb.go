@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
@@ -18,12 +19,17 @@ import (
 type Configuration struct {
 	Sock5Proxy    string
 	ValidCacheDur time.Duration
+	RateLimit     float64 // max requests per second sent to tmdb, shared by all callers, 0 means no limit
 	Logger        log.Logger
 }
 
+// TmdbService is a tmdb client with cache and rate limit
+// Note: this struct is concurrent safe
 type TmdbService struct {
 	logger        log.Logger
 	httpClient    *tmdb.Client
+	limiter       *rateLimiter
+	cacheMu       sync.Mutex
 	cache         *searchCache
 	validCacheDur time.Duration
 }
@@ -58,11 +64,13 @@ func NewTmdbService(c *Configuration) (*TmdbService, error) {
 	return &TmdbService{
 		logger:        c.Logger,
 		httpClient:    tmdbClient,
+		limiter:       newRateLimiter(c.RateLimit),
 		cache:         newSearchCache(),
 		validCacheDur: c.ValidCacheDur,
 	}, nil
 }
 
+// cleanInvalid drops expired cache, must be called with cacheMu held
 func (tc *TmdbService) cleanInvalid() {
 	now := time.Now()
 	for k, v := range tc.cache.movieResults {
@@ -85,76 +93,239 @@ func (tc *TmdbService) cleanInvalid() {
 			delete(tc.cache.tvDetails, k)
 		}
 	}
+	for k, v := range tc.cache.tvSeasonDetails {
+		if v.validBefore.Before(now) {
+			delete(tc.cache.tvSeasonDetails, k)
+		}
+	}
+	for k, v := range tc.cache.tvEpisodeGroups {
+		if v.validBefore.Before(now) {
+			delete(tc.cache.tvEpisodeGroups, k)
+		}
+	}
+	for k, v := range tc.cache.movieAltTitles {
+		if v.validBefore.Before(now) {
+			delete(tc.cache.movieAltTitles, k)
+		}
+	}
+	for k, v := range tc.cache.tvAltTitles {
+		if v.validBefore.Before(now) {
+			delete(tc.cache.tvAltTitles, k)
+		}
+	}
+	for k, v := range tc.cache.multiResults {
+		if v.validBefore.Before(now) {
+			delete(tc.cache.multiResults, k)
+		}
+	}
 }
 
 func (tc *TmdbService) GetSearchMovies(query string, urlOptions map[string]string) (*tmdb.SearchMovies, error) {
-	tc.cleanInvalid()
 	key := buildQueryKey(query, urlOptions)
-	if v, ok := tc.cache.movieResults[key]; ok {
+	tc.cacheMu.Lock()
+	tc.cleanInvalid()
+	v, ok := tc.cache.movieResults[key]
+	tc.cacheMu.Unlock()
+	if ok {
 		return v.any, nil
 	}
+	tc.limiter.wait()
 	results, err := tc.httpClient.GetSearchMovies(query, urlOptions)
 	if err != nil {
 		return nil, err
 	}
+	tc.cacheMu.Lock()
 	tc.cache.movieResults[key] = &movieResultsCache{
 		validBefore: time.Now().Add(tc.validCacheDur),
 		any:         results,
 	}
+	tc.cacheMu.Unlock()
 	return results, nil
 }
 
 func (tc *TmdbService) GetMovieDetails(id int, urlOptions map[string]string) (*tmdb.MovieDetails, error) {
-	tc.cleanInvalid()
 	key := buildIdKey(id)
-	if v, ok := tc.cache.movieDetails[key]; ok {
+	tc.cacheMu.Lock()
+	tc.cleanInvalid()
+	v, ok := tc.cache.movieDetails[key]
+	tc.cacheMu.Unlock()
+	if ok {
 		return v.any, nil
 	}
+	tc.limiter.wait()
 	detail, err := tc.httpClient.GetMovieDetails(id, urlOptions)
 	if err != nil {
 		return nil, err
 	}
+	tc.cacheMu.Lock()
 	tc.cache.movieDetails[key] = &movieDetailCache{
 		validBefore: time.Now().Add(tc.validCacheDur),
 		any:         detail,
 	}
+	tc.cacheMu.Unlock()
 	return detail, nil
 }
 
 func (tc *TmdbService) GetSearchTVShow(query string, urlOptions map[string]string) (*tmdb.SearchTVShows, error) {
-	tc.cleanInvalid()
 	key := buildQueryKey(query, urlOptions)
-	if v, ok := tc.cache.tvResults[key]; ok {
+	tc.cacheMu.Lock()
+	tc.cleanInvalid()
+	v, ok := tc.cache.tvResults[key]
+	tc.cacheMu.Unlock()
+	if ok {
 		return v.any, nil
 	}
+	tc.limiter.wait()
 	results, err := tc.httpClient.GetSearchTVShow(query, urlOptions)
 	if err != nil {
 		return nil, err
 	}
+	tc.cacheMu.Lock()
 	tc.cache.tvResults[key] = &tvResultsCache{
 		validBefore: time.Now().Add(tc.validCacheDur),
 		any:         results,
 	}
+	tc.cacheMu.Unlock()
 	return results, err
 }
 
 func (tc *TmdbService) GetTVDetails(id int, urlOptions map[string]string) (*tmdb.TVDetails, error) {
-	tc.cleanInvalid()
 	key := buildIdKey(id)
-	if v, ok := tc.cache.tvDetails[key]; ok {
+	tc.cacheMu.Lock()
+	tc.cleanInvalid()
+	v, ok := tc.cache.tvDetails[key]
+	tc.cacheMu.Unlock()
+	if ok {
 		return v.any, nil
 	}
+	tc.limiter.wait()
 	detail, err := tc.httpClient.GetTVDetails(id, urlOptions)
 	if err != nil {
 		return nil, err
 	}
+	tc.cacheMu.Lock()
 	tc.cache.tvDetails[key] = &tvDetailCache{
 		validBefore: time.Now().Add(tc.validCacheDur),
 		any:         detail,
 	}
+	tc.cacheMu.Unlock()
 	return detail, err
 }
 
+func (tc *TmdbService) GetTVSeasonDetails(id, seasonNumber int, urlOptions map[string]string) (*tmdb.TVSeasonDetails, error) {
+	key := seasonKey{id: id, season: seasonNumber}
+	tc.cacheMu.Lock()
+	tc.cleanInvalid()
+	v, ok := tc.cache.tvSeasonDetails[key]
+	tc.cacheMu.Unlock()
+	if ok {
+		return v.any, nil
+	}
+	tc.limiter.wait()
+	detail, err := tc.httpClient.GetTVSeasonDetails(id, seasonNumber, urlOptions)
+	if err != nil {
+		return nil, err
+	}
+	tc.cacheMu.Lock()
+	tc.cache.tvSeasonDetails[key] = &tvSeasonDetailCache{
+		validBefore: time.Now().Add(tc.validCacheDur),
+		any:         detail,
+	}
+	tc.cacheMu.Unlock()
+	return detail, nil
+}
+
+func (tc *TmdbService) GetTVEpisodeGroupsDetails(id string, urlOptions map[string]string) (*tmdb.TVEpisodeGroupsDetails, error) {
+	tc.cacheMu.Lock()
+	tc.cleanInvalid()
+	v, ok := tc.cache.tvEpisodeGroups[id]
+	tc.cacheMu.Unlock()
+	if ok {
+		return v.any, nil
+	}
+	tc.limiter.wait()
+	detail, err := tc.httpClient.GetTVEpisodeGroupsDetails(id, urlOptions)
+	if err != nil {
+		return nil, err
+	}
+	tc.cacheMu.Lock()
+	tc.cache.tvEpisodeGroups[id] = &tvEpisodeGroupCache{
+		validBefore: time.Now().Add(tc.validCacheDur),
+		any:         detail,
+	}
+	tc.cacheMu.Unlock()
+	return detail, nil
+}
+
+func (tc *TmdbService) GetMovieAlternativeTitles(id int, urlOptions map[string]string) (*tmdb.MovieAlternativeTitles, error) {
+	key := buildIdKey(id)
+	tc.cacheMu.Lock()
+	tc.cleanInvalid()
+	v, ok := tc.cache.movieAltTitles[key]
+	tc.cacheMu.Unlock()
+	if ok {
+		return v.any, nil
+	}
+	tc.limiter.wait()
+	titles, err := tc.httpClient.GetMovieAlternativeTitles(id, urlOptions)
+	if err != nil {
+		return nil, err
+	}
+	tc.cacheMu.Lock()
+	tc.cache.movieAltTitles[key] = &movieAltTitlesCache{
+		validBefore: time.Now().Add(tc.validCacheDur),
+		any:         titles,
+	}
+	tc.cacheMu.Unlock()
+	return titles, nil
+}
+
+func (tc *TmdbService) GetTVAlternativeTitles(id int, urlOptions map[string]string) (*tmdb.TVAlternativeTitles, error) {
+	key := buildIdKey(id)
+	tc.cacheMu.Lock()
+	tc.cleanInvalid()
+	v, ok := tc.cache.tvAltTitles[key]
+	tc.cacheMu.Unlock()
+	if ok {
+		return v.any, nil
+	}
+	tc.limiter.wait()
+	titles, err := tc.httpClient.GetTVAlternativeTitles(id, urlOptions)
+	if err != nil {
+		return nil, err
+	}
+	tc.cacheMu.Lock()
+	tc.cache.tvAltTitles[key] = &tvAltTitlesCache{
+		validBefore: time.Now().Add(tc.validCacheDur),
+		any:         titles,
+	}
+	tc.cacheMu.Unlock()
+	return titles, nil
+}
+
+func (tc *TmdbService) GetSearchMulti(query string, urlOptions map[string]string) (*tmdb.SearchMulti, error) {
+	key := buildQueryKey(query, urlOptions)
+	tc.cacheMu.Lock()
+	tc.cleanInvalid()
+	v, ok := tc.cache.multiResults[key]
+	tc.cacheMu.Unlock()
+	if ok {
+		return v.any, nil
+	}
+	tc.limiter.wait()
+	results, err := tc.httpClient.GetSearchMulti(query, urlOptions)
+	if err != nil {
+		return nil, err
+	}
+	tc.cacheMu.Lock()
+	tc.cache.multiResults[key] = &multiResultsCache{
+		validBefore: time.Now().Add(tc.validCacheDur),
+		any:         results,
+	}
+	tc.cacheMu.Unlock()
+	return results, nil
+}
+
 const (
 	DefaultValidCacheDuration = time.Hour * 6
 )
@@ -163,6 +334,11 @@ type idKey struct {
 	id int
 }
 
+type seasonKey struct {
+	id     int
+	season int
+}
+
 type queryKey struct {
 	query        string
 	plainUrlOpts string
@@ -183,24 +359,59 @@ type tvDetailCache struct {
 	any         *tmdb.TVDetails
 }
 
+type tvSeasonDetailCache struct {
+	validBefore time.Time
+	any         *tmdb.TVSeasonDetails
+}
+
+type tvEpisodeGroupCache struct {
+	validBefore time.Time
+	any         *tmdb.TVEpisodeGroupsDetails
+}
+
 type tvResultsCache struct {
 	validBefore time.Time
 	any         *tmdb.SearchTVShows
 }
 
+type movieAltTitlesCache struct {
+	validBefore time.Time
+	any         *tmdb.MovieAlternativeTitles
+}
+
+type tvAltTitlesCache struct {
+	validBefore time.Time
+	any         *tmdb.TVAlternativeTitles
+}
+
+type multiResultsCache struct {
+	validBefore time.Time
+	any         *tmdb.SearchMulti
+}
+
 type searchCache struct {
-	movieResults map[queryKey]*movieResultsCache
-	movieDetails map[idKey]*movieDetailCache
-	tvResults    map[queryKey]*tvResultsCache
-	tvDetails    map[idKey]*tvDetailCache
+	movieResults    map[queryKey]*movieResultsCache
+	movieDetails    map[idKey]*movieDetailCache
+	tvResults       map[queryKey]*tvResultsCache
+	tvDetails       map[idKey]*tvDetailCache
+	tvSeasonDetails map[seasonKey]*tvSeasonDetailCache
+	tvEpisodeGroups map[string]*tvEpisodeGroupCache // episode group id as key
+	movieAltTitles  map[idKey]*movieAltTitlesCache
+	tvAltTitles     map[idKey]*tvAltTitlesCache
+	multiResults    map[queryKey]*multiResultsCache
 }
 
 func newSearchCache() *searchCache {
 	return &searchCache{
-		movieResults: make(map[queryKey]*movieResultsCache),
-		movieDetails: make(map[idKey]*movieDetailCache),
-		tvResults:    make(map[queryKey]*tvResultsCache),
-		tvDetails:    make(map[idKey]*tvDetailCache),
+		movieResults:    make(map[queryKey]*movieResultsCache),
+		movieDetails:    make(map[idKey]*movieDetailCache),
+		tvResults:       make(map[queryKey]*tvResultsCache),
+		tvDetails:       make(map[idKey]*tvDetailCache),
+		tvSeasonDetails: make(map[seasonKey]*tvSeasonDetailCache),
+		tvEpisodeGroups: make(map[string]*tvEpisodeGroupCache),
+		movieAltTitles:  make(map[idKey]*movieAltTitlesCache),
+		tvAltTitles:     make(map[idKey]*tvAltTitlesCache),
+		multiResults:    make(map[queryKey]*multiResultsCache),
 	}
 }
 